@@ -0,0 +1,44 @@
+package volm
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// AccessLogMiddleware returns gin middleware logging each request
+// to log with the request ID set by RequestIDMiddleware. Requests
+// with errors log each error, others log the path, status and
+// latency at info level.
+func AccessLogMiddleware(log *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		// handlers may rewrite these
+		path := c.Request.URL.Path
+		query := c.Request.URL.RawQuery
+		c.Next()
+
+		end := time.Now()
+		id := zap.String("request_id", RequestID(c))
+
+		if len(c.Errors) > 0 {
+			for _, e := range c.Errors.Errors() {
+				log.Error(e, id)
+			}
+			return
+		}
+
+		log.Info(path,
+			id,
+			zap.Int("status", c.Writer.Status()),
+			zap.String("method", c.Request.Method),
+			zap.String("path", path),
+			zap.String("query", query),
+			zap.String("ip", c.ClientIP()),
+			zap.String("user-agent", c.Request.UserAgent()),
+			zap.String("time", end.UTC().Format(time.RFC3339)),
+			zap.Duration("latency", end.Sub(start)),
+		)
+	}
+}
@@ -0,0 +1,37 @@
+package volm
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestAccessLogMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	core, logs := observer.New(zap.InfoLevel)
+
+	r := gin.New()
+	r.Use(RequestIDMiddleware(), AccessLogMiddleware(zap.New(core)))
+	r.GET("/ping", func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	for _, id := range []string{"first", "second"} {
+		serve(r, http.MethodGet, "/ping?x=1", http.Header{RequestIDHeader: {id}})
+	}
+
+	entries := logs.All()
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 access log entries, got %d", len(entries))
+	}
+
+	for i, id := range []string{"first", "second"} {
+		fields := entries[i].ContextMap()
+		if fields["request_id"] != id || fields["status"] != int64(http.StatusNoContent) || fields["query"] != "x=1" {
+			t.Errorf("expected request %s logged with status 204 and its query, got %v", id, fields)
+		}
+	}
+}
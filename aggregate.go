@@ -0,0 +1,93 @@
+package volm
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// NoLabelValue groups PVCs without the aggregation label
+const NoLabelValue = "(none)"
+
+// LabelAggregate groups the PVCs meeting the selector
+// criteria by the value of Label.
+type LabelAggregate struct {
+	Label  string       `json:"label"`
+	Groups []LabelGroup `json:"groups"`
+}
+
+// LabelGroup counts the PVCs sharing a label value and
+// sums their requested storage.
+type LabelGroup struct {
+	Value          string `json:"value"`
+	Count          int    `json:"count"`
+	RequestedBytes int64  `json:"requestedBytes"`
+}
+
+// AggregateByLabel groups vols by the value of the label key, PVCs
+// without the label fall in the NoLabelValue group. Groups are
+// sorted by requested bytes, largest first, then by value.
+func AggregateByLabel(vols []VolumeInfo, key string) []LabelGroup {
+	byValue := map[string]*LabelGroup{}
+	for _, vol := range vols {
+		value, ok := vol.Labels[key]
+		if !ok {
+			value = NoLabelValue
+		}
+
+		group, ok := byValue[value]
+		if !ok {
+			group = &LabelGroup{Value: value}
+			byValue[value] = group
+		}
+
+		group.Count++
+		group.RequestedBytes += vol.RequestedBytes
+	}
+
+	groups := make([]LabelGroup, 0, len(byValue))
+	for _, group := range byValue {
+		groups = append(groups, *group)
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].RequestedBytes != groups[j].RequestedBytes {
+			return groups[i].RequestedBytes > groups[j].RequestedBytes
+		}
+		return groups[i].Value < groups[j].Value
+	})
+
+	return groups
+}
+
+// AggregatePVCHandler groups the PVCs by the label
+// given in the by query parameter.
+func (a *API) AggregatePVCHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !a.requireSynced(c) {
+			return
+		}
+
+		key := c.Query("by")
+		if key == "" {
+			WriteError(c, errBadRequest("by must name a label key"))
+			return
+		}
+
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			WriteError(c, errBadRequest("invalid label key %s: %s", key, strings.Join(errs, ", ")))
+			return
+		}
+
+		vols, err := a.GetPVCList()
+		if err != nil {
+			WriteError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, LabelAggregate{Label: key, Groups: AggregateByLabel(vols, key)})
+	}
+}
@@ -0,0 +1,68 @@
+package volm
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestAggregatePVCHandler(t *testing.T) {
+	pvc := func(name, team, size string) *v1.PersistentVolumeClaim {
+		pvc := testPVC("default", name)
+		if team != "" {
+			pvc.Labels = map[string]string{"team": team}
+		}
+		pvc.Spec.Resources.Requests = v1.ResourceList{v1.ResourceStorage: resource.MustParse(size)}
+		return pvc
+	}
+
+	cs := fake.NewSimpleClientset(
+		pvc("web-data", "web", "1Gi"),
+		pvc("web-cache", "web", "1Gi"),
+		pvc("db", "db", "4Gi"),
+		pvc("scratch", "", "1Gi"),
+		pvc("tmp", "", "512Mi"),
+	)
+	_, r := testAPI(t, &Config{Cs: cs})
+
+	w := serve(r, http.MethodGet, "/v1/vol/-/aggregate?by=team", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	aggregate := LabelAggregate{}
+	if err := json.Unmarshal(w.Body.Bytes(), &aggregate); err != nil {
+		t.Fatalf("malformed LabelAggregate: %s", err)
+	}
+
+	// PVCs without the label are counted under (none)
+	expected := LabelAggregate{Label: "team", Groups: []LabelGroup{
+		{Value: "db", Count: 1, RequestedBytes: 4 << 30},
+		{Value: "web", Count: 2, RequestedBytes: 2 << 30},
+		{Value: NoLabelValue, Count: 2, RequestedBytes: 1536 << 20},
+	}}
+	if !reflect.DeepEqual(aggregate, expected) {
+		t.Errorf("expected %+v, got %+v", expected, aggregate)
+	}
+
+	// a label no PVC has puts them all under (none)
+	w = serve(r, http.MethodGet, "/v1/vol/-/aggregate?by=owner", nil)
+	aggregate = LabelAggregate{}
+	if err := json.Unmarshal(w.Body.Bytes(), &aggregate); err != nil {
+		t.Fatalf("malformed LabelAggregate: %s", err)
+	}
+	if len(aggregate.Groups) != 1 || aggregate.Groups[0].Value != NoLabelValue || aggregate.Groups[0].Count != 5 {
+		t.Errorf("expected all 5 PVCs under %s, got %+v", NoLabelValue, aggregate.Groups)
+	}
+
+	for _, path := range []string{"/v1/vol/-/aggregate", "/v1/vol/-/aggregate?by=not%20a%20label"} {
+		if w := serve(r, http.MethodGet, path, nil); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", path, w.Code)
+		}
+	}
+}
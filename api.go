@@ -2,37 +2,81 @@ package volm
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
-	"os"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/zap"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedCoreV1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	appsListers "k8s.io/client-go/listers/apps/v1"
+	coreListers "k8s.io/client-go/listers/core/v1"
+	storageListers "k8s.io/client-go/listers/storage/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
 )
 
 type VolumeInfo struct {
-	Name             string                         `json:"name"`
-	Labels           map[string]string              `json:"labels,omitempty"`
-	Annotations      map[string]string              `json:"annotations,omitempty"`
-	Status           v1.PersistentVolumeClaimStatus `json:"status"`
-	Spec             v1.PersistentVolumeClaimSpec   `json:"spec"`
-	Terminating      bool                           `json:"terminating"`
-	TerminatingSince *metaV1.Time                   `json:"terminatingSince,omitempty"`
-	UsedBy           []PodInfo                      `json:"usedBy"`
+	Name               string                         `json:"name"`
+	Namespace          string                         `json:"namespace"`
+	UID                types.UID                      `json:"uid"`
+	ResourceVersion    string                         `json:"resourceVersion"`
+	Labels             map[string]string              `json:"labels,omitempty"`
+	Annotations        map[string]string              `json:"annotations,omitempty"`
+	CreationTimestamp  *metaV1.Time                   `json:"creationTimestamp,omitempty"`
+	Status             v1.PersistentVolumeClaimStatus `json:"status"`
+	Spec               v1.PersistentVolumeClaimSpec   `json:"spec"`
+	Phase              string                         `json:"phase"`
+	StorageClass       string                         `json:"storageClass,omitempty"`
+	RequestedBytes     int64                          `json:"requestedBytes"`
+	ProvisionedBytes   int64                          `json:"provisionedBytes"`
+	AccessModes        []string                       `json:"accessModes"`
+	VolumeMode         string                         `json:"volumeMode"`
+	Terminating        bool                           `json:"terminating"`
+	TerminatingSince   *metaV1.Time                   `json:"terminatingSince,omitempty"`
+	UnusedSince        *metaV1.Time                   `json:"unusedSince,omitempty"`
+	PendingSince       *metaV1.Time                   `json:"pendingSince,omitempty"`
+	PendingReason      string                         `json:"pendingReason,omitempty"`
+	VolumePhase        string                         `json:"volumePhase,omitempty"`
+	BoundVolumeMissing bool                           `json:"boundVolumeMissing,omitempty"`
+	CapacityBytes      *int64                         `json:"capacityBytes,omitempty"`
+	UsedBytes          *int64                         `json:"usedBytes,omitempty"`
+	Usage              *VolumeUsage                   `json:"usage,omitempty"`
+	ManagedBy          *OwnerInfo                     `json:"managedBy,omitempty"`
+	InUse              bool                           `json:"inUse"`
+	Events             []EventInfo                    `json:"events,omitempty"`
+	UsedBy             []PodInfo                      `json:"usedBy"`
 }
 
 type PodInfo struct {
 	Name             string            `json:"name"`
+	Namespace        string            `json:"namespace"`
 	Labels           map[string]string `json:"labels,omitempty"`
 	Annotations      map[string]string `json:"annotations,omitempty"`
 	Phase            v1.PodPhase       `json:"phase"`
+	NodeName         string            `json:"nodeName"`
+	MountPaths       []string          `json:"mountPaths"`
+	DevicePaths      []string          `json:"devicePaths,omitempty"`
 	StartTime        *metaV1.Time      `json:"startTime"`
+	Owner            *OwnerInfo        `json:"owner,omitempty"`
+	Active           bool              `json:"active"`
 	Terminating      bool              `json:"terminating"`
 	TerminatingSince *metaV1.Time      `json:"terminatingSince,omitempty"`
 }
@@ -41,22 +85,174 @@ type PodInfo struct {
 type Config struct {
 	Service      string
 	Version      string
+	Mode         string
 	Log          *zap.Logger
-	Cs           *kubernetes.Clientset
+	Cs           kubernetes.Interface
 	PVCNamespace string
 	PVCSelector  string
+
+	// PVCAnnotationSelector restricts the API to PVCs whose
+	// annotations match, using the PVCSelector key=value syntax.
+	// Annotations are not indexed so it is applied client side.
+	PVCAnnotationSelector string
+
+	// DynamicClient is used for VolumeSnapshots, snapshot
+	// endpoints return 501 when it is nil.
+	DynamicClient dynamic.Interface
+
+	// LastUsedInterval is how often PVCs referenced by pods are
+	// stamped with LastUsedAnnotation, zero disables stamping.
+	LastUsedInterval time.Duration
+
+	// LastUsedQPS limits the rate of LastUsedAnnotation patches
+	// sent to the API server.
+	LastUsedQPS float32
+
+	// ReadOnly rejects every operation that would modify a PVC.
+	ReadOnly bool
+
+	// AuditLog receives audit entries for operations that
+	// modify PVCs, defaults to Log.
+	AuditLog *zap.Logger
+
+	// ResyncPeriod of the pod and PVC informers, defaults
+	// to DefaultResyncPeriod.
+	ResyncPeriod time.Duration
+
+	// DisableResync turns off informer resyncs, the stores
+	// then only change on watch events and are never stale
+	// unless StaleAfter is set.
+	DisableResync bool
+
+	// StaleAfter is how long a store holding objects may go
+	// without an informer event before health and readiness
+	// checks fail, defaults to StaleAfterResyncs resync periods.
+	StaleAfter time.Duration
+
+	// PVCPhaseFilter limits the PVC store to PVCs in the
+	// given phases, all phases are kept when empty.
+	PVCPhaseFilter []v1.PersistentVolumeClaimPhase
+
+	// VolumeStats enables reporting kubelet volume capacity and
+	// usage, requires get access to the nodes/proxy resource.
+	VolumeStats bool
+
+	// SharedInformerFactory, when set, supplies the pod and PVC
+	// informers in place of a factory of volm's own, so embedders
+	// share watches and caches with other controllers. It must watch
+	// PVCNamespace or all namespaces, pods and PVCs in other
+	// namespaces are ignored. Its owner starts it after NewApi so the
+	// informers volm registers are started too, and stops it. The
+	// event, ReplicaSet, StorageClass and PV informers stay private.
+	SharedInformerFactory informers.SharedInformerFactory
+
+	// WatchStorageClasses starts a StorageClass informer so the
+	// storage class usage includes provisioners, requires watch
+	// access to the cluster scoped storageclasses resource.
+	WatchStorageClasses bool
+
+	// WatchPersistentVolumes starts a PersistentVolume informer so
+	// PVCs bound to a missing, Released or Failed PV are flagged,
+	// requires watch access to the persistentvolumes resource.
+	WatchPersistentVolumes bool
+
+	// EventsCacheTTL is how long the events of a PVC are
+	// cached by GetPVCEvents, zero disables caching.
+	EventsCacheTTL time.Duration
+
+	// VolumeStatsTTL is how long a PVC list with kubelet volume
+	// stats is reused before it is rebuilt with the latest collected
+	// stats, defaults to DefaultVolumeStatsTTL.
+	VolumeStatsTTL time.Duration
+
+	// VolumeStatsInterval is how often kubelet volume stats are
+	// collected in the background, defaults to VolumeStatsTTL.
+	VolumeStatsInterval time.Duration
+
+	// BulkDeleteLimit caps the number of PVCs a bulk delete may
+	// match, defaults to DefaultBulkDeleteLimit.
+	BulkDeleteLimit int
+
+	// DeletableNamespaces limits deletes to PVCs in the listed
+	// namespaces, all watched namespaces when empty.
+	DeletableNamespaces []string
+
+	// KubeAPITimeout bounds each live Kubernetes API call,
+	// defaults to DefaultKubeAPITimeout.
+	KubeAPITimeout time.Duration
+
+	// DeleteRetries is how many times the Get and Delete calls of
+	// DeletePVC are retried on conflicts, server timeouts and
+	// throttling, zero disables retries.
+	DeleteRetries int
+
+	// DeleteRetryBackoff is the delay before the first retry, doubled
+	// for each further retry, defaults to DefaultDeleteRetryBackoff.
+	DeleteRetryBackoff time.Duration
+
+	// APITokens maps accepted API tokens to their Role,
+	// empty disables authentication.
+	APITokens map[string]Role
+
+	// Templates are the PVC presets accepted by
+	// CreateFromTemplate keyed by name.
+	Templates map[string]PVCTemplate
+
+	// ProtectTokens are the only tokens accepted when removing
+	// PVC protection, empty accepts any APITokens admin token.
+	ProtectTokens []string
+
+	// WebhookURL receives a Notification when a PVC starts
+	// terminating, is stuck Pending or is deleted through
+	// volm, empty disables notifications.
+	WebhookURL string
+
+	// WebhookTemplate optionally renders the webhook body,
+	// see NotifierConfig.Template.
+	WebhookTemplate string
 }
 
 // API is primary object implementing the core API methods
 // and HTTP handlers
 type API struct {
 	*Config
-	LogErrors      prometheus.Counter
-	PVCSelectorMap map[string]string
-	PodStore       *PodStore
-	PVCStore       *PVCStore
+	LogErrors          prometheus.Counter
+	PVCSelectorMap     map[string]string
+	AnnotationMap      map[string]string
+	PodStore           *PodStore
+	PVCStore           *PVCStore
+	InformerFactory    informers.SharedInformerFactory
+	privateInformers   informers.SharedInformerFactory
+	ReplicaSetLister   appsListers.ReplicaSetLister
+	StorageClassLister storageListers.StorageClassLister
+	PVLister           coreListers.PersistentVolumeLister
+	Recorder           record.EventRecorder
+	VolumeStatsCache   *VolumeStatsCache
+	Notifier           *Notifier
+	Stopper            chan struct{}
+
+	// PVCEventIndexer holds the events involving PVCs
+	// indexed by PVC UID, for PendingReason
+	PVCEventIndexer cache.Indexer
+
+	// refreshing is set while a Resync is running
+	refreshing int32
+
+	// listCache memoizes GetPVCList between store events
+	listCache volumeListCache
+
+	// eventCache memoizes GetPVCEvents for EventsCacheTTL
+	eventCache eventCache
 }
 
+// DefaultKubeAPITimeout is the Kubernetes API call timeout
+// used when Config.KubeAPITimeout is not set.
+const DefaultKubeAPITimeout = time.Second * 30
+
+// DefaultDeleteRetryBackoff is the first delete retry delay
+// used when Config.DeleteRetryBackoff is not set.
+const DefaultDeleteRetryBackoff = time.Millisecond * 200
+
 // NewApi constructs an API object and populates it with
 // configuration along with setting defaults where required.
 func NewApi(cfg *Config) (*API, error) {
@@ -67,30 +263,73 @@ func NewApi(cfg *Config) (*API, error) {
 		zapCfg := zap.NewProductionConfig()
 		logger, err := zapCfg.Build()
 		if err != nil {
-			os.Exit(1)
+			return a, fmt.Errorf("unable to build default logger: %w", err)
 		}
 
 		a.Log = logger
 	}
 
-	a.PVCSelectorMap = map[string]string{}
-	if a.PVCSelector != "" {
-		kvs := strings.Split(a.PVCSelector, ",")
-		for _, kv := range kvs {
-			kv := strings.Split(kv, "=")
-			if len(kv) < 2 {
-				a.Log.Fatal("Malformed PVC selector")
-				os.Exit(1)
-			}
+	if a.KubeAPITimeout == 0 {
+		a.KubeAPITimeout = DefaultKubeAPITimeout
+	}
+
+	if a.AuditLog == nil {
+		a.AuditLog = a.Log
+	}
+
+	if a.DeleteRetries < 0 {
+		return a, fmt.Errorf("DeleteRetries must not be negative, got %d", a.DeleteRetries)
+	}
+
+	if a.DeleteRetryBackoff == 0 {
+		a.DeleteRetryBackoff = DefaultDeleteRetryBackoff
+	}
 
-			a.PVCSelectorMap[kv[0]] = kv[1]
+	for name, t := range a.Templates {
+		if err := t.validate(); err != nil {
+			return a, fmt.Errorf("malformed PVC template %s: %w", name, err)
 		}
 	}
 
+	var err error
+	a.PVCSelectorMap, err = parseSelector(a.PVCSelector)
+	if err != nil {
+		return a, fmt.Errorf("malformed PVC selector: %w", err)
+	}
+
+	a.AnnotationMap, err = parseSelector(a.PVCAnnotationSelector)
+	if err != nil {
+		return a, fmt.Errorf("malformed PVC annotation selector: %w", err)
+	}
+
+	if a.ResyncPeriod < 0 {
+		return a, fmt.Errorf("ResyncPeriod must not be negative, got %s", a.ResyncPeriod)
+	}
+
+	if a.ResyncPeriod == 0 {
+		a.ResyncPeriod = DefaultResyncPeriod
+	}
+
+	// one factory so pods and PVCs share a single
+	// watch per resource and a single sync point
+	resync := a.ResyncPeriod
+	if a.DisableResync {
+		resync = 0
+	}
+
+	a.privateInformers = informers.NewSharedInformerFactoryWithOptions(a.Cs, resync, informers.WithNamespace(a.PVCNamespace))
+
+	// a shared factory only supplies pods and PVCs, informers
+	// with volm specific options or handlers stay private
+	a.InformerFactory = a.SharedInformerFactory
+	if a.InformerFactory == nil {
+		a.InformerFactory = a.privateInformers
+	}
+
 	podStore, err := NewPodStore(&PodStoreConfig{
-		Namespace: a.PVCNamespace,
-		Log:       a.Log,
-		Cs:        a.Cs,
+		Namespace:             a.PVCNamespace,
+		Log:                   a.Log,
+		SharedInformerFactory: a.InformerFactory,
 	})
 	if err != nil {
 		return a, err
@@ -99,9 +338,10 @@ func NewApi(cfg *Config) (*API, error) {
 	a.PodStore = podStore
 
 	pvcStore, err := NewPVCStore(&PVCStoreConfig{
-		Namespace: a.PVCNamespace,
-		Log:       a.Log,
-		Cs:        a.Cs,
+		Namespace:             a.PVCNamespace,
+		Log:                   a.Log,
+		SharedInformerFactory: a.InformerFactory,
+		PhaseFilter:           a.PVCPhaseFilter,
 	})
 	if err != nil {
 		return a, err
@@ -109,9 +349,122 @@ func NewApi(cfg *Config) (*API, error) {
 
 	a.PVCStore = pvcStore
 
+	a.watchListCache()
+	a.watchPodChanges()
+	a.eventCache.clock = clock.RealClock{}
+
+	// resolves ReplicaSet pod owners to their Deployment
+	a.ReplicaSetLister = a.privateInformers.Apps().V1().ReplicaSets().Lister()
+
+	// events explaining why PVCs are Pending
+	eventInformer := a.privateInformers.InformerFor(&v1.Event{}, a.newPVCEventInformer)
+	a.PVCEventIndexer = eventInformer.GetIndexer()
+	a.watchPVCEvents(eventInformer)
+	pvcPendingSeconds.track(a)
+
+	if a.WatchStorageClasses {
+		a.StorageClassLister = a.privateInformers.Storage().V1().StorageClasses().Lister()
+	}
+
+	if a.WatchPersistentVolumes {
+		a.watchPersistentVolumes()
+	}
+
+	a.Stopper = make(chan struct{})
+	a.privateInformers.Start(a.Stopper)
+
+	// heal the stores from the informer caches each resync
+	if resync > 0 {
+		go a.reconcileStores(a.Stopper, resync)
+	}
+
+	// events on PVCs volm modifies, for kubectl get events
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedCoreV1.EventSinkImpl{Interface: a.Cs.CoreV1().Events(a.PVCNamespace)})
+	a.Recorder = broadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: a.Service})
+
+	go func() {
+		<-a.Stopper
+		broadcaster.Shutdown()
+	}()
+
+	if a.VolumeStats {
+		a.VolumeStatsCache = NewVolumeStatsCache(a.Cs, a.Log, a.PVCNamespace, a.VolumeStatsTTL)
+		a.VolumeStatsCache.Run(a.Stopper, a.VolumeStatsInterval, a.volumeNodes)
+	}
+
+	if a.LastUsedInterval > 0 && !a.ReadOnly {
+		a.LastUsedWatch()
+	}
+
+	if a.WebhookURL != "" {
+		a.Notifier, err = NewNotifier(a, NotifierConfig{URL: a.WebhookURL, Template: a.WebhookTemplate})
+		if err != nil {
+			return a, err
+		}
+
+		a.Notifier.Run(a.Stopper)
+	}
+
 	return a, nil
 }
 
+// WaitForCacheSync blocks until the pod and PVC informers have
+// synced, returning false if stop is closed first.
+func (a *API) WaitForCacheSync(stop <-chan struct{}) bool {
+	for _, synced := range a.privateInformers.WaitForCacheSync(stop) {
+		if !synced {
+			return false
+		}
+	}
+
+	// a shared factory only reports informers its owner started
+	return cache.WaitForCacheSync(stop, a.PVCStore.HasSynced, a.PodStore.HasSynced)
+}
+
+// RetryAfterSeconds is sent in the Retry-After header of
+// responses rejected while the caches sync.
+const RetryAfterSeconds = "5"
+
+// requireSynced writes a 503 with a Retry-After header and returns
+// false until both stores have synced, handlers served from the
+// caches call it so clients never see a partial PVC list.
+func (a *API) requireSynced(c *gin.Context) bool {
+	if a.PVCStore.HasSynced() && a.PodStore.HasSynced() {
+		return true
+	}
+
+	c.Header("Retry-After", RetryAfterSeconds)
+	WriteError(c, errNotReady())
+
+	return false
+}
+
+// kubeContext derives a context bounded by KubeAPITimeout for
+// live Kubernetes API calls made on behalf of ctx.
+func (a *API) kubeContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, a.KubeAPITimeout)
+}
+
+// retryDelete calls fn, retrying errors the API server may not
+// return again with exponential backoff up to DeleteRetries times.
+func (a *API) retryDelete(fn func() error) error {
+	backoff := wait.Backoff{
+		Steps:    a.DeleteRetries + 1,
+		Duration: a.DeleteRetryBackoff,
+		Factor:   2,
+		Jitter:   0.1,
+	}
+
+	return retry.OnError(backoff, retryable, fn)
+}
+
+// retryable returns true for conflicts, server timeouts
+// and throttling, never for not found or forbidden.
+func retryable(err error) bool {
+	return errors.IsConflict(err) || errors.IsServerTimeout(err) || errors.IsTooManyRequests(err)
+}
+
 // IsNotFound returns true if the error is a errors.StatusError
 // matching metaV1.StatusReasonNotFound this function allows us
 // to log more critical errors and pass status information such
@@ -124,214 +477,1259 @@ func IsNotFound(err error) bool {
 	return false
 }
 
+// ServiceInfo is returned by OkHandler
+type ServiceInfo struct {
+	Version     string   `json:"version"`
+	Mode        string   `json:"mode"`
+	Service     string   `json:"service"`
+	ReadOnly    bool     `json:"readOnly"`
+	APIVersions []string `json:"apiVersions"`
+}
+
+// StatusResponse is returned by operations without
+// a more specific result.
+type StatusResponse struct {
+	Status bool `json:"status"`
+}
+
 // OkHandler is provided for created a default slash route for the
 // HTTP API and returns basic version, node and service name.
 func (a *API) OkHandler(version string, mode string, service string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{"version": version, "mode": mode, "service": service})
+		c.JSON(http.StatusOK, ServiceInfo{Version: version, Mode: mode, Service: service, ReadOnly: a.ReadOnly, APIVersions: APIVersions})
 	}
 }
 
-func (a *API) ListPVCHandler() gin.HandlerFunc {
+// StaleAfterResyncs is the number of resync periods a store
+// holding objects may go without an event before it is stale.
+const StaleAfterResyncs = 3
+
+// ReadyzHandler is a readiness handler returning 200 once the
+// caches have synced and while neither store is stale.
+func (a *API) ReadyzHandler() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		pvcList, err := a.GetPVCList()
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if !a.requireSynced(c) {
+			return
+		}
+
+		if a.Stale() {
+			WriteError(c, NewAPIError(http.StatusServiceUnavailable, CodeNotReady, "no informer events received within the staleness window"))
 			return
 		}
 
-		c.JSON(http.StatusOK, pvcList)
+		c.JSON(http.StatusOK, StatusResponse{Status: true})
 	}
 }
 
-func (a *API) GetPVCList() ([]VolumeInfo, error) {
-	vols := make([]VolumeInfo, 0)
+// Stale returns true if either store holds objects yet received
+// no event, including resyncs, within StaleAfter, a sign the
+// informer watch is wedged.
+func (a *API) Stale() bool {
+	maxAge := a.staleAfter()
+	return a.PodStore.Stale(maxAge) || a.PVCStore.Stale(maxAge)
+}
+
+// staleAfter returns StaleAfter, defaulting to StaleAfterResyncs
+// resync periods, or zero to disable the check when resyncs are
+// disabled and no threshold is set.
+func (a *API) staleAfter() time.Duration {
+	if a.StaleAfter > 0 {
+		return a.StaleAfter
+	}
 
-	// get all pods
-	pods := a.PodStore.GetPods()
+	if a.DisableResync {
+		return 0
+	}
 
-	for _, pvc := range a.PVCStore.GetPVCs() {
-		var terminating bool
-		var terminatingSince *metaV1.Time
+	return a.ResyncPeriod * StaleAfterResyncs
+}
 
-		selectorPass := true
+// ListOptions filters the VolumeInfo list returned by
+// ListPVCHandler.
+type ListOptions struct {
+	CreatedBefore *time.Time
+	CreatedAfter  *time.Time
 
-		// ensure PVC meets selector criteria
-		for k, v := range a.PVCSelectorMap {
-			if _, ok := pvc.Labels[k]; !ok {
-				selectorPass = false
-			}
+	// MinSize and MaxSize bound the requested storage
+	// inclusively, PVCs requesting none never match
+	MinSize *resource.Quantity
+	MaxSize *resource.Quantity
 
-			if pvc.Labels[k] != v {
-				selectorPass = false
-			}
+	// DanglingOnly keeps PVCs flagged BoundVolumeMissing
+	DanglingOnly bool
+
+	// ActiveOnly drops pods that are not Active from UsedBy
+	ActiveOnly bool
+}
+
+// ListOptionsFromQuery parses ListOptions from the
+// query parameters of a list request.
+func ListOptionsFromQuery(c *gin.Context) (ListOptions, error) {
+	opts := ListOptions{
+		ActiveOnly:   c.Query("activeOnly") == "true",
+		DanglingOnly: c.Query("danglingOnly") == "true",
+	}
+
+	if v := c.Query("createdBefore"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return opts, errBadRequest("createdBefore must be an RFC3339 time: %s", err.Error())
 		}
+		opts.CreatedBefore = &t
+	}
 
-		if !selectorPass {
-			continue
+	if v := c.Query("createdAfter"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return opts, errBadRequest("createdAfter must be an RFC3339 time: %s", err.Error())
 		}
+		opts.CreatedAfter = &t
+	}
 
-		podList, err := a.GetPodsInfoByPVC(pods, pvc.Name)
+	if v := c.Query("minSize"); v != "" {
+		q, err := resource.ParseQuantity(v)
 		if err != nil {
-			return vols, err
+			return opts, errBadRequest("minSize must be a quantity: %s", err.Error())
 		}
+		opts.MinSize = &q
+	}
 
-		// See https://github.com/kubernetes/kubernetes/issues/22839
-		// on terminating status
-		if pvc.DeletionTimestamp != nil {
-			terminating = true
-			terminatingSince = pvc.DeletionTimestamp
+	if v := c.Query("maxSize"); v != "" {
+		q, err := resource.ParseQuantity(v)
+		if err != nil {
+			return opts, errBadRequest("maxSize must be a quantity: %s", err.Error())
 		}
-		vols = append(vols, VolumeInfo{
-			Name:             pvc.Name,
-			Labels:           pvc.Labels,
-			Annotations:      pvc.Annotations,
-			Status:           pvc.Status,
-			Spec:             pvc.Spec,
-			Terminating:      terminating,
-			TerminatingSince: terminatingSince,
-			UsedBy:           podList,
-		})
+		opts.MaxSize = &q
 	}
 
-	return vols, nil
+	return opts, nil
 }
 
-func (a *API) GetPVCHandler() gin.HandlerFunc {
+// Filter returns the volumes matching all configured options.
+func (o ListOptions) Filter(vols []VolumeInfo) []VolumeInfo {
+	filtered := make([]VolumeInfo, 0, len(vols))
+
+	for _, vol := range vols {
+		if vol, ok := o.apply(vol); ok {
+			filtered = append(filtered, vol)
+		}
+	}
+
+	return filtered
+}
+
+// apply returns the volume as listed and false
+// if the options exclude it.
+func (o ListOptions) apply(vol VolumeInfo) (VolumeInfo, bool) {
+	if o.CreatedBefore != nil && (vol.CreationTimestamp == nil || !vol.CreationTimestamp.Time.Before(*o.CreatedBefore)) {
+		return vol, false
+	}
+
+	if o.CreatedAfter != nil && (vol.CreationTimestamp == nil || !vol.CreationTimestamp.Time.After(*o.CreatedAfter)) {
+		return vol, false
+	}
+
+	if o.DanglingOnly && !vol.BoundVolumeMissing {
+		return vol, false
+	}
+
+	if o.MinSize != nil || o.MaxSize != nil {
+		requested, ok := vol.Spec.Resources.Requests[v1.ResourceStorage]
+		if !ok {
+			return vol, false
+		}
+
+		if o.MinSize != nil && requested.Cmp(*o.MinSize) < 0 {
+			return vol, false
+		}
+
+		if o.MaxSize != nil && requested.Cmp(*o.MaxSize) > 0 {
+			return vol, false
+		}
+	}
+
+	if o.ActiveOnly {
+		vol.UsedBy = activePods(vol.UsedBy)
+	}
+
+	return vol, true
+}
+
+func (a *API) ListPVCHandler() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		pvc, err := a.GetPVC(c.Param("name"))
-		if err != nil && err.Error() == "not found" {
-			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		if !a.requireSynced(c) {
 			return
 		}
+
+		opts, err := ListOptionsFromQuery(c)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			WriteError(c, err)
 			return
 		}
 
-		c.JSON(http.StatusOK, pvc)
-	}
-}
+		view, err := listView(c)
+		if err != nil {
+			WriteError(c, err)
+			return
+		}
 
-func (a *API) GetPVC(name string) (VolumeInfo, error) {
-	volInfo := VolumeInfo{}
+		if opts.DanglingOnly && a.PVLister == nil {
+			WriteError(c, errBadRequest("danglingOnly requires watching PersistentVolumes"))
+			return
+		}
 
-	pvc := a.PVCStore.GetPVC(name)
-	if pvc == nil {
-		return volInfo, fmt.Errorf("not found")
-	}
+		if c.Query("watch") == "true" {
+			a.watchPVCList(c, opts)
+			return
+		}
 
-	// ensure PVC meets selector criteria
-	for k, v := range a.PVCSelectorMap {
-		if _, ok := pvc.Labels[k]; !ok {
-			return volInfo, fmt.Errorf("PVC labels does not contain key %s", k)
+		if format, _ := negotiateFormat(c); format == FormatNDJSON {
+			a.streamPVCList(c, opts, view)
+			return
 		}
 
-		if pvc.Labels[k] != v {
-			return volInfo, fmt.Errorf("PVC label %s does not contain value %s", k, v)
+		etag := a.listETag(c)
+		if notModified(c, etag) {
+			return
 		}
-	}
 
-	volInfo.Name = pvc.Name
-	volInfo.Labels = pvc.Labels
-	volInfo.Annotations = pvc.Annotations
-	volInfo.Spec = pvc.Spec
-	volInfo.Status = pvc.Status
+		pvcList, err := a.GetPVCList()
+		if err != nil {
+			WriteError(c, err)
+			return
+		}
+		setETag(c, etag)
 
-	// See https://github.com/kubernetes/kubernetes/issues/22839
-	// on terminating status
-	if pvc.DeletionTimestamp != nil {
-		volInfo.Terminating = true
-		volInfo.TerminatingSince = pvc.DeletionTimestamp
-	}
+		vols := opts.Filter(pvcList)
+		if view == ViewSummary {
+			writeVolumes(c, volumeBriefs(vols), vols)
+			return
+		}
 
-	pods := a.PodStore.GetPods()
-	podList, err := a.GetPodsInfoByPVC(pods, pvc.Name)
-	if err != nil {
-		return VolumeInfo{}, err
+		writeVolumes(c, vols, vols)
 	}
+}
 
-	volInfo.UsedBy = podList
+// streamPVCList writes each PVC meeting the selector criteria and
+// opts as a line of JSON, flushing as each VolumeInfo is built so
+// large lists start arriving at once without being held in memory.
+// With ViewSummary each line is a VolumeBrief.
+func (a *API) streamPVCList(c *gin.Context, opts ListOptions, view string) {
+	fields := c.Query("fields")
 
-	return volInfo, err
-}
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Status(http.StatusOK)
 
-func (a *API) DeletePVCHandler() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		err := a.DeletePVC(c.Param("name"))
-		if IsNotFound(err) {
-			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
-			return
+	enc := json.NewEncoder(c.Writer)
+	for _, pvc := range a.PVCStore.GetPVCs() {
+		if !a.matchesSelector(pvc.ObjectMeta) {
+			continue
 		}
+
+		vol, err := a.volumeInfo(pvc)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			// the status is sent, end the stream early
+			a.logger(requestContext(c)).Error("streamPVCList got error invoking volumeInfo", zap.String("name", pvc.Name), zap.Error(err))
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"status": true})
+		vol, ok := opts.apply(vol)
+		if !ok {
+			continue
+		}
+
+		var line interface{} = vol
+		if view == ViewSummary {
+			line = NewVolumeBrief(&vol)
+		}
+
+		if err := writeNDJSONLine(enc, line, fields); err != nil {
+			a.logger(requestContext(c)).Error("streamPVCList got error writing", zap.String("name", pvc.Name), zap.Error(err))
+			return
+		}
+		c.Writer.Flush()
 	}
 }
 
-func (a *API) DeletePVC(name string) error {
-	ctx := context.Background()
+// listWorkers bounds the goroutines building VolumeInfo in
+// GetPVCList, volume stats lookups may wait on a kubelet.
+const listWorkers = 16
 
-	pvcClient := a.Cs.CoreV1().PersistentVolumeClaims(a.PVCNamespace)
+// volumeListCache holds the last GetPVCList result until
+// a store event invalidates it. Query filters are applied to
+// the cached list so only the unfiltered list is kept.
+type volumeListCache struct {
+	vols       []VolumeInfo
+	valid      bool
+	generation uint64
+	computedAt time.Time
 
-	pvc, err := pvcClient.Get(ctx, name, metaV1.GetOptions{})
-	if IsNotFound(err) {
-		return err
+	// epoch keeps ETags from before a restart,
+	// when generation starts over, from matching
+	epoch int64
+	sync.Mutex
+}
+
+func (lc *volumeListCache) invalidate() {
+	lc.Lock()
+	lc.valid = false
+	lc.generation++
+	lc.Unlock()
+}
+
+// watchListCache invalidates the list cache on every pod and PVC
+// store event, pods are included since they change UsedBy.
+func (a *API) watchListCache() {
+	a.listCache.epoch = time.Now().UnixNano()
+
+	invalidatePod := func(v1.Pod) { a.listCache.invalidate() }
+	invalidatePVC := func(v1.PersistentVolumeClaim) { a.listCache.invalidate() }
+
+	a.PodStore.OnAdd(invalidatePod)
+	a.PodStore.OnUpdate(invalidatePod)
+	a.PodStore.OnDelete(invalidatePod)
+	a.PVCStore.OnAdd(invalidatePVC)
+	a.PVCStore.OnUpdate(invalidatePVC)
+	a.PVCStore.OnDelete(invalidatePVC)
+}
+
+// GetPVCList returns the PVCs meeting the selector criteria
+// sorted by namespace then name. The list is computed at most
+// once between store events, and with volume stats enabled at
+// most once per VolumeStatsTTL so usage stays current.
+func (a *API) GetPVCList() ([]VolumeInfo, error) {
+	a.listCache.Lock()
+	generation := a.listCache.generation
+	if a.listCache.valid && (a.VolumeStatsCache == nil || time.Since(a.listCache.computedAt) < a.VolumeStatsCache.TTL) {
+		vols := append(make([]VolumeInfo, 0, len(a.listCache.vols)), a.listCache.vols...)
+		a.listCache.Unlock()
+		return vols, nil
 	}
+	a.listCache.Unlock()
+
+	vols, err := a.buildPVCList()
 	if err != nil {
-		a.Log.Error("GetPVC got error invoking pvcClient.Get", zap.Error(err))
-		return err
+		return vols, err
 	}
 
-	// ensure PVC meets selector criteria
-	for k, v := range a.PVCSelectorMap {
-		if _, ok := pvc.Labels[k]; !ok {
-			return fmt.Errorf("PVC labels does not contain key %s", k)
-		}
+	// a list built while an event arrived may be stale
+	a.listCache.Lock()
+	if a.listCache.generation == generation {
+		a.listCache.vols = vols
+		a.listCache.valid = true
+		a.listCache.computedAt = time.Now()
+	}
+	a.listCache.Unlock()
+
+	return append(make([]VolumeInfo, 0, len(vols)), vols...), nil
+}
 
-		if pvc.Labels[k] != v {
-			return fmt.Errorf("PVC label %s does not contain value %s", k, v)
+// buildPVCList builds the VolumeInfo of each PVC
+// meeting the selector criteria.
+func (a *API) buildPVCList() ([]VolumeInfo, error) {
+	var pvcList []v1.PersistentVolumeClaim
+	for _, pvc := range a.PVCStore.GetPVCs() {
+		// ensure PVC meets selector criteria
+		if a.matchesSelector(pvc.ObjectMeta) {
+			pvcList = append(pvcList, pvc)
 		}
 	}
 
-	err = pvcClient.Delete(ctx, name, metaV1.DeleteOptions{})
-	if err != nil {
-		a.Log.Error("DeletePVC got error invoking pvcClient.Delete", zap.Error(err))
-		return err
+	return a.volumeInfos(pvcList, listWorkers)
+}
+
+// volumeInfos builds the VolumeInfo of each PVC on up to
+// workers goroutines, keeping the order of pvcList.
+func (a *API) volumeInfos(pvcList []v1.PersistentVolumeClaim, workers int) ([]VolumeInfo, error) {
+	// each worker fills its own indexes so the
+	// sorted order of the store is kept
+	vols := make([]VolumeInfo, len(pvcList))
+	errs := make([]error, len(pvcList))
+	idx := make(chan int)
+
+	if len(pvcList) < workers {
+		workers = len(pvcList)
 	}
 
-	return nil
+	wg := sync.WaitGroup{}
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range idx {
+				vols[i], errs[i] = a.volumeInfo(pvcList[i])
+			}
+		}()
+	}
+
+	for i := range pvcList {
+		idx <- i
+	}
+	close(idx)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return make([]VolumeInfo, 0), err
+		}
+	}
+
+	return vols, nil
 }
 
-func (a *API) GetPodsInfoByPVC(pods []v1.Pod, pvcName string) ([]PodInfo, error) {
-	var podInfoList []PodInfo
+func (a *API) GetPVCHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !a.requireSynced(c) {
+			return
+		}
 
-	for _, pod := range pods {
-		for _, v := range pod.Spec.Volumes {
-			if v.PersistentVolumeClaim != nil && v.PersistentVolumeClaim.ClaimName == pvcName {
-				var terminating bool
-				var terminatingSince *metaV1.Time
-
-				if pod.DeletionTimestamp != nil {
-					terminating = true
-					terminatingSince = pod.DeletionTimestamp
-				}
-
-				podInfoList = append(podInfoList, PodInfo{
-					Name:             pod.Name,
-					Labels:           pod.Labels,
-					Annotations:      pod.Annotations,
-					Phase:            pod.Status.Phase,
-					StartTime:        pod.Status.StartTime,
-					Terminating:      terminating,
-					TerminatingSince: terminatingSince,
-				})
+		// live events and kubelet stats change between
+		// store events, so those responses are not tagged
+		etag := ""
+		if c.Query("events") != "true" && a.VolumeStatsCache == nil {
+			etag = a.listETag(c)
+			if notModified(c, etag) {
+				return
 			}
 		}
-	}
 
-	return podInfoList, nil
+		pvc, err := a.GetPVC(c.Param("name"))
+		if err != nil {
+			WriteError(c, err)
+			return
+		}
+
+		if etag != "" {
+			setETag(c, etag)
+		}
+
+		if c.Query("activeOnly") == "true" {
+			pvc.UsedBy = activePods(pvc.UsedBy)
+		}
+
+		// events need a live API call so are opt-in
+		if c.Query("events") == "true" {
+			pvc.Events, err = a.GetPVCEvents(requestContext(c), pvc.Name)
+			if err != nil {
+				WriteError(c, err)
+				return
+			}
+		}
+
+		writeVolumes(c, pvc, []VolumeInfo{pvc})
+	}
+}
+
+func (a *API) GetPVCPodsHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !a.requireSynced(c) {
+			return
+		}
+
+		pods, err := a.GetPVCPods(c.Param("name"))
+		if err != nil {
+			WriteError(c, err)
+			return
+		}
+
+		if c.Query("activeOnly") == "true" {
+			pods = activePods(pods)
+		}
+
+		c.JSON(http.StatusOK, pods)
+	}
+}
+
+// GetPVCPods returns the pods referencing a PVC
+// meeting the selector criteria.
+func (a *API) GetPVCPods(name string) ([]PodInfo, error) {
+	vol, err := a.GetPVC(name)
+	if err != nil {
+		return make([]PodInfo, 0), err
+	}
+
+	if vol.UsedBy == nil {
+		return make([]PodInfo, 0), nil
+	}
+
+	return vol.UsedBy, nil
+}
+
+func (a *API) GetPVC(name string) (VolumeInfo, error) {
+	volInfo := VolumeInfo{}
+
+	pvc := a.PVCStore.GetPVC(name)
+	if pvc == nil {
+		return volInfo, errPVCNotFound(name)
+	}
+
+	// ensure PVC meets selector criteria
+	if err := a.checkSelector(pvc.ObjectMeta); err != nil {
+		return volInfo, err
+	}
+
+	return a.volumeInfo(*pvc)
+}
+
+func (a *API) GetPVCByUIDHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !a.requireSynced(c) {
+			return
+		}
+
+		pvc, err := a.GetPVCByUID(types.UID(c.Param("uid")))
+		if err != nil {
+			WriteError(c, err)
+			return
+		}
+
+		if c.Query("activeOnly") == "true" {
+			pvc.UsedBy = activePods(pvc.UsedBy)
+		}
+
+		writeVolumes(c, pvc, []VolumeInfo{pvc})
+	}
+}
+
+// GetPVCByUID returns the PVC with the UID, so a PVC recreated
+// under the same name is never mistaken for the one looked up.
+func (a *API) GetPVCByUID(uid types.UID) (VolumeInfo, error) {
+	volInfo := VolumeInfo{}
+
+	pvc := a.PVCStore.GetPVCByUID(uid)
+	if pvc == nil {
+		return volInfo, NewAPIError(http.StatusNotFound, CodePVCNotFound, fmt.Sprintf("PVC with uid %s not found", uid))
+	}
+
+	// ensure PVC meets selector criteria
+	if err := a.checkSelector(pvc.ObjectMeta); err != nil {
+		return volInfo, err
+	}
+
+	return a.volumeInfo(*pvc)
+}
+
+// parseSelector parses comma separated key=value pairs
+func parseSelector(selector string) (map[string]string, error) {
+	selectorMap := map[string]string{}
+	if selector == "" {
+		return selectorMap, nil
+	}
+
+	for _, kv := range strings.Split(selector, ",") {
+		kv := strings.Split(kv, "=")
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("%q, expected key=value pairs", selector)
+		}
+
+		selectorMap[kv[0]] = kv[1]
+	}
+
+	return selectorMap, nil
+}
+
+// matchesSelector returns true if the labels contain every key
+// and value of the PVC selector and the annotations every key
+// and value of the annotation selector.
+func (a *API) matchesSelector(meta metaV1.ObjectMeta) bool {
+	return selectorMatches(a.PVCSelectorMap, meta.Labels) && selectorMatches(a.AnnotationMap, meta.Annotations)
+}
+
+// checkSelector returns the same pvc_not_found error as a missing
+// PVC when the PVC does not meet the selector criteria, so the
+// existence of PVCs outside the selector is not revealed.
+func (a *API) checkSelector(meta metaV1.ObjectMeta) error {
+	if !a.matchesSelector(meta) {
+		return errPVCNotFound(meta.Name)
+	}
+
+	return nil
+}
+
+// selectorMatches returns true if values contains
+// every key and value of selector.
+func selectorMatches(selector map[string]string, values map[string]string) bool {
+	for k, v := range selector {
+		if sv, ok := values[k]; !ok || sv != v {
+			return false
+		}
+	}
+
+	return true
+}
+
+// NewVolumeInfo maps a PVC and the pods referencing it to a
+// VolumeInfo, the PVC is in use when any of the pods is Active.
+func NewVolumeInfo(pvc v1.PersistentVolumeClaim, pods []PodInfo) VolumeInfo {
+	inUse := false
+	for _, p := range pods {
+		inUse = inUse || p.Active
+	}
+
+	creationTimestamp := pvc.CreationTimestamp
+
+	volInfo := VolumeInfo{
+		Name:              pvc.Name,
+		Namespace:         pvc.Namespace,
+		UID:               pvc.UID,
+		ResourceVersion:   pvc.ResourceVersion,
+		Labels:            pvc.Labels,
+		Annotations:       pvc.Annotations,
+		CreationTimestamp: &creationTimestamp,
+		Status:            pvc.Status,
+		Spec:              pvc.Spec,
+		Phase:             string(pvc.Status.Phase),
+		AccessModes:       make([]string, 0, len(pvc.Spec.AccessModes)),
+		VolumeMode:        string(v1.PersistentVolumeFilesystem),
+		UsedBy:            pods,
+		ManagedBy:         statefulSetOwner(pvc.Name, pods),
+		InUse:             inUse,
+	}
+
+	if pvc.Spec.StorageClassName != nil {
+		volInfo.StorageClass = *pvc.Spec.StorageClassName
+	}
+
+	if q, ok := pvc.Spec.Resources.Requests[v1.ResourceStorage]; ok {
+		volInfo.RequestedBytes = q.Value()
+	}
+
+	if q, ok := pvc.Status.Capacity[v1.ResourceStorage]; ok {
+		volInfo.ProvisionedBytes = q.Value()
+	}
+
+	for _, m := range pvc.Spec.AccessModes {
+		volInfo.AccessModes = append(volInfo.AccessModes, string(m))
+	}
+
+	// Kubernetes treats a nil volumeMode as Filesystem
+	if pvc.Spec.VolumeMode != nil {
+		volInfo.VolumeMode = string(*pvc.Spec.VolumeMode)
+	}
+
+	// See https://github.com/kubernetes/kubernetes/issues/22839
+	// on terminating status
+	if pvc.DeletionTimestamp != nil {
+		volInfo.Terminating = true
+		volInfo.TerminatingSince = pvc.DeletionTimestamp
+	}
+
+	if !inUse {
+		volInfo.UnusedSince = unusedSince(pvc)
+	}
+
+	if pvcPending(pvc) {
+		volInfo.PendingSince = &pvc.CreationTimestamp
+	}
+
+	return volInfo
+}
+
+// volumeInfo resolves the pods referencing a PVC and maps
+// them to a VolumeInfo along with any kubelet volume stats.
+func (a *API) volumeInfo(pvc v1.PersistentVolumeClaim) (VolumeInfo, error) {
+	now := time.Now()
+
+	podList := a.PodStore.PodsForPVC(pvc.Name)
+	for i := range podList {
+		podList[i].Owner = a.resolveOwner(podList[i].Owner)
+		podList[i].Active = podActive(podList[i], now)
+	}
+
+	volInfo := NewVolumeInfo(pvc, podList)
+
+	if volInfo.PendingSince != nil {
+		volInfo.PendingReason = a.pendingReason(pvc.UID)
+	}
+
+	a.setBoundVolume(&volInfo, pvc)
+
+	// kubelets only report stats for mounted volumes
+	if a.VolumeStatsCache != nil && len(podList) > 0 {
+		nodeNames := make([]string, 0, len(podList))
+		for _, p := range podList {
+			nodeNames = append(nodeNames, p.NodeName)
+		}
+
+		if stats := a.VolumeStatsCache.GetVolumeStats(pvc.Name, nodeNames); stats != nil {
+			volInfo.CapacityBytes = &stats.CapacityBytes
+			volInfo.UsedBytes = &stats.UsedBytes
+			volInfo.Usage = stats
+		}
+	}
+
+	return volInfo, nil
+}
+
+// volumeNodes returns the nodes running pods that
+// reference a PVC meeting the selector criteria.
+func (a *API) volumeNodes() []string {
+	var nodeNames []string
+	for _, pvc := range a.PVCStore.GetPVCs() {
+		if !a.matchesSelector(pvc.ObjectMeta) {
+			continue
+		}
+
+		for _, p := range a.PodStore.PodsForPVC(pvc.Name) {
+			nodeNames = append(nodeNames, p.NodeName)
+		}
+	}
+
+	return nodeNames
+}
+
+// podActive returns false for pods that have completed and
+// for pods still terminating after their grace period.
+func podActive(p PodInfo, now time.Time) bool {
+	if p.Phase == v1.PodSucceeded || p.Phase == v1.PodFailed {
+		return false
+	}
+
+	// the API server sets the deletion timestamp to the
+	// end of the pod's grace period
+	if p.Terminating && p.TerminatingSince != nil && now.After(p.TerminatingSince.Time) {
+		return false
+	}
+
+	return true
+}
+
+// activePods returns the Active pods
+func activePods(pods []PodInfo) []PodInfo {
+	active := make([]PodInfo, 0, len(pods))
+	for _, p := range pods {
+		if p.Active {
+			active = append(active, p)
+		}
+	}
+
+	return active
+}
+
+// pvcInUse returns true if an active pod references the PVC
+func (a *API) pvcInUse(name string) bool {
+	now := time.Now()
+	for _, p := range a.PodStore.PodsForPVC(name) {
+		if podActive(p, now) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// DeletePreview describes the PVC removed, or in a dry run
+// that would be removed, by DeletePVC. Dry runs are sent to
+// the API server so validation and admission still apply. InUse is true when
+// active pods reference the PVC, in which case
+// the delete will leave the PVC terminating until they exit.
+type DeletePreview struct {
+	DryRun  bool       `json:"dryRun"`
+	InUse   bool       `json:"inUse"`
+	Volume  VolumeInfo `json:"volume"`
+	Reclaim *PVReclaim `json:"reclaim,omitempty"`
+}
+
+// DeletePVCOptions configures DeletePVC
+type DeletePVCOptions struct {
+	// DryRun runs the checks, including a server side dry
+	// run of the delete, without deleting the PVC.
+	DryRun bool
+
+	// Force deletes the PVC even when running or
+	// pending pods reference it.
+	Force bool
+
+	// RemoveFinalizers clears metadata.finalizers after the
+	// delete so PVCs stuck terminating are removed.
+	RemoveFinalizers bool
+
+	// Caller identifies who requested the delete in
+	// the audit log.
+	Caller string
+
+	// Reason, when set, explains the delete in the
+	// Event recorded on the PVC.
+	Reason string
+
+	// GracePeriodSeconds and PropagationPolicy are passed
+	// to the API server when set.
+	GracePeriodSeconds *int64
+	PropagationPolicy  *metaV1.DeletionPropagation
+
+	// UID and ResourceVersion, when set, must match the PVC
+	// so a delete aimed at a PVC that was since changed or
+	// recreated under the same name fails with a 409.
+	UID             types.UID
+	ResourceVersion string
+
+	// ReclaimPV deletes the PV bound to the PVC after the
+	// delete when its reclaim policy is Retain, so it does
+	// not linger Released.
+	ReclaimPV bool
+}
+
+// DeletePVCOptionsFromQuery parses DeletePVCOptions from the
+// query parameters and If-Match header of a delete request.
+func DeletePVCOptionsFromQuery(c *gin.Context) (DeletePVCOptions, error) {
+	opts := DeletePVCOptions{
+		DryRun:           c.Query("dryRun") == "true",
+		Force:            c.Query("force") == "true",
+		RemoveFinalizers: c.Query("removeFinalizers") == "true",
+		ReclaimPV:        c.Query("reclaimPv") == "true",
+		Caller:           Caller(c),
+		UID:              types.UID(c.Query("uid")),
+		ResourceVersion:  c.Query("resourceVersion"),
+	}
+
+	if v := c.Query("gracePeriodSeconds"); v != "" {
+		seconds, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || seconds < 0 {
+			return opts, errBadRequest("gracePeriodSeconds must be a non-negative integer")
+		}
+		opts.GracePeriodSeconds = &seconds
+	}
+
+	if v := c.Query("propagationPolicy"); v != "" {
+		policy := metaV1.DeletionPropagation(v)
+		switch policy {
+		case metaV1.DeletePropagationOrphan, metaV1.DeletePropagationBackground, metaV1.DeletePropagationForeground:
+		default:
+			return opts, errBadRequest("propagationPolicy must be Orphan, Background or Foreground")
+		}
+		opts.PropagationPolicy = &policy
+	}
+
+	// If-Match carries the resourceVersion returned by a get
+	if v := strings.Trim(c.GetHeader("If-Match"), `"`); v != "" && opts.ResourceVersion == "" {
+		opts.ResourceVersion = v
+	}
+
+	return opts, nil
+}
+
+func (a *API) DeletePVCHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		opts, err := DeletePVCOptionsFromQuery(c)
+		if err != nil {
+			WriteError(c, err)
+			return
+		}
+
+		// removing finalizers bypasses the pvc-protection
+		// controller so it must be confirmed by name
+		if opts.RemoveFinalizers && c.Query("confirm") != c.Param("name") {
+			WriteError(c, errBadRequest("removeFinalizers requires confirm=%s", c.Param("name")))
+			return
+		}
+
+		preview, err := a.DeletePVC(requestContext(c), c.Param("name"), opts)
+		if err != nil {
+			WriteError(c, err)
+			return
+		}
+
+		if opts.DryRun || opts.RemoveFinalizers || opts.ReclaimPV {
+			c.JSON(http.StatusOK, preview)
+			return
+		}
+
+		c.JSON(http.StatusOK, StatusResponse{Status: true})
+	}
+}
+
+// DeletePVC deletes a PVC meeting the selector criteria. PVCs
+// referenced by active pods are not deleted unless
+// forced, since the delete would leave them terminating.
+func (a *API) DeletePVC(ctx context.Context, name string, opts DeletePVCOptions) (preview DeletePreview, err error) {
+	ctx, cancel := a.kubeContext(ctx)
+	defer cancel()
+	preview = DeletePreview{DryRun: opts.DryRun}
+
+	if opts.Caller == "" {
+		opts.Caller = CallerFromContext(ctx)
+	}
+
+	start := time.Now()
+	selectorMatch := false
+	defer func() {
+		pvcDeletes.WithLabelValues(deleteResult(err)).Inc()
+		a.audit(ctx, "delete", name, opts.Caller, start, err,
+			zap.Bool("selector_match", selectorMatch),
+			zap.Bool("dry_run", opts.DryRun),
+			zap.Bool("force", opts.Force),
+			zap.Bool("remove_finalizers", opts.RemoveFinalizers),
+			zap.Bool("reclaim_pv", opts.ReclaimPV),
+		)
+	}()
+
+	if a.ReadOnly {
+		return preview, errReadOnly()
+	}
+
+	pvcClient := a.Cs.CoreV1().PersistentVolumeClaims(a.PVCNamespace)
+
+	var pvc *v1.PersistentVolumeClaim
+	err = a.retryDelete(func() (err error) {
+		pvc, err = pvcClient.Get(ctx, name, metaV1.GetOptions{})
+		return err
+	})
+	if IsNotFound(err) {
+		return preview, errPVCNotFound(name)
+	}
+	if err != nil {
+		a.logger(ctx).Error("GetPVC got error invoking pvcClient.Get", zap.Error(err))
+		return preview, err
+	}
+
+	// ensure PVC meets selector criteria
+	if err = a.checkSelector(pvc.ObjectMeta); err != nil {
+		return preview, err
+	}
+	selectorMatch = true
+
+	if !a.namespaceDeletable(pvc.Namespace) {
+		apiErr := NewAPIError(http.StatusForbidden, CodeForbidden, fmt.Sprintf("deletes are not allowed in namespace %s", pvc.Namespace))
+		apiErr.Details = map[string]interface{}{"namespace": pvc.Namespace}
+		return preview, apiErr
+	}
+
+	// checked against the live object so a protection
+	// added just before the delete is honored
+	if pvc.Annotations[ProtectedAnnotation] == "true" {
+		return preview, NewAPIError(http.StatusForbidden, CodePVCProtected, "PVC is protected")
+	}
+
+	preview.Volume, err = a.volumeInfo(*pvc)
+	if err != nil {
+		return preview, err
+	}
+
+	preview.InUse = preview.Volume.InUse
+
+	var inUseBy []string
+	for _, pod := range preview.Volume.UsedBy {
+		if pod.Active {
+			inUseBy = append(inUseBy, pod.Name)
+		}
+	}
+
+	deleteOptions := metaV1.DeleteOptions{
+		GracePeriodSeconds: opts.GracePeriodSeconds,
+		PropagationPolicy:  opts.PropagationPolicy,
+	}
+
+	// checked here for a clear error and sent to the API
+	// server so a change after the Get is caught as well
+	if opts.UID != "" || opts.ResourceVersion != "" {
+		if err = checkPreconditions(pvc, opts); err != nil {
+			return preview, err
+		}
+
+		deleteOptions.Preconditions = &metaV1.Preconditions{}
+		if opts.UID != "" {
+			deleteOptions.Preconditions.UID = &opts.UID
+		}
+		if opts.ResourceVersion != "" {
+			deleteOptions.Preconditions.ResourceVersion = &opts.ResourceVersion
+		}
+	}
+
+	if opts.DryRun {
+		// the API server runs validation and admission
+		// without persisting the delete
+		deleteOptions.DryRun = []string{metaV1.DryRunAll}
+	} else if preview.InUse && !opts.Force {
+		apiErr := NewAPIError(http.StatusConflict, CodePVCInUse,
+			fmt.Sprintf("PVC is in use by pods %s, use force to delete anyway", strings.Join(inUseBy, ", ")))
+		apiErr.Details = map[string]interface{}{"usedBy": inUseBy}
+		return preview, apiErr
+	}
+
+	if !opts.DryRun {
+		message := "Deleted by volm on behalf of " + opts.Caller
+		if opts.Reason != "" {
+			message += ": " + opts.Reason
+		}
+		a.recordEvent(pvc, "DeletedByVolm", "%s", message)
+	}
+
+	deleteFn := func() error {
+		return pvcClient.Delete(ctx, name, deleteOptions)
+	}
+
+	// a failed precondition conflicts on every retry
+	if deleteOptions.Preconditions != nil {
+		err = deleteFn()
+	} else {
+		err = a.retryDelete(deleteFn)
+	}
+	if err != nil {
+		a.logger(ctx).Error("DeletePVC got error invoking pvcClient.Delete", zap.Error(err))
+		return preview, err
+	}
+
+	if !opts.DryRun && a.Notifier != nil {
+		a.Notifier.Notify(NotifyDeleted, *pvc)
+	}
+
+	if opts.ReclaimPV {
+		preview.Reclaim = a.reclaimPV(ctx, pvc, opts.DryRun)
+	}
+
+	if opts.RemoveFinalizers && !opts.DryRun {
+		a.logger(ctx).Warn("Removing PVC finalizers",
+			zap.String("type", "remove_finalizers"),
+			zap.String("name", name),
+			zap.String("namespace", pvc.Namespace),
+			zap.Strings("finalizers", pvc.Finalizers),
+			zap.String("caller", opts.Caller),
+		)
+
+		patched, err := pvcClient.Patch(ctx, name, types.MergePatchType, []byte(`{"metadata":{"finalizers":null}}`), metaV1.PatchOptions{})
+		if IsNotFound(err) {
+			// the delete completed before the patch
+			return preview, nil
+		}
+		if err != nil {
+			a.logger(ctx).Error("DeletePVC got error invoking pvcClient.Patch", zap.Error(err))
+			return preview, err
+		}
+
+		preview.Volume, err = a.volumeInfo(*patched)
+		if err != nil {
+			return preview, err
+		}
+	}
+
+	return preview, nil
+}
+
+// checkPreconditions returns a 409 if the PVC does not
+// match the UID or ResourceVersion in opts.
+func checkPreconditions(pvc *v1.PersistentVolumeClaim, opts DeletePVCOptions) error {
+	if opts.UID != "" && opts.UID != pvc.UID {
+		apiErr := NewAPIError(http.StatusConflict, CodePreconditionFailed, "PVC uid does not match, it was recreated")
+		apiErr.Details = map[string]interface{}{"uid": pvc.UID}
+		return apiErr
+	}
+
+	if opts.ResourceVersion != "" && opts.ResourceVersion != pvc.ResourceVersion {
+		apiErr := NewAPIError(http.StatusConflict, CodePreconditionFailed, "PVC resourceVersion does not match, it was modified")
+		apiErr.Details = map[string]interface{}{"resourceVersion": pvc.ResourceVersion}
+		return apiErr
+	}
+
+	return nil
+}
+
+// namespaceDeletable returns true if DeletableNamespaces
+// is empty or contains the namespace.
+func (a *API) namespaceDeletable(namespace string) bool {
+	if len(a.DeletableNamespaces) == 0 {
+		return true
+	}
+
+	for _, ns := range a.DeletableNamespaces {
+		if ns == namespace {
+			return true
+		}
+	}
+
+	return false
+}
+
+// MetadataPatch describes label and annotation changes
+// applied to a PVC by PatchPVCMetadata.
+type MetadataPatch struct {
+	Labels            map[string]string `json:"labels,omitempty"`
+	Annotations       map[string]string `json:"annotations,omitempty"`
+	RemoveLabels      []string          `json:"removeLabels,omitempty"`
+	RemoveAnnotations []string          `json:"removeAnnotations,omitempty"`
+}
+
+func (a *API) PatchPVCMetadataHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		patch := MetadataPatch{}
+		if err := c.ShouldBindJSON(&patch); err != nil {
+			WriteError(c, errBadRequest(err.Error()))
+			return
+		}
+
+		// protection is only changed through the protect routes
+		_, setsProtection := patch.Annotations[ProtectedAnnotation]
+		for _, k := range patch.RemoveAnnotations {
+			if k == ProtectedAnnotation {
+				setsProtection = true
+			}
+		}
+		if setsProtection {
+			WriteError(c, errBadRequest("use the protect route to change %s", ProtectedAnnotation))
+			return
+		}
+
+		volInfo, err := a.PatchPVCMetadata(requestContext(c), c.Param("name"), patch)
+		if err != nil {
+			WriteError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, volInfo)
+	}
+}
+
+// PatchPVCMetadata applies a JSON merge patch of labels and
+// annotations to a PVC. Patches that would remove or change a
+// label required by the PVC selector are rejected, since the
+// PVC would no longer be visible through the API.
+func (a *API) PatchPVCMetadata(ctx context.Context, name string, patch MetadataPatch) (volInfo VolumeInfo, err error) {
+	ctx, cancel := a.kubeContext(ctx)
+	defer cancel()
+
+	start := time.Now()
+	defer func() {
+		a.audit(ctx, "patch_metadata", name, CallerFromContext(ctx), start, err)
+	}()
+
+	if a.ReadOnly {
+		return VolumeInfo{}, errReadOnly()
+	}
+
+	pvcClient := a.Cs.CoreV1().PersistentVolumeClaims(a.PVCNamespace)
+
+	pvc, err := pvcClient.Get(ctx, name, metaV1.GetOptions{})
+	if IsNotFound(err) {
+		return VolumeInfo{}, errPVCNotFound(name)
+	}
+	if err != nil {
+		a.logger(ctx).Error("PatchPVCMetadata got error invoking pvcClient.Get", zap.Error(err))
+		return VolumeInfo{}, err
+	}
+
+	// ensure PVC meets selector criteria
+	if err := a.checkSelector(pvc.ObjectMeta); err != nil {
+		return VolumeInfo{}, err
+	}
+
+	// ensure PVC still meets selector criteria after the patch
+	for _, k := range patch.RemoveLabels {
+		if _, ok := a.PVCSelectorMap[k]; ok {
+			return VolumeInfo{}, errBadRequest("label %s is required by the PVC selector", k)
+		}
+	}
+
+	for k, v := range patch.Labels {
+		if sv, ok := a.PVCSelectorMap[k]; ok && sv != v {
+			return VolumeInfo{}, errBadRequest("label %s must have value %s to match the PVC selector", k, sv)
+		}
+	}
+
+	for _, k := range patch.RemoveAnnotations {
+		if _, ok := a.AnnotationMap[k]; ok {
+			return VolumeInfo{}, errBadRequest("annotation %s is required by the PVC annotation selector", k)
+		}
+	}
+
+	for k, v := range patch.Annotations {
+		if sv, ok := a.AnnotationMap[k]; ok && sv != v {
+			return VolumeInfo{}, errBadRequest("annotation %s must have value %s to match the PVC annotation selector", k, sv)
+		}
+	}
+
+	// a null value in a JSON merge patch removes the key
+	labels := map[string]interface{}{}
+	for k, v := range patch.Labels {
+		labels[k] = v
+	}
+	for _, k := range patch.RemoveLabels {
+		labels[k] = nil
+	}
+
+	annotations := map[string]interface{}{}
+	for k, v := range patch.Annotations {
+		annotations[k] = v
+	}
+	for _, k := range patch.RemoveAnnotations {
+		annotations[k] = nil
+	}
+
+	patchBytes, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels":      labels,
+			"annotations": annotations,
+		},
+	})
+	if err != nil {
+		return VolumeInfo{}, err
+	}
+
+	pvc, err = pvcClient.Patch(ctx, name, types.MergePatchType, patchBytes, metaV1.PatchOptions{})
+	if err != nil {
+		a.logger(ctx).Error("PatchPVCMetadata got error invoking pvcClient.Patch", zap.Error(err))
+		return VolumeInfo{}, err
+	}
+
+	return a.volumeInfo(*pvc)
+}
+
+func (a *API) GetPodsInfoByPVC(pods []v1.Pod, pvcName string) ([]PodInfo, error) {
+	var podInfoList []PodInfo
+
+	for _, pod := range pods {
+		for _, v := range pod.Spec.Volumes {
+			if v.PersistentVolumeClaim != nil && v.PersistentVolumeClaim.ClaimName == pvcName {
+				podInfoList = append(podInfoList, podInfo(pod, v.Name))
+			}
+		}
+	}
+
+	return podInfoList, nil
+}
+
+// podInfo maps a pod referencing a PVC through the named
+// volume to a PodInfo.
+func podInfo(pod v1.Pod, volumeName string) PodInfo {
+	var terminating bool
+	var terminatingSince *metaV1.Time
+
+	if pod.DeletionTimestamp != nil {
+		terminating = true
+		terminatingSince = pod.DeletionTimestamp
+	}
+
+	// collect the paths each container, init containers
+	// included, mounts the claim's volume at, or attaches
+	// it at when it is a raw block volume
+	containers := append(append([]v1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...)
+
+	mountPaths := make([]string, 0)
+	var devicePaths []string
+	for _, c := range containers {
+		for _, vm := range c.VolumeMounts {
+			if vm.Name == volumeName {
+				mountPaths = append(mountPaths, vm.MountPath)
+			}
+		}
+
+		for _, vd := range c.VolumeDevices {
+			if vd.Name == volumeName {
+				devicePaths = append(devicePaths, vd.DevicePath)
+			}
+		}
+	}
+
+	return PodInfo{
+		Name:             pod.Name,
+		Namespace:        pod.Namespace,
+		Labels:           pod.Labels,
+		Annotations:      pod.Annotations,
+		Phase:            pod.Status.Phase,
+		NodeName:         pod.Spec.NodeName,
+		MountPaths:       mountPaths,
+		DevicePaths:      devicePaths,
+		StartTime:        pod.Status.StartTime,
+		Owner:            podOwner(pod),
+		Terminating:      terminating,
+		TerminatingSince: terminatingSince,
+	}
 }
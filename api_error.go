@@ -0,0 +1,132 @@
+package volm
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Error codes returned in APIError.Code
+const (
+	CodeBadRequest         = "bad_request"
+	CodeUnauthorized       = "unauthorized"
+	CodeForbidden          = "forbidden"
+	CodeReadOnly           = "read_only"
+	CodePVCNotFound        = "pvc_not_found"
+	CodeNotFound           = "not_found"
+	CodePVCProtected       = "pvc_protected"
+	CodePVCInUse           = "pvc_in_use"
+	CodeConflict           = "conflict"
+	CodeTooManyRequests    = "too_many_requests"
+	CodeTokenExpired       = "token_expired"
+	CodePreconditionFailed = "precondition_failed"
+	CodeNotImplemented     = "not_implemented"
+	CodeNotReady           = "not_ready"
+	CodeUnhealthy          = "unhealthy"
+	CodeUpstreamError      = "upstream_error"
+	CodeInternalError      = "internal_error"
+)
+
+// APIError is the body of every error response, Code is a
+// stable machine readable identifier for the error. RetryAfter,
+// when set, is sent in seconds in the Retry-After header.
+type APIError struct {
+	Status     int                    `json:"-"`
+	RetryAfter int                    `json:"-"`
+	Code       string                 `json:"code"`
+	Message    string                 `json:"message"`
+	Details    map[string]interface{} `json:"details,omitempty"`
+
+	// RequestID is set by WriteError so users can
+	// quote it when reporting a failed request
+	RequestID string `json:"requestId,omitempty"`
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+// NewAPIError constructs an APIError
+func NewAPIError(status int, code string, message string) *APIError {
+	return &APIError{Status: status, Code: code, Message: message}
+}
+
+// ToAPIError maps an error returned by the API methods or the
+// Kubernetes client to an APIError.
+func ToAPIError(err error) *APIError {
+	if apiErr, ok := err.(*APIError); ok {
+		return apiErr
+	}
+
+	statusErr, ok := err.(errors.APIStatus)
+	if !ok {
+		return NewAPIError(http.StatusInternalServerError, CodeInternalError, err.Error())
+	}
+
+	status := statusErr.Status()
+
+	switch status.Reason {
+	case metaV1.StatusReasonNotFound:
+		if status.Details != nil && status.Details.Kind == "persistentvolumeclaims" {
+			return NewAPIError(http.StatusNotFound, CodePVCNotFound, err.Error())
+		}
+		return NewAPIError(http.StatusNotFound, CodeNotFound, err.Error())
+	case metaV1.StatusReasonBadRequest, metaV1.StatusReasonInvalid:
+		return NewAPIError(http.StatusBadRequest, CodeBadRequest, err.Error())
+	case metaV1.StatusReasonForbidden:
+		return NewAPIError(http.StatusForbidden, CodeForbidden, err.Error())
+	case metaV1.StatusReasonConflict, metaV1.StatusReasonAlreadyExists:
+		return NewAPIError(http.StatusConflict, CodeConflict, err.Error())
+	case metaV1.StatusReasonTooManyRequests:
+		// the API server is throttling, pass on its suggested delay
+		apiErr := NewAPIError(http.StatusTooManyRequests, CodeTooManyRequests, err.Error())
+		if seconds, ok := errors.SuggestsClientDelay(err); ok {
+			apiErr.RetryAfter = seconds
+		}
+		return apiErr
+	}
+
+	code := int(status.Code)
+	if code < http.StatusBadRequest {
+		code = http.StatusInternalServerError
+	}
+
+	return NewAPIError(code, CodeUpstreamError, err.Error())
+}
+
+// WriteError writes err as an APIError response
+// with the matching HTTP status.
+func WriteError(c *gin.Context, err error) {
+	// copied so errors shared between requests are not modified
+	apiErr := *ToAPIError(err)
+	apiErr.RequestID = RequestID(c)
+
+	if apiErr.RetryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(apiErr.RetryAfter))
+	}
+	c.AbortWithStatusJSON(apiErr.Status, apiErr)
+}
+
+func errBadRequest(format string, a ...interface{}) error {
+	return NewAPIError(http.StatusBadRequest, CodeBadRequest, fmt.Sprintf(format, a...))
+}
+
+func errPVCNotFound(name string) error {
+	return NewAPIError(http.StatusNotFound, CodePVCNotFound, fmt.Sprintf("PVC %s not found", name))
+}
+
+// errReadOnly is returned by operations that would modify
+// a PVC when the API is configured as read-only.
+func errReadOnly() error {
+	return NewAPIError(http.StatusMethodNotAllowed, CodeReadOnly, "volm is running in read-only mode and does not modify PVCs")
+}
+
+// errNotReady is returned while the informer caches have
+// not synced, so empty results are not mistaken for no PVCs.
+func errNotReady() error {
+	return NewAPIError(http.StatusServiceUnavailable, CodeNotReady, "volm is waiting for the PVC and pod caches to sync")
+}
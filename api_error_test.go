@@ -0,0 +1,75 @@
+package volm
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestWriteError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	pvcs := schema.GroupResource{Resource: "persistentvolumeclaims"}
+	pvs := schema.GroupResource{Resource: "persistentvolumes"}
+
+	for _, tc := range []struct {
+		name       string
+		err        error
+		status     int
+		code       string
+		retryAfter string
+	}{
+		{name: "PVC not found", err: errPVCNotFound("data"), status: http.StatusNotFound, code: CodePVCNotFound},
+		{name: "Kubernetes PVC not found", err: errors.NewNotFound(pvcs, "data"), status: http.StatusNotFound, code: CodePVCNotFound},
+		{name: "Kubernetes PV not found", err: errors.NewNotFound(pvs, "pv-1"), status: http.StatusNotFound, code: CodeNotFound},
+		{name: "Kubernetes conflict", err: errors.NewConflict(pvcs, "data", fmt.Errorf("modified")), status: http.StatusConflict, code: CodeConflict},
+		{name: "Kubernetes already exists", err: errors.NewAlreadyExists(pvcs, "data"), status: http.StatusConflict, code: CodeConflict},
+		{name: "bad request", err: errBadRequest("minSize %q is not a quantity", "big"), status: http.StatusBadRequest, code: CodeBadRequest},
+		{name: "Kubernetes invalid", err: errors.NewInvalid(schema.GroupKind{Kind: "PersistentVolumeClaim"}, "data", nil), status: http.StatusBadRequest, code: CodeBadRequest},
+		{name: "snapshots unavailable", err: errSnapshotsUnavailable, status: http.StatusNotImplemented, code: CodeNotImplemented},
+		{name: "read only", err: errReadOnly(), status: http.StatusMethodNotAllowed, code: CodeReadOnly},
+		{name: "Kubernetes throttling", err: errors.NewTooManyRequests("throttled", 5), status: http.StatusTooManyRequests, code: CodeTooManyRequests, retryAfter: "5"},
+		{name: "Kubernetes internal error", err: errors.NewInternalError(fmt.Errorf("etcd unavailable")), status: http.StatusInternalServerError, code: CodeUpstreamError},
+		{name: "other error", err: fmt.Errorf("boom"), status: http.StatusInternalServerError, code: CodeInternalError},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/v1/vol/data", nil)
+			c.Set(RequestIDKey, "req-1")
+
+			WriteError(c, tc.err)
+
+			if w.Code != tc.status {
+				t.Errorf("expected status %d, got %d", tc.status, w.Code)
+			}
+
+			if retryAfter := w.Header().Get("Retry-After"); retryAfter != tc.retryAfter {
+				t.Errorf("expected Retry-After %q, got %q", tc.retryAfter, retryAfter)
+			}
+
+			body := map[string]interface{}{}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("malformed error body %q: %s", w.Body.String(), err)
+			}
+
+			if body["code"] != tc.code || body["message"] != tc.err.Error() || body["requestId"] != "req-1" {
+				t.Errorf("expected code %s, message %q and requestId req-1, got %v", tc.code, tc.err.Error(), body)
+			}
+
+			for field := range body {
+				switch field {
+				case "code", "message", "details", "requestId":
+				default:
+					t.Errorf("unexpected field %s in the error body", field)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,933 @@
+package volm
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	typedCoreV1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	k8sTesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+)
+
+func testPVC(namespace, name string) *v1.PersistentVolumeClaim {
+	return &v1.PersistentVolumeClaim{
+		ObjectMeta: metaV1.ObjectMeta{Namespace: namespace, Name: name, UID: types.UID(namespace + "/" + name)},
+	}
+}
+
+func testPod(namespace, name, claimName string) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metaV1.ObjectMeta{Namespace: namespace, Name: name},
+		Spec: v1.PodSpec{
+			Volumes: []v1.Volume{{
+				Name: "data",
+				VolumeSource: v1.VolumeSource{
+					PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{ClaimName: claimName},
+				},
+			}},
+		},
+	}
+}
+
+func TestNewApiSharedInformerFactory(t *testing.T) {
+	cs := fake.NewSimpleClientset(
+		testPVC("default", "data"),
+		testPVC("other", "data"),
+		testPVC("other", "scratch"),
+		testPod("default", "web", "data"),
+		testPod("other", "web", "data"),
+		testPod("other", "batch", "data"),
+	)
+
+	// an embedder's factory watching all namespaces
+	factory := informers.NewSharedInformerFactory(cs, 0)
+
+	a, err := NewApi(&Config{
+		Cs:                    cs,
+		Log:                   zap.NewNop(),
+		PVCNamespace:          "default",
+		SharedInformerFactory: factory,
+	})
+	if err != nil {
+		t.Fatalf("NewApi: %s", err)
+	}
+	defer close(a.Stopper)
+
+	factory.Start(a.Stopper)
+	if !a.WaitForCacheSync(a.Stopper) {
+		t.Fatal("caches did not sync")
+	}
+
+	pvcs := a.PVCStore.GetPVCs()
+	if len(pvcs) != 1 || pvcs[0].Namespace != "default" {
+		t.Errorf("expected only default/data in the PVC store, got %v", pvcs)
+	}
+
+	if pvc := a.PVCStore.GetPVC("scratch"); pvc != nil {
+		t.Errorf("expected other/scratch to be ignored, got %s/%s", pvc.Namespace, pvc.Name)
+	}
+
+	pods := a.PodStore.PodsForPVC("data")
+	if len(pods) != 1 || pods[0].Namespace != "default" || pods[0].Name != "web" {
+		t.Errorf("expected only default/web to use data, got %v", pods)
+	}
+
+	if a.PVCStore.Resync() != 0 || a.PodStore.Resync() != 0 {
+		t.Error("expected no drift from objects in other namespaces")
+	}
+
+	// volm's own informers are kept off the shared factory
+	var started []reflect.Type
+	for typ := range factory.WaitForCacheSync(a.Stopper) {
+		started = append(started, typ)
+	}
+	if len(started) != 2 {
+		t.Errorf("expected only pod and PVC informers on the shared factory, got %v", started)
+	}
+}
+
+func TestNewApiSharedInformerFactoryNamespace(t *testing.T) {
+	cs := fake.NewSimpleClientset()
+
+	_, err := NewApi(&Config{
+		Cs:                    cs,
+		Log:                   zap.NewNop(),
+		SharedInformerFactory: informers.NewSharedInformerFactory(cs, 0),
+	})
+	if err == nil {
+		t.Error("expected an error without a PVCNamespace")
+	}
+}
+
+// BenchmarkVolumeInfos compares building the VolumeInfo of 5k PVCs,
+// each used by a pod, serially and on the listWorkers pool. Run it
+// with -cpu to see the pool scale with GOMAXPROCS.
+func BenchmarkVolumeInfos(b *testing.B) {
+	a := &API{
+		Config:   &Config{Log: zap.NewNop(), PVCNamespace: "default"},
+		PVCStore: testPVCStore(),
+		PodStore: testPodStore(),
+	}
+
+	for i := 0; i < 5000; i++ {
+		name := fmt.Sprintf("data-%d", i)
+		a.PVCStore.AddPVC(*testPVC("default", name))
+		a.PodStore.AddPod(*testPod("default", "web-"+name, name))
+	}
+	pvcList := a.PVCStore.GetPVCs()
+
+	for _, workers := range []int{1, listWorkers} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := a.volumeInfos(pvcList, workers); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestGetPVCNamespace(t *testing.T) {
+	cs := fake.NewSimpleClientset(testPVC("team-a", "data"), testPod("team-a", "web", "data"))
+	_, r := testAPI(t, &Config{Cs: cs, PVCNamespace: "team-a"})
+
+	w := serve(r, http.MethodGet, "/v1/vol/data", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	vol := VolumeInfo{}
+	if err := json.Unmarshal(w.Body.Bytes(), &vol); err != nil {
+		t.Fatalf("malformed VolumeInfo: %s", err)
+	}
+
+	if vol.Namespace != "team-a" {
+		t.Errorf("expected VolumeInfo namespace team-a, got %q", vol.Namespace)
+	}
+
+	if len(vol.UsedBy) != 1 || vol.UsedBy[0].Namespace != "team-a" {
+		t.Errorf("expected PodInfo namespace team-a, got %v", vol.UsedBy)
+	}
+}
+
+func TestNewVolumeInfoAccessModes(t *testing.T) {
+	block := v1.PersistentVolumeBlock
+	pvc := testPVC("default", "data")
+	pvc.Spec.AccessModes = []v1.PersistentVolumeAccessMode{v1.ReadWriteMany}
+	pvc.Spec.VolumeMode = &block
+
+	vol := NewVolumeInfo(*pvc, nil)
+	if !reflect.DeepEqual(vol.AccessModes, []string{"ReadWriteMany"}) {
+		t.Errorf("expected access modes [ReadWriteMany], got %v", vol.AccessModes)
+	}
+
+	if vol.VolumeMode != "Block" {
+		t.Errorf("expected volume mode Block, got %q", vol.VolumeMode)
+	}
+
+	// the API server defaults an unset volume mode to Filesystem
+	if vol := NewVolumeInfo(*testPVC("default", "data"), nil); vol.VolumeMode != "Filesystem" {
+		t.Errorf("expected volume mode Filesystem when unset, got %q", vol.VolumeMode)
+	}
+}
+
+func TestListPVCNDJSON(t *testing.T) {
+	cs := fake.NewSimpleClientset(
+		testPVC("default", "logs"),
+		testPVC("default", "data"),
+		testPVC("default", "cache"),
+		testPod("default", "web", "data"),
+	)
+	_, r := testAPI(t, &Config{Cs: cs})
+
+	for _, req := range []struct {
+		path   string
+		header http.Header
+	}{
+		{path: "/v1/vol/?format=ndjson"},
+		{path: "/v1/vol/", header: http.Header{"Accept": {"application/x-ndjson"}}},
+	} {
+		w := serve(r, http.MethodGet, req.path, req.header)
+		if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/x-ndjson" {
+			t.Fatalf("%s: expected 200 application/x-ndjson, got %d %s", req.path, w.Code, w.Header().Get("Content-Type"))
+		}
+
+		var vols []VolumeInfo
+		scanner := bufio.NewScanner(w.Body)
+		for scanner.Scan() {
+			vol := VolumeInfo{}
+			if err := json.Unmarshal(scanner.Bytes(), &vol); err != nil {
+				t.Fatalf("%s: malformed line %q: %s", req.path, scanner.Text(), err)
+			}
+			vols = append(vols, vol)
+		}
+
+		var names []string
+		for _, vol := range vols {
+			names = append(names, vol.Name)
+		}
+		if !reflect.DeepEqual(names, []string{"cache", "data", "logs"}) {
+			t.Errorf("%s: expected cache, data and logs in order, got %v", req.path, names)
+		}
+
+		if len(vols) == 3 && (len(vols[1].UsedBy) != 1 || vols[1].UsedBy[0].Name != "web") {
+			t.Errorf("%s: expected data used by web, got %v", req.path, vols[1].UsedBy)
+		}
+	}
+}
+
+// deleteRecorder is a fake clientset recording the options
+// of each PVC delete, which the fake does not keep.
+type deleteRecorder struct {
+	*fake.Clientset
+	deletes []metaV1.DeleteOptions
+}
+
+func (dr *deleteRecorder) CoreV1() typedCoreV1.CoreV1Interface {
+	return recordingCoreV1{CoreV1Interface: dr.Clientset.CoreV1(), recorder: dr}
+}
+
+type recordingCoreV1 struct {
+	typedCoreV1.CoreV1Interface
+	recorder *deleteRecorder
+}
+
+func (c recordingCoreV1) PersistentVolumeClaims(namespace string) typedCoreV1.PersistentVolumeClaimInterface {
+	return recordingPVCs{PersistentVolumeClaimInterface: c.CoreV1Interface.PersistentVolumeClaims(namespace), recorder: c.recorder}
+}
+
+type recordingPVCs struct {
+	typedCoreV1.PersistentVolumeClaimInterface
+	recorder *deleteRecorder
+}
+
+func (p recordingPVCs) Delete(ctx context.Context, name string, opts metaV1.DeleteOptions) error {
+	p.recorder.deletes = append(p.recorder.deletes, opts)
+	return p.PersistentVolumeClaimInterface.Delete(ctx, name, opts)
+}
+
+func TestDeletePVCPropagationPolicy(t *testing.T) {
+	cs := &deleteRecorder{Clientset: fake.NewSimpleClientset(testPVC("default", "data"))}
+	_, r := testAPI(t, &Config{Cs: cs})
+
+	w := serve(r, http.MethodDelete, "/v1/vol/data?propagationPolicy=Sideways", nil)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid propagationPolicy, got %d", w.Code)
+	}
+	if len(cs.deletes) != 0 {
+		t.Fatalf("expected no delete for an invalid propagationPolicy, got %d", len(cs.deletes))
+	}
+
+	w = serve(r, http.MethodDelete, "/v1/vol/data?propagationPolicy=Foreground", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	if len(cs.deletes) != 1 {
+		t.Fatalf("expected 1 delete, got %d", len(cs.deletes))
+	}
+	if policy := cs.deletes[0].PropagationPolicy; policy == nil || *policy != metaV1.DeletePropagationForeground {
+		t.Errorf("expected propagationPolicy Foreground, got %v", policy)
+	}
+}
+
+// deleteActions returns the PVC delete actions the fake clientset received
+func deleteActions(cs *fake.Clientset) []k8sTesting.DeleteAction {
+	var deletes []k8sTesting.DeleteAction
+	for _, action := range cs.Actions() {
+		if action.GetVerb() == "delete" && action.GetResource().Resource == "persistentvolumeclaims" {
+			deletes = append(deletes, action.(k8sTesting.DeleteAction))
+		}
+	}
+
+	return deletes
+}
+
+// errorCode decodes the APIError in w, returning its code
+func errorCode(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+
+	apiErr := APIError{}
+	if err := json.Unmarshal(w.Body.Bytes(), &apiErr); err != nil {
+		t.Fatalf("malformed APIError %q: %s", w.Body.String(), err)
+	}
+
+	return apiErr.Code
+}
+
+func TestDeletePVCInUse(t *testing.T) {
+	cs := fake.NewSimpleClientset(
+		testPVC("default", "used"),
+		testPVC("default", "unused"),
+		testPod("default", "web", "used"),
+	)
+	_, r := testAPI(t, &Config{Cs: cs})
+
+	w := serve(r, http.MethodDelete, "/v1/vol/used", nil)
+	if w.Code != http.StatusConflict || errorCode(t, w) != CodePVCInUse {
+		t.Fatalf("expected 409 %s, got %d: %s", CodePVCInUse, w.Code, w.Body.String())
+	}
+	if deletes := deleteActions(cs); len(deletes) != 0 {
+		t.Fatalf("expected no delete of a PVC in use, got %d", len(deletes))
+	}
+
+	for _, path := range []string{"/v1/vol/used?force=true", "/v1/vol/unused"} {
+		if w := serve(r, http.MethodDelete, path, nil); w.Code != http.StatusOK {
+			t.Errorf("%s: expected 200, got %d: %s", path, w.Code, w.Body.String())
+		}
+	}
+
+	var deleted []string
+	for _, d := range deleteActions(cs) {
+		deleted = append(deleted, d.GetName())
+	}
+	if !reflect.DeepEqual(deleted, []string{"used", "unused"}) {
+		t.Errorf("expected used and unused deleted, got %v", deleted)
+	}
+
+	pvcs, err := cs.CoreV1().PersistentVolumeClaims("default").List(context.Background(), metaV1.ListOptions{})
+	if err != nil {
+		t.Fatalf("List: %s", err)
+	}
+	if len(pvcs.Items) != 0 {
+		t.Errorf("expected no PVCs left, got %d", len(pvcs.Items))
+	}
+}
+
+func TestDeletePVCRetries(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		failures int
+		err      error
+		status   int
+		attempts int
+	}{
+		{name: "fail twice then succeed", failures: 2, err: errors.NewServerTimeout(v1.Resource("persistentvolumeclaims"), "delete", 1), status: http.StatusOK, attempts: 3},
+		{name: "retries exhausted", failures: 3, err: errors.NewTooManyRequests("throttled", 0), status: http.StatusTooManyRequests, attempts: 3},
+		{name: "not retryable", failures: 1, err: errors.NewForbidden(v1.Resource("persistentvolumeclaims"), "data", nil), status: http.StatusForbidden, attempts: 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cs := fake.NewSimpleClientset(testPVC("default", "data"))
+
+			failures := 0
+			cs.PrependReactor("delete", "persistentvolumeclaims", func(action k8sTesting.Action) (bool, runtime.Object, error) {
+				if failures < tc.failures {
+					failures++
+					return true, nil, tc.err
+				}
+				return false, nil, nil
+			})
+
+			_, r := testAPI(t, &Config{Cs: cs, DeleteRetries: 2, DeleteRetryBackoff: time.Millisecond})
+
+			if w := serve(r, http.MethodDelete, "/v1/vol/data", nil); w.Code != tc.status {
+				t.Errorf("expected %d, got %d: %s", tc.status, w.Code, w.Body.String())
+			}
+
+			if attempts := len(deleteActions(cs)); attempts != tc.attempts {
+				t.Errorf("expected %d delete attempts, got %d", tc.attempts, attempts)
+			}
+		})
+	}
+}
+
+func TestDeletePVCPreconditions(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		path   string
+		header http.Header
+		status int
+	}{
+		{name: "uid mismatch", path: "/v1/vol/data?uid=default/recreated", status: http.StatusConflict},
+		{name: "resourceVersion mismatch", path: "/v1/vol/data?resourceVersion=6", status: http.StatusConflict},
+		{name: "If-Match mismatch", path: "/v1/vol/data", header: http.Header{"If-Match": {`"6"`}}, status: http.StatusConflict},
+		{name: "match", path: "/v1/vol/data?uid=default/data&resourceVersion=7", status: http.StatusOK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			pvc := testPVC("default", "data")
+			pvc.ResourceVersion = "7"
+			cs := fake.NewSimpleClientset(pvc)
+			_, r := testAPI(t, &Config{Cs: cs})
+
+			w := serve(r, http.MethodDelete, tc.path, tc.header)
+			if w.Code != tc.status {
+				t.Fatalf("expected %d, got %d: %s", tc.status, w.Code, w.Body.String())
+			}
+
+			deletes := deleteActions(cs)
+			if tc.status == http.StatusConflict {
+				if code := errorCode(t, w); code != CodePreconditionFailed {
+					t.Errorf("expected code %s, got %s", CodePreconditionFailed, code)
+				}
+				if len(deletes) != 0 {
+					t.Errorf("expected no delete, got %d", len(deletes))
+				}
+				return
+			}
+
+			if len(deletes) != 1 {
+				t.Errorf("expected 1 delete, got %d", len(deletes))
+			}
+		})
+	}
+}
+
+func TestDeletePVCDryRun(t *testing.T) {
+	cs := &deleteRecorder{Clientset: fake.NewSimpleClientset(testPVC("default", "data"), testPod("default", "web", "data"))}
+	_, r := testAPI(t, &Config{Cs: cs})
+
+	// a dry run previews PVCs in use without force
+	w := serve(r, http.MethodDelete, "/v1/vol/data?dryRun=true", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	preview := DeletePreview{}
+	if err := json.Unmarshal(w.Body.Bytes(), &preview); err != nil {
+		t.Fatalf("malformed DeletePreview: %s", err)
+	}
+	if !preview.DryRun || !preview.InUse || preview.Volume.Name != "data" {
+		t.Errorf("expected a dry run preview of data in use, got %+v", preview)
+	}
+
+	// the dry run is sent to the API server
+	if deletes := deleteActions(cs.Clientset); len(deletes) != 1 || deletes[0].GetName() != "data" {
+		t.Fatalf("expected 1 delete action for data, got %v", deletes)
+	}
+	if len(cs.deletes) != 1 || !reflect.DeepEqual(cs.deletes[0].DryRun, []string{metaV1.DryRunAll}) {
+		t.Errorf("expected the delete sent with dryRun [All], got %v", cs.deletes)
+	}
+}
+
+func TestReadOnlyNeverModifies(t *testing.T) {
+	pvc := testPVC("default", "data")
+	pvc.Labels = map[string]string{"app": "web"}
+	cs := fake.NewSimpleClientset(pvc)
+	_, r := testAPI(t, &Config{Cs: cs, ReadOnly: true})
+
+	for _, req := range []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{method: http.MethodDelete, path: "/v1/vol/data"},
+		{method: http.MethodDelete, path: "/v1/vol/data?force=true"},
+		{method: http.MethodDelete, path: "/v1/vol/data?dryRun=true"},
+		{method: http.MethodDelete, path: "/v1/vol/data?removeFinalizers=true&confirm=data"},
+		{method: http.MethodDelete, path: "/v1/vol/?labelSelector=app%3Dweb"},
+		{method: http.MethodPatch, path: "/v1/vol/data/metadata", body: `{"labels":{"team":"a"}}`},
+		{method: http.MethodPost, path: "/v1/vol/data/protect"},
+		{method: http.MethodDelete, path: "/v1/vol/data/protect"},
+	} {
+		w := serveBody(r, req.method, req.path, req.body, nil)
+		if w.Code != http.StatusMethodNotAllowed || errorCode(t, w) != CodeReadOnly {
+			t.Errorf("%s %s: expected 405 %s, got %d: %s", req.method, req.path, CodeReadOnly, w.Code, w.Body.String())
+		}
+	}
+
+	for _, action := range cs.Actions() {
+		switch action.GetVerb() {
+		case "get", "list", "watch":
+		default:
+			t.Errorf("expected no %s of %s in read-only mode", action.GetVerb(), action.GetResource().Resource)
+		}
+	}
+}
+
+// countResyncs returns the PVC updates without a change the
+// API's informer delivers within d.
+func countResyncs(a *API, d time.Duration) int32 {
+	var resyncs int32
+	a.InformerFactory.Core().V1().PersistentVolumeClaims().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			if oldObj.(*v1.PersistentVolumeClaim).ResourceVersion == newObj.(*v1.PersistentVolumeClaim).ResourceVersion {
+				atomic.AddInt32(&resyncs, 1)
+			}
+		},
+	})
+	time.Sleep(d)
+
+	return atomic.LoadInt32(&resyncs)
+}
+
+func TestNewApiResyncPeriod(t *testing.T) {
+	pvc := testPVC("default", "data")
+	pvc.ResourceVersion = "1"
+	a, _ := testAPI(t, &Config{Cs: fake.NewSimpleClientset(pvc), ResyncPeriod: time.Second})
+
+	if resyncs := countResyncs(a, 2500*time.Millisecond); resyncs == 0 {
+		t.Errorf("expected resyncs within 2.5s of a 1s resync period, got %d", resyncs)
+	}
+
+	if maxAge := a.staleAfter(); maxAge != StaleAfterResyncs*time.Second {
+		t.Errorf("expected stores stale after %s, got %s", StaleAfterResyncs*time.Second, maxAge)
+	}
+}
+
+func TestNewApiDisableResync(t *testing.T) {
+	pvc := testPVC("default", "data")
+	pvc.ResourceVersion = "1"
+
+	// as configured by RESYNC_PERIOD=0
+	a, _ := testAPI(t, &Config{Cs: fake.NewSimpleClientset(pvc), DisableResync: true})
+
+	if resyncs := countResyncs(a, 2500*time.Millisecond); resyncs != 0 {
+		t.Errorf("expected no resyncs, got %d", resyncs)
+	}
+
+	if maxAge := a.staleAfter(); maxAge != 0 {
+		t.Errorf("expected the staleness check disabled, got %s", maxAge)
+	}
+	if a.Stale() {
+		t.Error("expected stores without resyncs never to be stale")
+	}
+}
+
+func TestRequireSynced(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// hold the pod list so the caches can not sync
+	release := make(chan struct{})
+	cs := fake.NewSimpleClientset(testPVC("default", "data"))
+	cs.PrependReactor("list", "pods", func(action k8sTesting.Action) (bool, runtime.Object, error) {
+		<-release
+		return false, nil, nil
+	})
+
+	a, err := NewApi(&Config{Cs: cs, Log: zap.NewNop(), PVCNamespace: "default"})
+	if err != nil {
+		t.Fatalf("NewApi: %s", err)
+	}
+	defer close(a.Stopper)
+
+	r := gin.New()
+	a.RegisterRoutes(r, APIPrefix)
+
+	for _, path := range []string{"/v1/vol/", "/v1/vol/data", "/readyz"} {
+		w := serve(r, http.MethodGet, path, nil)
+		if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != RetryAfterSeconds {
+			t.Errorf("%s: expected 503 with Retry-After %s before the caches sync, got %d %q", path, RetryAfterSeconds, w.Code, w.Header().Get("Retry-After"))
+		}
+	}
+
+	close(release)
+	if !a.WaitForCacheSync(a.Stopper) {
+		t.Fatal("caches did not sync")
+	}
+
+	w := serve(r, http.MethodGet, "/v1/vol/", nil)
+	vols := []VolumeInfo{}
+	if err := json.Unmarshal(w.Body.Bytes(), &vols); w.Code != http.StatusOK || err != nil || len(vols) != 1 {
+		t.Errorf("expected 200 listing data once synced, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestParseSelector(t *testing.T) {
+	for _, tc := range []struct {
+		selector string
+		expected map[string]string
+	}{
+		{selector: "", expected: map[string]string{}},
+		{selector: "app=web", expected: map[string]string{"app": "web"}},
+		{selector: "app=web,tier=", expected: map[string]string{"app": "web", "tier": ""}},
+		{selector: "app"},
+		{selector: "=web"},
+		{selector: "app=web,"},
+		{selector: "app=web,tier"},
+		{selector: "app=web=db"},
+	} {
+		selector, err := parseSelector(tc.selector)
+		if tc.expected == nil {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %v", tc.selector, selector)
+			}
+			continue
+		}
+
+		if err != nil || !reflect.DeepEqual(selector, tc.expected) {
+			t.Errorf("%q: expected %v, got %v %v", tc.selector, tc.expected, selector, err)
+		}
+	}
+
+	// a malformed selector fails rather than matching every PVC
+	for _, cfg := range []*Config{
+		{PVCSelector: "app"},
+		{PVCAnnotationSelector: "team"},
+	} {
+		cfg.Cs = fake.NewSimpleClientset()
+		cfg.Log = zap.NewNop()
+		cfg.PVCNamespace = "default"
+		if _, err := NewApi(cfg); err == nil {
+			t.Errorf("expected NewApi to reject selector %q and annotation selector %q", cfg.PVCSelector, cfg.PVCAnnotationSelector)
+		}
+	}
+}
+
+func TestAnnotationSelector(t *testing.T) {
+	managed := testPVC("default", "managed")
+	managed.Annotations = map[string]string{"volm.txn2.com/managed": "true"}
+
+	cs := fake.NewSimpleClientset(managed, testPVC("default", "other"))
+	_, r := testAPI(t, &Config{Cs: cs, PVCAnnotationSelector: "volm.txn2.com/managed=true"})
+
+	w := serve(r, http.MethodGet, "/v1/vol/", nil)
+	vols := []VolumeInfo{}
+	if err := json.Unmarshal(w.Body.Bytes(), &vols); err != nil {
+		t.Fatalf("malformed list: %s", err)
+	}
+	if len(vols) != 1 || vols[0].Name != "managed" {
+		t.Errorf("expected only managed listed, got %v", vols)
+	}
+
+	if w := serve(r, http.MethodGet, "/v1/vol/managed", nil); w.Code != http.StatusOK {
+		t.Errorf("expected 200 getting managed, got %d", w.Code)
+	}
+
+	for _, method := range []string{http.MethodGet, http.MethodDelete} {
+		w := serve(r, method, "/v1/vol/other", nil)
+		if w.Code != http.StatusNotFound || errorCode(t, w) != CodePVCNotFound {
+			t.Errorf("%s: expected 404 %s for a PVC outside the annotation selector, got %d", method, CodePVCNotFound, w.Code)
+		}
+	}
+
+	if deletes := deleteActions(cs); len(deletes) != 0 {
+		t.Errorf("expected no delete of a PVC outside the annotation selector, got %d", len(deletes))
+	}
+}
+
+func TestNewApiOneWatchPerResource(t *testing.T) {
+	cs := fake.NewSimpleClientset(testPVC("default", "data"), testPod("default", "web", "data"))
+	testAPI(t, &Config{Cs: cs})
+
+	watches := map[string]int{}
+	for _, action := range cs.Actions() {
+		if action.GetVerb() == "watch" {
+			watches[action.GetResource().Resource]++
+		}
+	}
+
+	for _, resource := range []string{"persistentvolumeclaims", "pods"} {
+		if watches[resource] != 1 {
+			t.Errorf("expected 1 %s watch, got %d", resource, watches[resource])
+		}
+	}
+
+	for resource, count := range watches {
+		if count != 1 {
+			t.Errorf("expected 1 %s watch, got %d", resource, count)
+		}
+	}
+}
+
+func TestGetPVCPodsHandler(t *testing.T) {
+	web := testPod("default", "web", "data")
+	web.Spec.NodeName = "node-1"
+	web.Spec.Containers = []v1.Container{{Name: "web", VolumeMounts: []v1.VolumeMount{{Name: "data", MountPath: "/var/lib/data"}}}}
+
+	done := testPod("default", "job", "data")
+	done.Status.Phase = v1.PodSucceeded
+
+	cs := fake.NewSimpleClientset(testPVC("default", "data"), testPVC("default", "unused"), web, done)
+	_, r := testAPI(t, &Config{Cs: cs})
+
+	pods := func(path string) []PodInfo {
+		t.Helper()
+
+		w := serve(r, http.MethodGet, path, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", path, w.Code, w.Body.String())
+		}
+
+		pods := []PodInfo{}
+		if err := json.Unmarshal(w.Body.Bytes(), &pods); err != nil {
+			t.Fatalf("%s: malformed pods: %s", path, err)
+		}
+		return pods
+	}
+
+	all := pods("/v1/vol/data/pods")
+	if len(all) != 2 || all[0].Name != "job" || all[1].Name != "web" {
+		t.Fatalf("expected job and web, got %v", all)
+	}
+	if all[1].NodeName != "node-1" || !reflect.DeepEqual(all[1].MountPaths, []string{"/var/lib/data"}) || !all[1].Active {
+		t.Errorf("expected web active on node-1 mounting /var/lib/data, got %+v", all[1])
+	}
+
+	if active := pods("/v1/vol/data/pods?activeOnly=true"); len(active) != 1 || active[0].Name != "web" {
+		t.Errorf("expected only web active, got %v", active)
+	}
+
+	// an empty list, not null, for a PVC without pods
+	if w := serve(r, http.MethodGet, "/v1/vol/unused/pods", nil); w.Code != http.StatusOK || w.Body.String() != "[]" {
+		t.Errorf("expected 200 with [], got %d %s", w.Code, w.Body.String())
+	}
+
+	w := serve(r, http.MethodGet, "/v1/vol/missing/pods", nil)
+	if w.Code != http.StatusNotFound || errorCode(t, w) != CodePVCNotFound {
+		t.Errorf("expected 404 %s for an unknown PVC, got %d", CodePVCNotFound, w.Code)
+	}
+}
+
+// testPV returns a PV with the reclaim policy bound to pvc,
+// setting the PVC's volume name
+func testPV(name string, policy v1.PersistentVolumeReclaimPolicy, pvc *v1.PersistentVolumeClaim) *v1.PersistentVolume {
+	pvc.Spec.VolumeName = name
+
+	return &v1.PersistentVolume{
+		ObjectMeta: metaV1.ObjectMeta{Name: name, UID: types.UID("pv/" + name)},
+		Spec: v1.PersistentVolumeSpec{
+			PersistentVolumeReclaimPolicy: policy,
+			ClaimRef:                      &v1.ObjectReference{Namespace: pvc.Namespace, Name: pvc.Name, UID: pvc.UID},
+		},
+	}
+}
+
+func TestDeletePVCReclaimPolicy(t *testing.T) {
+	retained, deleted, kept := testPVC("default", "retained"), testPVC("default", "deleted"), testPVC("default", "kept")
+	cs := fake.NewSimpleClientset(
+		retained, testPV("pv-retained", v1.PersistentVolumeReclaimRetain, retained),
+		deleted, testPV("pv-deleted", v1.PersistentVolumeReclaimDelete, deleted),
+		kept, testPV("pv-kept", v1.PersistentVolumeReclaimRetain, kept),
+	)
+	_, r := testAPI(t, &Config{Cs: cs})
+
+	for _, tc := range []struct {
+		name    string
+		path    string
+		pv      string
+		reclaim *PVReclaim
+		pvGone  bool
+	}{
+		{
+			name:    "Retain",
+			path:    "/v1/vol/retained?reclaimPv=true",
+			pv:      "pv-retained",
+			reclaim: &PVReclaim{PV: "pv-retained", Deleted: true},
+			pvGone:  true,
+		},
+		{
+			name:    "Delete",
+			path:    "/v1/vol/deleted?reclaimPv=true",
+			pv:      "pv-deleted",
+			reclaim: &PVReclaim{PV: "pv-deleted", Reason: "reclaim policy is Delete, not Retain"},
+		},
+		{
+			name: "Retain without reclaimPv",
+			path: "/v1/vol/kept",
+			pv:   "pv-kept",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := serve(r, http.MethodDelete, tc.path, nil)
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+			}
+
+			if tc.reclaim != nil {
+				preview := DeletePreview{}
+				if err := json.Unmarshal(w.Body.Bytes(), &preview); err != nil {
+					t.Fatalf("malformed DeletePreview: %s", err)
+				}
+				if !reflect.DeepEqual(preview.Reclaim, tc.reclaim) {
+					t.Errorf("expected reclaim %+v, got %+v", tc.reclaim, preview.Reclaim)
+				}
+			}
+
+			_, err := cs.CoreV1().PersistentVolumes().Get(context.Background(), tc.pv, metaV1.GetOptions{})
+			if gone := errors.IsNotFound(err); gone != tc.pvGone {
+				t.Errorf("expected %s deleted %v, got error %v", tc.pv, tc.pvGone, err)
+			}
+		})
+	}
+
+	if deletes := deleteActions(cs); len(deletes) != 3 {
+		t.Errorf("expected 3 PVC deletes, got %d", len(deletes))
+	}
+}
+
+func TestBlockVolumeDevicePaths(t *testing.T) {
+	block := v1.PersistentVolumeBlock
+	pvc := testPVC("default", "data")
+	pvc.Spec.VolumeMode = &block
+
+	pod := testPod("default", "db", "data")
+	pod.Spec.Containers = []v1.Container{
+		{Name: "db", VolumeDevices: []v1.VolumeDevice{{Name: "data", DevicePath: "/dev/xvda"}}},
+		{Name: "sidecar", VolumeMounts: []v1.VolumeMount{{Name: "config", MountPath: "/etc/db"}}},
+	}
+
+	_, r := testAPI(t, &Config{Cs: fake.NewSimpleClientset(pvc, pod)})
+
+	w := serve(r, http.MethodGet, "/v1/vol/data", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	vol := VolumeInfo{}
+	if err := json.Unmarshal(w.Body.Bytes(), &vol); err != nil {
+		t.Fatalf("malformed VolumeInfo: %s", err)
+	}
+
+	if vol.VolumeMode != string(v1.PersistentVolumeBlock) {
+		t.Errorf("expected volumeMode Block, got %s", vol.VolumeMode)
+	}
+	if len(vol.UsedBy) != 1 {
+		t.Fatalf("expected the PVC used by db, got %v", vol.UsedBy)
+	}
+
+	// attached as a device, not mounted
+	if !reflect.DeepEqual(vol.UsedBy[0].DevicePaths, []string{"/dev/xvda"}) {
+		t.Errorf("expected device path /dev/xvda, got %v", vol.UsedBy[0].DevicePaths)
+	}
+	if len(vol.UsedBy[0].MountPaths) != 0 {
+		t.Errorf("expected no mount paths, got %v", vol.UsedBy[0].MountPaths)
+	}
+}
+
+func TestListPVCSizeFilter(t *testing.T) {
+	pvc := func(name, size string) *v1.PersistentVolumeClaim {
+		pvc := testPVC("default", name)
+		if size != "" {
+			pvc.Spec.Resources.Requests = v1.ResourceList{v1.ResourceStorage: resource.MustParse(size)}
+		}
+		return pvc
+	}
+
+	cs := fake.NewSimpleClientset(
+		pvc("decimal-1g", "1G"),
+		pvc("binary-1gi", "1Gi"),
+		pvc("binary-1024mi", "1024Mi"),
+		pvc("binary-2gi", "2Gi"),
+		pvc("unsized", ""),
+	)
+	_, r := testAPI(t, &Config{Cs: cs})
+
+	for _, tc := range []struct {
+		query string
+		names []string
+	}{
+		// bounds are inclusive and compare across units
+		{query: "minSize=1Gi", names: []string{"binary-1024mi", "binary-1gi", "binary-2gi"}},
+		{query: "minSize=1024Mi", names: []string{"binary-1024mi", "binary-1gi", "binary-2gi"}},
+		{query: "maxSize=1Gi", names: []string{"binary-1024mi", "binary-1gi", "decimal-1g"}},
+		{query: "minSize=1Gi&maxSize=1024Mi", names: []string{"binary-1024mi", "binary-1gi"}},
+		// 1G is 1000000000 bytes, below 1Gi
+		{query: "minSize=1G&maxSize=1G", names: []string{"decimal-1g"}},
+		{query: "minSize=1000000001", names: []string{"binary-1024mi", "binary-1gi", "binary-2gi"}},
+		{query: "maxSize=999999999", names: []string{}},
+		{query: "minSize=2049Mi", names: []string{}},
+	} {
+		t.Run(tc.query, func(t *testing.T) {
+			w := serve(r, http.MethodGet, "/v1/vol/?"+tc.query, nil)
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+			}
+
+			vols := []VolumeInfo{}
+			if err := json.Unmarshal(w.Body.Bytes(), &vols); err != nil {
+				t.Fatalf("malformed list: %s", err)
+			}
+
+			names := []string{}
+			for _, vol := range vols {
+				names = append(names, vol.Name)
+			}
+			sort.Strings(names)
+
+			if !reflect.DeepEqual(names, tc.names) {
+				t.Errorf("expected %v, got %v", tc.names, names)
+			}
+		})
+	}
+
+	for _, query := range []string{"minSize=big", "maxSize=1Zi"} {
+		if w := serve(r, http.MethodGet, "/v1/vol/?"+query, nil); w.Code != http.StatusBadRequest || errorCode(t, w) != CodeBadRequest {
+			t.Errorf("%s: expected 400, got %d", query, w.Code)
+		}
+	}
+}
+
+func TestPodInfoInitContainers(t *testing.T) {
+	pod := testPod("default", "web", "data")
+	pod.Spec.InitContainers = []v1.Container{
+		{Name: "restore", VolumeMounts: []v1.VolumeMount{{Name: "data", MountPath: "/restore"}}},
+		{Name: "format", VolumeDevices: []v1.VolumeDevice{{Name: "data", DevicePath: "/dev/xvdb"}}},
+	}
+	pod.Spec.Containers = []v1.Container{
+		{Name: "web", VolumeMounts: []v1.VolumeMount{{Name: "data", MountPath: "/var/lib/data"}}},
+	}
+
+	info := podInfo(*pod, "data")
+
+	if !reflect.DeepEqual(info.MountPaths, []string{"/restore", "/var/lib/data"}) {
+		t.Errorf("expected init and app container mount paths, got %v", info.MountPaths)
+	}
+	if !reflect.DeepEqual(info.DevicePaths, []string{"/dev/xvdb"}) {
+		t.Errorf("expected the init container device path, got %v", info.DevicePaths)
+	}
+
+	// a volume mounted only by an init container
+	pod.Spec.Containers = nil
+	if info := podInfo(*pod, "data"); !reflect.DeepEqual(info.MountPaths, []string{"/restore"}) {
+		t.Errorf("expected the init container mount path, got %v", info.MountPaths)
+	}
+}
@@ -0,0 +1,77 @@
+package volm
+
+import (
+	"context"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+type callerContextKey struct{}
+
+// WithCaller returns a context carrying the caller identity
+// recorded in audit entries and events.
+func WithCaller(ctx context.Context, caller string) context.Context {
+	return context.WithValue(ctx, callerContextKey{}, caller)
+}
+
+// CallerFromContext returns the caller identity set by
+// WithCaller, or an empty string.
+func CallerFromContext(ctx context.Context) string {
+	caller, _ := ctx.Value(callerContextKey{}).(string)
+	return caller
+}
+
+// requestContext returns the request context carrying the
+// caller identity and request ID of the request.
+func requestContext(c *gin.Context) context.Context {
+	ctx := WithCaller(c.Request.Context(), Caller(c))
+	if id := RequestID(c); id != "" {
+		ctx = WithRequestID(ctx, id)
+	}
+
+	return ctx
+}
+
+// audit writes an entry to the audit log recording an
+// operation on a PVC, its outcome and latency since start,
+// with the request ID of ctx when there is one.
+func (a *API) audit(ctx context.Context, operation string, name string, caller string, start time.Time, err error, fields ...zap.Field) {
+	outcome := "success"
+	if err != nil {
+		outcome = "error"
+	}
+
+	fields = append([]zap.Field{
+		zap.String("type", "audit"),
+		zap.String("operation", operation),
+		zap.String("name", name),
+		zap.String("namespace", a.PVCNamespace),
+		zap.String("caller", caller),
+		zap.String("outcome", outcome),
+		zap.Duration("latency", time.Since(start)),
+	}, fields...)
+
+	if id := RequestIDFromContext(ctx); id != "" {
+		fields = append(fields, zap.String("request_id", id))
+	}
+
+	if err != nil {
+		fields = append(fields, zap.Error(err))
+	}
+
+	a.AuditLog.Info("PVC "+operation, fields...)
+}
+
+// recordEvent posts a Kubernetes Event on the object when
+// an EventRecorder is configured.
+func (a *API) recordEvent(obj runtime.Object, reason string, messageFmt string, args ...interface{}) {
+	if a.Recorder == nil {
+		return
+	}
+
+	a.Recorder.Eventf(obj, v1.EventTypeNormal, reason, messageFmt, args...)
+}
@@ -0,0 +1,52 @@
+package volm
+
+import (
+	"net/http"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestAuditDeleteAndPatch(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+
+	cs := fake.NewSimpleClientset(testPVC("default", "data"))
+	_, r := testAPI(t, &Config{
+		Cs:        cs,
+		AuditLog:  zap.New(core),
+		APITokens: map[string]Role{"admin-token": RoleAdmin},
+	})
+
+	header := http.Header{"Authorization": {"Bearer admin-token"}}
+	serveBody(r, http.MethodPatch, "/v1/vol/data/metadata", `{"labels":{"team":"a"}}`, header)
+	serve(r, http.MethodDelete, "/v1/vol/data", header)
+	serve(r, http.MethodDelete, "/v1/vol/missing", header)
+
+	entries := logs.FilterField(zap.String("type", "audit")).AllUntimed()
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 audit entries, got %d", len(entries))
+	}
+
+	caller := tokenIdentity("admin-token")
+	for i, expected := range []struct {
+		operation string
+		name      string
+		outcome   string
+	}{
+		{operation: "patch_metadata", name: "data", outcome: "success"},
+		{operation: "delete", name: "data", outcome: "success"},
+		{operation: "delete", name: "missing", outcome: "error"},
+	} {
+		fields := entries[i].ContextMap()
+		if fields["operation"] != expected.operation || fields["name"] != expected.name || fields["outcome"] != expected.outcome {
+			t.Errorf("expected %s of %s with outcome %s, got %v", expected.operation, expected.name, expected.outcome, fields)
+		}
+
+		if fields["caller"] != caller {
+			t.Errorf("expected caller %s, got %v", caller, fields["caller"])
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package volm
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// CallerKey is the gin context key the auth middleware stores
+// the authenticated caller identity under.
+const CallerKey = "volm.caller"
+
+// RoleKey is the gin context key API.AuthMiddleware stores
+// the authenticated caller Role under.
+const RoleKey = "volm.role"
+
+// Role grants access to a set of routes
+type Role string
+
+const (
+	// RoleRead may only make GET requests
+	RoleRead Role = "read"
+
+	// RoleAdmin may make any request
+	RoleAdmin Role = "admin"
+)
+
+// ParseTokenRoles parses "token:role" pairs into a token to
+// Role map. A token without a role is given RoleAdmin.
+func ParseTokenRoles(items []string) (map[string]Role, error) {
+	tokens := make(map[string]Role, len(items))
+	for _, item := range items {
+		token, role := item, RoleAdmin
+		if i := strings.LastIndex(item, ":"); i != -1 {
+			token, role = item[:i], Role(item[i+1:])
+		}
+
+		if role != RoleRead && role != RoleAdmin {
+			return nil, fmt.Errorf("unknown role %q, must be %s or %s", role, RoleRead, RoleAdmin)
+		}
+
+		if token == "" {
+			return nil, fmt.Errorf("empty token for role %s", role)
+		}
+
+		tokens[token] = role
+	}
+
+	return tokens, nil
+}
+
+// Caller returns the caller identity set by the auth middleware,
+// or the client IP for unauthenticated requests.
+func Caller(c *gin.Context) string {
+	if caller := c.GetString(CallerKey); caller != "" {
+		return caller
+	}
+
+	return c.ClientIP()
+}
+
+// AuthMiddleware returns gin middleware accepting requests carrying
+// a token from Config.APITokens as an "Authorization: Bearer" token
+// or an X-API-Key header. Requests without a valid token get a 401
+// and RoleRead tokens get a 403 on anything but GET. When no tokens
+// are configured every request is accepted.
+func (a *API) AuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if len(a.APITokens) == 0 {
+			c.Next()
+			return
+		}
+
+		token := requestToken(c)
+
+		role, ok := lookupToken(a.APITokens, token)
+		if token == "" || !ok {
+			authRequests.WithLabelValues("unauthenticated").Inc()
+			WriteError(c, NewAPIError(http.StatusUnauthorized, CodeUnauthorized, "unauthorized"))
+			return
+		}
+
+		authRequests.WithLabelValues(string(role)).Inc()
+
+		caller := tokenIdentity(token)
+		c.Set(CallerKey, caller)
+		c.Set(RoleKey, role)
+
+		if role != RoleAdmin && !readMethod(c.Request.Method) {
+			a.logger(requestContext(c)).Warn("Role not permitted",
+				zap.String("type", "auth"),
+				zap.String("caller", caller),
+				zap.String("role", string(role)),
+				zap.String("method", c.Request.Method),
+				zap.String("path", c.Request.URL.Path),
+			)
+			WriteError(c, NewAPIError(http.StatusForbidden, CodeForbidden, "role "+string(role)+" may not "+c.Request.Method))
+			return
+		}
+
+		c.Next()
+
+		a.logger(requestContext(c)).Info("Authenticated request",
+			zap.String("type", "auth"),
+			zap.String("caller", caller),
+			zap.String("role", string(role)),
+			zap.String("method", c.Request.Method),
+			zap.String("path", c.Request.URL.Path),
+			zap.Int("status", c.Writer.Status()),
+		)
+	}
+}
+
+// TokenAuthMiddleware returns gin middleware accepting requests
+// carrying one of the tokens, all other requests are rejected with
+// a 401. When no tokens are given every request is accepted.
+func TokenAuthMiddleware(tokens []string) gin.HandlerFunc {
+	roles := make(map[string]Role, len(tokens))
+	for _, t := range tokens {
+		roles[t] = RoleAdmin
+	}
+
+	return func(c *gin.Context) {
+		if len(roles) == 0 {
+			c.Next()
+			return
+		}
+
+		token := requestToken(c)
+		if _, ok := lookupToken(roles, token); token == "" || !ok {
+			WriteError(c, NewAPIError(http.StatusUnauthorized, CodeUnauthorized, "unauthorized"))
+			return
+		}
+
+		c.Set(CallerKey, tokenIdentity(token))
+
+		c.Next()
+	}
+}
+
+// requestToken returns the Bearer token or X-API-Key header.
+func requestToken(c *gin.Context) string {
+	if auth := c.GetHeader("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+
+	return c.GetHeader("X-API-Key")
+}
+
+// tokenIdentity identifies the caller without logging
+// the token itself.
+func tokenIdentity(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return "token:" + hex.EncodeToString(sum[:4])
+}
+
+// readMethod reports whether the HTTP method only reads.
+func readMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// lookupToken compares the token against each configured token
+// in constant time.
+func lookupToken(tokens map[string]Role, token string) (Role, bool) {
+	var (
+		role  Role
+		found bool
+	)
+	for t, r := range tokens {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			role, found = r, true
+		}
+	}
+
+	return role, found
+}
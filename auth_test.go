@@ -0,0 +1,114 @@
+package volm
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestAuthReadRole(t *testing.T) {
+	cs := fake.NewSimpleClientset(testPVC("default", "data"))
+	_, r := testAPI(t, &Config{Cs: cs, APITokens: map[string]Role{"reader": RoleRead}})
+
+	header := http.Header{"Authorization": {"Bearer reader"}}
+
+	if w := serve(r, http.MethodGet, "/v1/vol/data", header); w.Code != http.StatusOK {
+		t.Errorf("expected a read token to GET a PVC, got %d", w.Code)
+	}
+
+	for _, req := range []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{method: http.MethodDelete, path: "/v1/vol/data"},
+		{method: http.MethodPatch, path: "/v1/vol/data/metadata", body: `{"labels":{"team":"a"}}`},
+	} {
+		w := serveBody(r, req.method, req.path, req.body, header)
+		if w.Code != http.StatusForbidden || errorCode(t, w) != CodeForbidden {
+			t.Errorf("%s %s: expected 403 %s, got %d: %s", req.method, req.path, CodeForbidden, w.Code, w.Body.String())
+		}
+	}
+
+	for _, action := range cs.Actions() {
+		if verb := action.GetVerb(); verb == "delete" || verb == "patch" {
+			t.Errorf("expected no %s with a read token", verb)
+		}
+	}
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	cs := fake.NewSimpleClientset(testPVC("default", "data"))
+	_, r := testAPI(t, &Config{Cs: cs, APITokens: map[string]Role{"admin-token": RoleAdmin}})
+
+	for _, tc := range []struct {
+		name   string
+		header http.Header
+		status int
+	}{
+		{name: "missing token", status: http.StatusUnauthorized},
+		{name: "wrong token", header: http.Header{"Authorization": {"Bearer bogus"}}, status: http.StatusUnauthorized},
+		{name: "wrong API key", header: http.Header{"X-API-Key": {"bogus"}}, status: http.StatusUnauthorized},
+		{name: "valid token", header: http.Header{"Authorization": {"Bearer admin-token"}}, status: http.StatusOK},
+		{name: "valid API key", header: http.Header{"X-API-Key": {"admin-token"}}, status: http.StatusOK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := serve(r, http.MethodGet, "/v1/vol/data", tc.header)
+			if w.Code != tc.status {
+				t.Fatalf("expected %d, got %d: %s", tc.status, w.Code, w.Body.String())
+			}
+
+			if tc.status == http.StatusUnauthorized && errorCode(t, w) != CodeUnauthorized {
+				t.Errorf("expected code %s", CodeUnauthorized)
+			}
+		})
+	}
+
+	// status and probes stay open
+	for _, path := range []string{"/", "/healthz", "/readyz"} {
+		if w := serve(r, http.MethodGet, path, nil); w.Code != http.StatusOK {
+			t.Errorf("%s: expected 200 without a token, got %d", path, w.Code)
+		}
+	}
+}
+
+func TestTokenAuthMiddlewareUnprotect(t *testing.T) {
+	cs := fake.NewSimpleClientset(testPVC("default", "data"))
+	_, r := testAPI(t, &Config{
+		Cs:            cs,
+		APITokens:     map[string]Role{"admin-token": RoleAdmin},
+		ProtectTokens: []string{"protect-token"},
+	})
+
+	admin := http.Header{"Authorization": {"Bearer admin-token"}}
+	protect := http.Header{"Authorization": {"Bearer protect-token"}}
+
+	if w := serve(r, http.MethodPost, "/v1/vol/data/protect", admin); w.Code != http.StatusOK {
+		t.Fatalf("expected an admin token to protect, got %d: %s", w.Code, w.Body.String())
+	}
+
+	if w := serve(r, http.MethodDelete, "/v1/vol/data", admin); w.Code != http.StatusForbidden || errorCode(t, w) != CodePVCProtected {
+		t.Errorf("expected 403 %s deleting a protected PVC, got %d: %s", CodePVCProtected, w.Code, w.Body.String())
+	}
+
+	for _, header := range []http.Header{nil, admin} {
+		if w := serve(r, http.MethodDelete, "/v1/vol/data/protect", header); w.Code != http.StatusUnauthorized {
+			t.Errorf("expected 401 unprotecting without the protect token, got %d", w.Code)
+		}
+	}
+
+	w := serve(r, http.MethodDelete, "/v1/vol/data/protect", protect)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected the protect token to unprotect, got %d: %s", w.Code, w.Body.String())
+	}
+
+	vol := VolumeInfo{}
+	if err := json.Unmarshal(w.Body.Bytes(), &vol); err != nil {
+		t.Fatalf("malformed VolumeInfo: %s", err)
+	}
+	if _, ok := vol.Annotations[ProtectedAnnotation]; ok {
+		t.Errorf("expected %s removed, got %v", ProtectedAnnotation, vol.Annotations)
+	}
+}
@@ -0,0 +1,107 @@
+package volm
+
+import (
+	"context"
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// DefaultBulkDeleteLimit caps the number of PVCs a bulk
+// delete may match when Config.BulkDeleteLimit is unset.
+const DefaultBulkDeleteLimit = 100
+
+// BulkDeleteItem is the outcome of deleting a single PVC
+// within a bulk delete.
+type BulkDeleteItem struct {
+	Name    string `json:"name"`
+	Success bool   `json:"success"`
+	InUse   bool   `json:"inUse"`
+	Error   string `json:"error,omitempty"`
+}
+
+// BulkDeleteResult lists the outcome for every PVC matched
+// by a bulk delete.
+type BulkDeleteResult struct {
+	DryRun  bool             `json:"dryRun"`
+	Results []BulkDeleteItem `json:"results"`
+}
+
+func (a *API) BulkDeletePVCHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		opts := DeletePVCOptions{
+			DryRun: c.Query("dryRun") == "true",
+			Force:  c.Query("force") == "true",
+			Caller: Caller(c),
+		}
+
+		result, err := a.BulkDeletePVC(requestContext(c), c.Query("labelSelector"), opts)
+		if err != nil {
+			WriteError(c, err)
+			return
+		}
+
+		if opts.DryRun {
+			c.JSON(http.StatusOK, result)
+			return
+		}
+
+		c.JSON(http.StatusMultiStatus, result)
+	}
+}
+
+// BulkDeletePVC deletes every PVC in the PVC store matching both
+// the label selector and the configured PVC selector. A failure
+// deleting one PVC does not stop the others from being deleted.
+func (a *API) BulkDeletePVC(ctx context.Context, labelSelector string, opts DeletePVCOptions) (BulkDeleteResult, error) {
+	result := BulkDeleteResult{DryRun: opts.DryRun, Results: make([]BulkDeleteItem, 0)}
+
+	if a.ReadOnly {
+		return result, errReadOnly()
+	}
+
+	if labelSelector == "" {
+		return result, errBadRequest("labelSelector is required")
+	}
+
+	selector, err := labels.Parse(labelSelector)
+	if err != nil {
+		return result, errBadRequest("invalid labelSelector: %s", err.Error())
+	}
+
+	var names []string
+	for _, pvc := range a.PVCStore.GetPVCs() {
+		if a.matchesSelector(pvc.ObjectMeta) && selector.Matches(labels.Set(pvc.Labels)) {
+			names = append(names, pvc.Name)
+		}
+	}
+
+	limit := a.BulkDeleteLimit
+	if limit <= 0 {
+		limit = DefaultBulkDeleteLimit
+	}
+
+	if len(names) > limit {
+		return result, errBadRequest("labelSelector matches %d PVCs, more than the limit of %d", len(names), limit)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		item := BulkDeleteItem{Name: name}
+
+		preview, err := a.DeletePVC(ctx, name, opts)
+		item.InUse = preview.InUse
+		if err != nil {
+			item.Error = err.Error()
+		} else {
+			item.Success = true
+		}
+
+		result.Results = append(result.Results, item)
+	}
+
+	return result, nil
+}
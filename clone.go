@@ -0,0 +1,132 @@
+package volm
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CloneRequest is the body of a clone request. Size
+// defaults to the source PVC capacity.
+type CloneRequest struct {
+	Name   string            `json:"name" binding:"required"`
+	Size   string            `json:"size"`
+	Labels map[string]string `json:"labels"`
+}
+
+func (a *API) ClonePVCHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		req := CloneRequest{}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			WriteError(c, errBadRequest(err.Error()))
+			return
+		}
+
+		volInfo, err := a.ClonePVC(requestContext(c), c.Param("name"), req)
+		if err != nil {
+			WriteError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, volInfo)
+	}
+}
+
+// ClonePVC creates a new PVC in the same namespace using CSI volume
+// cloning, with a dataSource referencing the bound source PVC. The
+// clone copies the source access modes, volume mode and storage class
+// and carries the selector labels so it is visible through the API.
+func (a *API) ClonePVC(ctx context.Context, name string, req CloneRequest) (volInfo VolumeInfo, err error) {
+	ctx, cancel := a.kubeContext(ctx)
+	defer cancel()
+
+	start := time.Now()
+	defer func() {
+		a.audit(ctx, "clone", name, CallerFromContext(ctx), start, err)
+	}()
+
+	if a.ReadOnly {
+		return VolumeInfo{}, errReadOnly()
+	}
+
+	source := a.PVCStore.GetPVC(name)
+	if source == nil {
+		return VolumeInfo{}, errPVCNotFound(name)
+	}
+
+	if err := a.checkSelector(source.ObjectMeta); err != nil {
+		return VolumeInfo{}, err
+	}
+
+	if source.Status.Phase != v1.ClaimBound {
+		return VolumeInfo{}, errBadRequest("PVC %s is %s, only bound PVCs can be cloned", name, source.Status.Phase)
+	}
+
+	capacity, ok := source.Status.Capacity[v1.ResourceStorage]
+	if !ok {
+		capacity = source.Spec.Resources.Requests[v1.ResourceStorage]
+	}
+
+	size := capacity
+	if req.Size != "" {
+		q, err := resource.ParseQuantity(req.Size)
+		if err != nil {
+			return VolumeInfo{}, errBadRequest("invalid size %s: %s", req.Size, err.Error())
+		}
+
+		if q.Cmp(capacity) < 0 {
+			return VolumeInfo{}, errBadRequest("size %s is smaller than the source capacity %s", req.Size, capacity.String())
+		}
+
+		size = q
+	}
+
+	labels := map[string]string{}
+	for k, v := range req.Labels {
+		labels[k] = v
+	}
+	for k, v := range a.PVCSelectorMap {
+		labels[k] = v
+	}
+
+	// keep the new PVC visible to the annotation selector
+	annotations := map[string]string{}
+	for k, v := range a.AnnotationMap {
+		annotations[k] = v
+	}
+
+	pvc := &v1.PersistentVolumeClaim{
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:        req.Name,
+			Namespace:   a.PVCNamespace,
+			Labels:      labels,
+			Annotations: annotations,
+		},
+		Spec: v1.PersistentVolumeClaimSpec{
+			AccessModes:      source.Spec.AccessModes,
+			StorageClassName: source.Spec.StorageClassName,
+			VolumeMode:       source.Spec.VolumeMode,
+			Resources: v1.ResourceRequirements{
+				Requests: v1.ResourceList{v1.ResourceStorage: size},
+			},
+			DataSource: &v1.TypedLocalObjectReference{
+				Kind: "PersistentVolumeClaim",
+				Name: name,
+			},
+		},
+	}
+
+	created, err := a.Cs.CoreV1().PersistentVolumeClaims(a.PVCNamespace).Create(ctx, pvc, metaV1.CreateOptions{})
+	if err != nil {
+		a.logger(ctx).Error("ClonePVC got error invoking pvcClient.Create", zap.Error(err))
+		return VolumeInfo{}, err
+	}
+
+	return a.volumeInfo(*created)
+}
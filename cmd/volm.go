@@ -1,40 +1,91 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"flag"
 	"fmt"
-	"log"
+	"io/ioutil"
 	"net/http"
+	"net/http/pprof"
 	"os"
-	"path/filepath"
+	"os/signal"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
+	"unicode"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
-	ginzap "github.com/gin-contrib/zap"
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/txn2/volm"
 	ginprometheus "github.com/zsais/go-gin-prometheus"
 	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/yaml"
 )
 
 var (
-	ipEnv               = getEnv("IP", "127.0.0.1")
-	portEnv             = getEnv("PORT", "8070")
-	metricsPortEnv      = getEnv("METRICS_PORT", "2112")
-	modeEnv             = getEnv("MODE", "release")
-	httpReadTimeoutEnv  = getEnv("HTTP_READ_TIMEOUT", "10")
-	httpWriteTimeoutEnv = getEnv("HTTP_WRITE_TIMEOUT", "1200")
-	pvcNamespaceEnv     = getEnv("PVC_NAMESPACE", "default")
-	pvcSelectorEnv      = getEnv("PVC_SELECTOR", "")
+	ipEnv                    = getEnv("IP", "127.0.0.1")
+	portEnv                  = getEnv("PORT", "8070")
+	metricsPortEnv           = getEnv("METRICS_PORT", "2112")
+	modeEnv                  = getEnv("MODE", "release")
+	httpReadTimeoutEnv       = getEnv("HTTP_READ_TIMEOUT", "10")
+	httpWriteTimeoutEnv      = getEnv("HTTP_WRITE_TIMEOUT", "1200")
+	pvcNamespaceEnv          = getEnv("PVC_NAMESPACE", "default")
+	pvcSelectorEnv           = getEnv("PVC_SELECTOR", "")
+	pvcAnnotationSelectorEnv = getEnv("PVC_ANNOTATION_SELECTOR", "")
+	lastUsedIntervalEnv      = getEnv("LAST_USED_INTERVAL", "0")
+	lastUsedQPSEnv           = getEnv("LAST_USED_QPS", "1")
+	tlsCertFileEnv           = getEnv("TLS_CERT_FILE", "")
+	tlsKeyFileEnv            = getEnv("TLS_KEY_FILE", "")
+	tlsMinVersionEnv         = getEnv("TLS_MIN_VERSION", "1.2")
+	tlsClientCAFileEnv       = getEnv("TLS_CLIENT_CA_FILE", "")
+	retentionTTLEnv          = getEnv("RETENTION_TTL", "")
+	retentionIntervalEnv     = getEnv("RETENTION_INTERVAL", "10m")
+	retentionDryRunEnv       = getEnv("RETENTION_DRY_RUN", "false")
+	apiTokensEnv             = getEnv("API_TOKENS", "")
+	protectTokensEnv         = getEnv("PROTECT_TOKENS", "")
+	readOnlyEnv              = getEnv("READ_ONLY", "false")
+	bulkDeleteLimitEnv       = getEnv("BULK_DELETE_LIMIT", "100")
+	resyncPeriodEnv          = getEnv("RESYNC_PERIOD", "60")
+	pvcPhaseFilterEnv        = getEnv("PVC_PHASE_FILTER", "")
+	auditLogFileEnv          = getEnv("AUDIT_LOG_FILE", "")
+	volumeStatsEnv           = getEnv("VOLUME_STATS", "false")
+	volumeStatsTTLEnv        = getEnv("VOLUME_STATS_TTL", "30")
+	volumeStatsIntervalEnv   = getEnv("VOLUME_STATS_INTERVAL", "30")
+	corsAllowedOriginsEnv    = getEnv("CORS_ALLOWED_ORIGINS", "")
+	corsAllowedMethodsEnv    = getEnv("CORS_ALLOWED_METHODS", "")
+	corsAllowedHeadersEnv    = getEnv("CORS_ALLOWED_HEADERS", "")
+	corsAllowCredentialsEnv  = getEnv("CORS_ALLOW_CREDENTIALS", "false")
+	kubeAPITimeoutEnv        = getEnv("KUBE_API_TIMEOUT", "30")
+	authTokenEnv             = getEnv("AUTH_TOKEN", "")
+	deletableNamespacesEnv   = getEnv("DELETABLE_NAMESPACES", "")
+	informerResyncEnv        = getEnv("INFORMER_RESYNC", "")
+	staleAfterEnv            = getEnv("STALE_AFTER", "")
+	eventsCacheTTLEnv        = getEnv("EVENTS_CACHE_TTL", "10s")
+	watchStorageClassesEnv   = getEnv("WATCH_STORAGE_CLASSES", "false")
+	watchPVsEnv              = getEnv("WATCH_PERSISTENT_VOLUMES", "false")
+	webhookURLEnv            = getEnv("WEBHOOK_URL", "")
+	webhookTemplateEnv       = getEnv("WEBHOOK_TEMPLATE", "")
+	deleteRetriesEnv         = getEnv("DELETE_RETRIES", "3")
+	deleteRetryBackoffEnv    = getEnv("DELETE_RETRY_BACKOFF", "200ms")
+	configFileEnv            = getEnv("CONFIG_FILE", "")
+	pvcTemplatesFileEnv      = getEnv("PVC_TEMPLATES_FILE", "")
+	enablePprofEnv           = getEnv("ENABLE_PPROF", "false")
+	gzipMinSizeEnv           = getEnv("GZIP_MIN_SIZE", "1024")
+	rateLimitRPSEnv          = getEnv("RATE_LIMIT_RPS", "0")
+	kubeContextEnv           = getEnv("KUBE_CONTEXT", "")
+	rateLimitBurstEnv        = getEnv("RATE_LIMIT_BURST", "10")
 )
 
 var Version = "0.0.0"
@@ -53,18 +104,135 @@ func main() {
 		os.Exit(1)
 	}
 
+	lastUsedIntervalInt, err := strconv.Atoi(lastUsedIntervalEnv)
+	if err != nil {
+		fmt.Println("Parsing error, LAST_USED_INTERVAL must be an integer in seconds.")
+		os.Exit(1)
+	}
+
+	lastUsedQPSFloat, err := strconv.ParseFloat(lastUsedQPSEnv, 64)
+	if err != nil {
+		fmt.Println("Parsing error, LAST_USED_QPS must be a number.")
+		os.Exit(1)
+	}
+
+	bulkDeleteLimitInt, err := strconv.Atoi(bulkDeleteLimitEnv)
+	if err != nil {
+		fmt.Println("Parsing error, BULK_DELETE_LIMIT must be an integer.")
+		os.Exit(1)
+	}
+
+	deleteRetriesInt, err := strconv.Atoi(deleteRetriesEnv)
+	if err != nil {
+		fmt.Println("Parsing error, DELETE_RETRIES must be an integer.")
+		os.Exit(1)
+	}
+
+	rateLimitRPSFloat, err := strconv.ParseFloat(rateLimitRPSEnv, 64)
+	if err != nil {
+		fmt.Println("Parsing error, RATE_LIMIT_RPS must be a number.")
+		os.Exit(1)
+	}
+
+	rateLimitBurstInt, err := strconv.Atoi(rateLimitBurstEnv)
+	if err != nil {
+		fmt.Println("Parsing error, RATE_LIMIT_BURST must be an integer.")
+		os.Exit(1)
+	}
+
+	gzipMinSizeInt, err := strconv.Atoi(gzipMinSizeEnv)
+	if err != nil {
+		fmt.Println("Parsing error, GZIP_MIN_SIZE must be an integer in bytes.")
+		os.Exit(1)
+	}
+
+	resyncPeriodInt, err := strconv.Atoi(resyncPeriodEnv)
+	if err != nil {
+		fmt.Println("Parsing error, RESYNC_PERIOD must be an integer in seconds.")
+		os.Exit(1)
+	}
+
+	volumeStatsTTLInt, err := strconv.Atoi(volumeStatsTTLEnv)
+	if err != nil {
+		fmt.Println("Parsing error, VOLUME_STATS_TTL must be an integer in seconds.")
+		os.Exit(1)
+	}
+
+	volumeStatsIntervalInt, err := strconv.Atoi(volumeStatsIntervalEnv)
+	if err != nil {
+		fmt.Println("Parsing error, VOLUME_STATS_INTERVAL must be an integer in seconds.")
+		os.Exit(1)
+	}
+
+	kubeAPITimeoutInt, err := strconv.Atoi(kubeAPITimeoutEnv)
+	if err != nil {
+		fmt.Println("Parsing error, KUBE_API_TIMEOUT must be an integer in seconds.")
+		os.Exit(1)
+	}
+
 	var (
-		ip               = flag.String("ip", ipEnv, "Server IP address to bind to.")
-		port             = flag.String("port", portEnv, "Server port.")
-		metricsPort      = flag.String("metricsPort", metricsPortEnv, "Metrics port.")
-		mode             = flag.String("mode", modeEnv, "debug or release")
-		httpReadTimeout  = flag.Int("httpReadTimeout", httpReadTimeoutInt, "HTTP read timeout")
-		httpWriteTimeout = flag.Int("httpWriteTimeout", httpWriteTimeoutInt, "HTTP write timeout")
-		pvcNamespace     = flag.String("pvcNamespace", pvcNamespaceEnv, "PVC Namespace")
-		pvcSelector      = flag.String("pvcSelector", pvcSelectorEnv, "PVC Selector")
+		ip                    = flag.String("ip", ipEnv, "Server IP address to bind to.")
+		port                  = flag.String("port", portEnv, "Server port.")
+		metricsPort           = flag.String("metricsPort", metricsPortEnv, "Metrics port.")
+		mode                  = flag.String("mode", modeEnv, "debug or release")
+		httpReadTimeout       = flag.Int("httpReadTimeout", httpReadTimeoutInt, "HTTP read timeout")
+		httpWriteTimeout      = flag.Int("httpWriteTimeout", httpWriteTimeoutInt, "HTTP write timeout")
+		pvcNamespace          = flag.String("pvcNamespace", pvcNamespaceEnv, "PVC Namespace")
+		pvcSelector           = flag.String("pvcSelector", pvcSelectorEnv, "PVC Selector")
+		pvcAnnotationSelector = flag.String("pvcAnnotationSelector", pvcAnnotationSelectorEnv, "PVC annotation selector, key=value pairs PVC annotations must match")
+		lastUsedInterval      = flag.Int("lastUsedInterval", lastUsedIntervalInt, "Seconds between last-used annotation stamps, 0 disables")
+		lastUsedQPS           = flag.Float64("lastUsedQPS", lastUsedQPSFloat, "Max last-used annotation patches per second")
+		tlsCertFile           = flag.String("tlsCertFile", tlsCertFileEnv, "TLS certificate file, enables HTTPS on the API and metrics ports with tlsKeyFile, reloaded when changed")
+		tlsKeyFile            = flag.String("tlsKeyFile", tlsKeyFileEnv, "TLS key file, enables HTTPS on the API and metrics ports with tlsCertFile")
+		tlsMinVersion         = flag.String("tlsMinVersion", tlsMinVersionEnv, "Minimum TLS version: 1.0, 1.1, 1.2 or 1.3")
+		tlsClientCAFile       = flag.String("tlsClientCAFile", tlsClientCAFileEnv, "CA file for verifying client certificates (mTLS)")
+		retentionTTL          = flag.String("retentionTTL", retentionTTLEnv, "Delete PVCs unused for longer than this duration (e.g. 168h), empty disables")
+		retentionInterval     = flag.String("retentionInterval", retentionIntervalEnv, "Duration between retention scans")
+		retentionDryRun       = flag.Bool("retentionDryRun", retentionDryRunEnv == "true", "Log PVCs retention would delete without deleting them")
+		apiTokens             = flag.String("apiTokens", apiTokensEnv, "Comma separated token or token:role (read or admin) pairs required on vol/ routes, empty disables auth")
+		protectTokens         = flag.String("protectTokens", protectTokensEnv, "Comma separated API tokens required to remove PVC protection, empty uses apiTokens")
+		readOnly              = flag.Bool("readOnly", readOnlyEnv == "true", "Reject every operation that would modify a PVC")
+		bulkDeleteLimit       = flag.Int("bulkDeleteLimit", bulkDeleteLimitInt, "Max PVCs a bulk delete may match")
+		resyncPeriod          = flag.Int("resyncPeriod", resyncPeriodInt, "Informer resync period in seconds, 0 disables resyncs")
+		pvcPhaseFilter        = flag.String("pvcPhaseFilter", pvcPhaseFilterEnv, "Comma separated PVC phases to watch (e.g. Bound,Pending), empty watches all")
+		auditLogFile          = flag.String("auditLogFile", auditLogFileEnv, "File to write audit entries to, defaults to the service log")
+		volumeStats           = flag.Bool("volumeStats", volumeStatsEnv == "true", "Report kubelet volume capacity and usage")
+		volumeStatsTTL        = flag.Int("volumeStatsTTL", volumeStatsTTLInt, "Seconds to reuse a PVC list with kubelet volume stats")
+		volumeStatsInterval   = flag.Int("volumeStatsInterval", volumeStatsIntervalInt, "Seconds between background kubelet volume stats collections")
+		corsAllowedOrigins    = flag.String("corsAllowedOrigins", corsAllowedOriginsEnv, "Comma separated origins allowed to make CORS requests, * allows any, empty disables CORS")
+		corsAllowedMethods    = flag.String("corsAllowedMethods", corsAllowedMethodsEnv, "Comma separated methods allowed in CORS requests, empty allows GET, POST, PATCH, DELETE and OPTIONS")
+		corsAllowedHeaders    = flag.String("corsAllowedHeaders", corsAllowedHeadersEnv, "Comma separated headers allowed in CORS requests, empty allows Authorization, Content-Type and X-API-Key")
+		corsAllowCredentials  = flag.Bool("corsAllowCredentials", corsAllowCredentialsEnv == "true", "Allow credentialed CORS requests, invalid with the * origin")
+		kubeAPITimeout        = flag.Int("kubeAPITimeout", kubeAPITimeoutInt, "Seconds each live Kubernetes API call may take")
+		authToken             = flag.String("authToken", authTokenEnv, "Single admin bearer token required on vol/ routes, combined with apiTokens")
+		deletableNamespaces   = flag.String("deletableNamespaces", deletableNamespacesEnv, "Comma separated namespaces PVCs may be deleted in, empty allows all")
+		informerResync        = flag.String("informerResync", informerResyncEnv, "Deprecated, use resyncPeriod. Informer resync period as a duration (e.g. 10m), overrides resyncPeriod when set")
+		watchStorageClasses   = flag.Bool("watchStorageClasses", watchStorageClassesEnv == "true", "Watch StorageClasses to include provisioners in the vol/-/storageclasses usage")
+		watchPVs              = flag.Bool("watchPersistentVolumes", watchPVsEnv == "true", "Watch PersistentVolumes to flag PVCs bound to a missing, Released or Failed PV")
+		staleAfter            = flag.String("staleAfter", staleAfterEnv, "Duration a store may go without an informer event before /healthz and /readyz fail, defaults to three resync periods")
+		eventsCacheTTL        = flag.String("eventsCacheTTL", eventsCacheTTLEnv, "Duration PVC events are cached for events=true and vol/:name/events, 0 disables caching")
+		webhookURL            = flag.String("webhookURL", webhookURLEnv, "Webhook URL notified when PVCs start terminating, stay Pending or are deleted, empty disables")
+		webhookTemplate       = flag.String("webhookTemplate", webhookTemplateEnv, "Go text/template rendering the webhook body, the JSON notification is sent when empty")
+		deleteRetries         = flag.Int("deleteRetries", deleteRetriesInt, "Times a PVC delete is retried on conflicts, server timeouts and throttling")
+		deleteRetryBackoff    = flag.String("deleteRetryBackoff", deleteRetryBackoffEnv, "Delay before the first delete retry, doubled for each retry")
+		configFile            = flag.String("config", configFileEnv, "YAML or JSON file of settings keyed by flag name, flags and environment variables take precedence")
+		pvcTemplatesFile      = flag.String("pvcTemplatesFile", pvcTemplatesFileEnv, "YAML or JSON file of PVC templates keyed by name, served at templates/")
+		kubeconfig            = flag.String("kubeconfig", "", "Kubeconfig file, defaults to KUBECONFIG or ~/.kube/config, the in-cluster config is used when none exist")
+		kubeContext           = flag.String("context", kubeContextEnv, "Kubeconfig context, defaults to the current context")
+		rateLimitRPS          = flag.Float64("rateLimitRPS", rateLimitRPSFloat, "Mutating requests per second allowed per client, 0 disables rate limiting")
+		rateLimitBurst        = flag.Int("rateLimitBurst", rateLimitBurstInt, "Mutating requests a client may burst above rateLimitRPS")
+		gzipMinSize           = flag.Int("gzipMinSize", gzipMinSizeInt, "Minimum response size in bytes compressed for clients accepting gzip, negative disables compression")
+		enablePprof           = flag.Bool("enablePprof", enablePprofEnv == "true", "Serve net/http/pprof profiles on the metrics port under /debug/pprof")
 	)
 	flag.Parse()
 
+	if *configFile != "" {
+		if err := applyConfigFile(*configFile); err != nil {
+			fmt.Printf("Config file error, %s: %s\n", *configFile, err.Error())
+			os.Exit(1)
+		}
+	}
+
 	// add some useful info to metrics
 	promauto.NewCounter(prometheus.CounterOpts{
 		Namespace: Service + "_service",
@@ -92,17 +260,20 @@ func main() {
 		zap.String("ip", *ip),
 	)
 
-	// Kubernetes
-	kubeconfig := filepath.Join(
-		os.Getenv("HOME"), ".kube", "config",
-	)
+	// Kubernetes, from -kubeconfig, KUBECONFIG or ~/.kube/config
+	// and falling back to the in-cluster config when none exist
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = *kubeconfig
 
-	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
-	if err != nil {
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		loadingRules,
+		&clientcmd.ConfigOverrides{CurrentContext: *kubeContext},
+	).ClientConfig()
+	if clientcmd.IsEmptyConfig(err) {
 		config, err = rest.InClusterConfig()
-		if err != nil {
-			log.Fatal("Unable to load configuration")
-		}
+	}
+	if err != nil {
+		logger.Fatal("Unable to load Kubernetes configuration", zap.Error(err))
 	}
 
 	cs, err := kubernetes.NewForConfig(config)
@@ -110,19 +281,141 @@ func main() {
 		logger.Fatal("unable to kubernetes.NewForConfig", zap.Error(err))
 	}
 
+	dc, err := dynamic.NewForConfig(config)
+	if err != nil {
+		logger.Fatal("unable to dynamic.NewForConfig", zap.Error(err))
+	}
+
+	// audit entries go to the service log unless a file is set
+	auditLogger := logger
+	if *auditLogFile != "" {
+		auditCfg := zap.NewProductionConfig()
+		auditCfg.OutputPaths = []string{*auditLogFile}
+		auditLogger, err = auditCfg.Build()
+		if err != nil {
+			logger.Fatal("Can not build audit logger", zap.Error(err))
+		}
+	}
+
+	var phaseFilter []v1.PersistentVolumeClaimPhase
+	for _, phase := range splitList(*pvcPhaseFilter) {
+		phaseFilter = append(phaseFilter, v1.PersistentVolumeClaimPhase(phase))
+	}
+
+	tokens, err := volm.ParseTokenRoles(splitList(*apiTokens))
+	if err != nil {
+		logger.Fatal("Parsing error, API_TOKENS must be token or token:role pairs.", zap.Error(err))
+	}
+
+	if *authToken != "" {
+		tokens[*authToken] = volm.RoleAdmin
+	}
+
+	resync := time.Duration(*resyncPeriod) * time.Second
+
+	// INFORMER_RESYNC is deprecated in favor of RESYNC_PERIOD,
+	// it still wins when set so existing deployments keep working
+	if *informerResync != "" {
+		logger.Warn("INFORMER_RESYNC is deprecated, use RESYNC_PERIOD in seconds, 0 disables resyncs")
+		resync, err = time.ParseDuration(*informerResync)
+		if err != nil {
+			logger.Fatal("Parsing error, INFORMER_RESYNC must be a duration.", zap.Error(err))
+		}
+	}
+
+	var staleAfterDuration time.Duration
+	if *staleAfter != "" {
+		staleAfterDuration, err = time.ParseDuration(*staleAfter)
+		if err != nil {
+			logger.Fatal("Parsing error, STALE_AFTER must be a duration.", zap.Error(err))
+		}
+	}
+
+	eventsCacheDuration, err := time.ParseDuration(*eventsCacheTTL)
+	if err != nil {
+		logger.Fatal("Parsing error, EVENTS_CACHE_TTL must be a duration.", zap.Error(err))
+	}
+
+	retryBackoff, err := time.ParseDuration(*deleteRetryBackoff)
+	if err != nil {
+		logger.Fatal("Parsing error, DELETE_RETRY_BACKOFF must be a duration.", zap.Error(err))
+	}
+
+	// PVC templates are optional
+	var templates map[string]volm.PVCTemplate
+	if *pvcTemplatesFile != "" {
+		templates, err = volm.LoadPVCTemplates(*pvcTemplatesFile)
+		if err != nil {
+			logger.Fatal("Error loading PVC_TEMPLATES_FILE.", zap.Error(err))
+		}
+	}
+
 	// get api
 	api, err := volm.NewApi(&volm.Config{
-		Service:      Service,
-		Version:      Version,
-		Log:          logger,
-		Cs:           cs,
-		PVCNamespace: *pvcNamespace,
-		PVCSelector:  *pvcSelector,
+		Service:               Service,
+		Version:               Version,
+		Mode:                  *mode,
+		Log:                   logger,
+		Cs:                    cs,
+		DynamicClient:         dc,
+		PVCNamespace:          *pvcNamespace,
+		PVCSelector:           *pvcSelector,
+		PVCAnnotationSelector: *pvcAnnotationSelector,
+		WebhookURL:            *webhookURL,
+		WebhookTemplate:       *webhookTemplate,
+
+		LastUsedInterval:       time.Duration(*lastUsedInterval) * time.Second,
+		LastUsedQPS:            float32(*lastUsedQPS),
+		ReadOnly:               *readOnly,
+		BulkDeleteLimit:        *bulkDeleteLimit,
+		DeleteRetries:          *deleteRetries,
+		DeleteRetryBackoff:     retryBackoff,
+		ResyncPeriod:           resync,
+		DisableResync:          resync == 0,
+		StaleAfter:             staleAfterDuration,
+		EventsCacheTTL:         eventsCacheDuration,
+		WatchStorageClasses:    *watchStorageClasses,
+		WatchPersistentVolumes: *watchPVs,
+		PVCPhaseFilter:         phaseFilter,
+		AuditLog:               auditLogger,
+		VolumeStats:            *volumeStats,
+		VolumeStatsTTL:         time.Duration(*volumeStatsTTL) * time.Second,
+		VolumeStatsInterval:    time.Duration(*volumeStatsInterval) * time.Second,
+		APITokens:              tokens,
+		ProtectTokens:          splitList(*protectTokens),
+		Templates:              templates,
+		KubeAPITimeout:         time.Duration(*kubeAPITimeout) * time.Second,
+		DeletableNamespaces:    splitList(*deletableNamespaces),
 	})
 	if err != nil {
 		logger.Fatal("Error getting API.", zap.Error(err))
 	}
 
+	// retention controller is disabled unless a TTL is set
+	var retention *volm.RetentionController
+	if *retentionTTL != "" {
+		ttl, err := time.ParseDuration(*retentionTTL)
+		if err != nil {
+			logger.Fatal("Parsing error, RETENTION_TTL must be a duration.", zap.Error(err))
+		}
+
+		interval, err := time.ParseDuration(*retentionInterval)
+		if err != nil {
+			logger.Fatal("Parsing error, RETENTION_INTERVAL must be a duration.", zap.Error(err))
+		}
+
+		retention, err = volm.NewRetentionController(api, volm.RetentionConfig{
+			TTL:      ttl,
+			DryRun:   *retentionDryRun,
+			Interval: interval,
+		})
+		if err != nil {
+			logger.Fatal("Error getting retention controller.", zap.Error(err))
+		}
+
+		retention.Run()
+	}
+
 	gin.SetMode(gin.ReleaseMode)
 	if *mode == "debug" {
 		gin.SetMode(gin.DebugMode)
@@ -131,8 +424,11 @@ func main() {
 	// gin router
 	r := gin.New()
 
-	// gin zap logger middleware
-	r.Use(ginzap.Ginzap(logger, time.RFC3339, true))
+	// request IDs from X-Request-ID, or generated
+	r.Use(volm.RequestIDMiddleware())
+
+	// access log, tagged with the request ID
+	r.Use(volm.AccessLogMiddleware(logger))
 
 	// gin prometheus middleware
 	p := ginprometheus.NewPrometheus("http_gin")
@@ -148,30 +444,94 @@ func main() {
 	}
 	p.Use(r)
 
-	// status
-	r.GET("/", api.OkHandler(Version, *mode, Service))
+	// gzip GET responses, disabled when negative
+	if *gzipMinSize >= 0 {
+		r.Use(volm.GzipMiddleware(*gzipMinSize))
+	}
+
+	// CORS for browser clients, disabled when no origins are set
+	if origins := splitList(*corsAllowedOrigins); len(origins) > 0 {
+		corsConfig := volm.CORSConfig{
+			AllowedOrigins:   origins,
+			AllowedMethods:   splitList(*corsAllowedMethods),
+			AllowedHeaders:   splitList(*corsAllowedHeaders),
+			AllowCredentials: *corsAllowCredentials,
+		}
+
+		if err := corsConfig.Validate(); err != nil {
+			logger.Fatal("Configuration error, CORS_ALLOW_CREDENTIALS can not be used with CORS_ALLOWED_ORIGINS=*.", zap.Error(err))
+		}
+
+		r.Use(volm.CORSMiddleware(corsConfig))
+	}
+
+	// per client limit on DELETE, POST and PATCH requests
+	if *rateLimitRPS > 0 {
+		r.Use(api.RateLimitMiddleware(*rateLimitRPS, *rateLimitBurst))
+	}
+
+	// vol/ routes are served under /v1, unprefixed
+	// paths remain as deprecated aliases
+	api.RegisterRoutes(r, volm.APIPrefix)
 
-	// list PVCs
-	r.GET("vol/", api.ListPVCHandler())
+	// both servers share one TLS config, its certificate is
+	// reloaded when the files change or on SIGHUP
+	if (*tlsCertFile == "") != (*tlsKeyFile == "") {
+		logger.Fatal("Configuration error, TLS_CERT_FILE and TLS_KEY_FILE must be set together.")
+	}
 
-	// get PVC
-	r.GET("vol/:name", api.GetPVCHandler())
+	useTLS := *tlsCertFile != ""
+	var tlsConfig *tls.Config
+	if useTLS {
+		certs, err := volm.NewCertReloader(*tlsCertFile, *tlsKeyFile, logger)
+		if err != nil {
+			logger.Fatal("Error loading TLS certificate.", zap.Error(err))
+		}
 
-	// delete PVC
-	r.DELETE("vol/:name", api.DeletePVCHandler())
+		tlsConfig, err = volm.NewTLSConfig(*tlsMinVersion, *tlsClientCAFile)
+		if err != nil {
+			logger.Fatal("Error configuring TLS.", zap.Error(err))
+		}
+		tlsConfig.GetCertificate = certs.GetCertificate
+
+		certs.ReloadOnSignal(api.Stopper, syscall.SIGHUP)
+	}
 
 	// metrics server (run in go routine)
 	go func() {
-		http.Handle("/metrics", promhttp.Handler())
+		// a dedicated mux, importing net/http/pprof registers
+		// its handlers on http.DefaultServeMux
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("/metrics", promhttp.Handler())
+
+		if *enablePprof {
+			metricsMux.HandleFunc("/debug/pprof/", pprof.Index)
+			metricsMux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+			metricsMux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+			metricsMux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+			metricsMux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+		}
 
 		logger.Info("Starting "+Service+" Metrics Server",
 			zap.String("version", Version),
 			zap.String("type", "metrics_startup"),
 			zap.String("port", *metricsPort),
 			zap.String("ip", *ip),
+			zap.Bool("pprof", *enablePprof),
+			zap.Bool("tls", useTLS),
 		)
 
-		err = http.ListenAndServe(*ip+":"+*metricsPort, nil)
+		ms := &http.Server{
+			Addr:    *ip + ":" + *metricsPort,
+			Handler: metricsMux,
+		}
+
+		if useTLS {
+			ms.TLSConfig = tlsConfig.Clone()
+			err = ms.ListenAndServeTLS("", "")
+		} else {
+			err = ms.ListenAndServe()
+		}
 		if err != nil {
 			logger.Fatal("Error Starting "+Service+" Metrics Server", zap.Error(err))
 			os.Exit(1)
@@ -186,10 +546,163 @@ func main() {
 		MaxHeaderBytes: 1 << 20, // 1 MB
 	}
 
-	err = s.ListenAndServe()
+	if useTLS {
+		s.TLSConfig = tlsConfig.Clone()
+
+		logger.Info("Serving "+Service+" API Server over TLS",
+			zap.String("cert_file", *tlsCertFile),
+			zap.String("min_version", *tlsMinVersion),
+			zap.Bool("mtls", *tlsClientCAFile != ""),
+		)
+	}
+
+	go func() {
+		var err error
+		if useTLS {
+			// certificates come from TLSConfig.GetCertificate
+			err = s.ListenAndServeTLS("", "")
+		} else {
+			err = s.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			logger.Fatal(err.Error())
+		}
+	}()
+
+	// wait for a shutdown signal
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	<-sig
+
+	logger.Info("Shutting down "+Service+" API Server", zap.String("type", "server_shutdown"))
+
+	if retention != nil {
+		retention.Stop()
+	}
+	close(api.Stopper)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err = s.Shutdown(ctx)
 	if err != nil {
-		logger.Fatal(err.Error())
+		logger.Error("Error shutting down "+Service+" API Server", zap.Error(err))
+	}
+}
+
+// applyConfigFile sets flags from a YAML or JSON file keyed by flag
+// name. Flags given on the command line or through their environment
+// variable are left alone, lists are joined with commas.
+func applyConfigFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	settings := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, &settings); err != nil {
+		return fmt.Errorf("malformed file: %w", err)
+	}
+
+	explicit := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	keys := make([]string, 0, len(settings))
+	for k := range settings {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		f := flag.Lookup(k)
+		if f == nil || k == "config" {
+			return fmt.Errorf("unknown setting %s", k)
+		}
+
+		value, err := configValue(settings[k])
+		if err != nil {
+			return fmt.Errorf("setting %s: %w", k, err)
+		}
+
+		if explicit[k] || os.Getenv(envName(k)) != "" {
+			continue
+		}
+
+		if err := f.Value.Set(value); err != nil {
+			return fmt.Errorf("setting %s: %w", k, err)
+		}
+	}
+
+	return nil
+}
+
+// configValue converts a config file value to a flag value
+func configValue(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			s, err := configValue(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, s)
+		}
+		return strings.Join(items, ","), nil
+	case nil:
+		return "", nil
+	}
+
+	return "", fmt.Errorf("unsupported value %v", v)
+}
+
+// envNameOverrides holds the flags whose environment
+// variable is not derived from the flag name.
+var envNameOverrides = map[string]string{
+	"context": "KUBE_CONTEXT",
+}
+
+// envName returns the environment variable of a flag,
+// for example kubeAPITimeout is KUBE_API_TIMEOUT.
+func envName(flagName string) string {
+	if name, ok := envNameOverrides[flagName]; ok {
+		return name
+	}
+
+	var b strings.Builder
+	for i, r := range flagName {
+		if unicode.IsUpper(r) && i > 0 {
+			prevLower := unicode.IsLower(rune(flagName[i-1]))
+			nextLower := i+1 < len(flagName) && unicode.IsLower(rune(flagName[i+1]))
+			if prevLower || nextLower {
+				b.WriteRune('_')
+			}
+		}
+		b.WriteRune(unicode.ToUpper(r))
 	}
+
+	return b.String()
+}
+
+// splitList splits a comma separated list
+// dropping empty entries.
+func splitList(items string) []string {
+	var list []string
+	for _, item := range strings.Split(items, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+
+	return list
 }
 
 // getEnv gets an environment variable or sets a default if
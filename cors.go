@@ -0,0 +1,125 @@
+package volm
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Default CORS methods and headers used when CORSConfig
+// leaves them empty.
+var (
+	DefaultCORSMethods = []string{"GET", "POST", "PATCH", "DELETE", "OPTIONS"}
+	DefaultCORSHeaders = []string{"Authorization", "Content-Type", "X-API-Key"}
+)
+
+const corsMaxAge = "600"
+
+const corsExposeHeaders = "ETag, Retry-After, X-Request-ID"
+
+// CORSConfig configures CORSMiddleware
+type CORSConfig struct {
+	// AllowedOrigins may contain "*" to allow any origin
+	AllowedOrigins []string
+
+	// AllowedMethods defaults to DefaultCORSMethods
+	AllowedMethods []string
+
+	// AllowedHeaders defaults to DefaultCORSHeaders
+	AllowedHeaders []string
+
+	// AllowCredentials lets browsers send cookies and
+	// Authorization headers, it can not be combined with "*"
+	AllowCredentials bool
+}
+
+// Validate returns an error for a configuration browsers would
+// reject, credentials are never allowed for a wildcard origin.
+func (cfg CORSConfig) Validate() error {
+	if !cfg.AllowCredentials {
+		return nil
+	}
+
+	for _, origin := range cfg.AllowedOrigins {
+		if origin == "*" {
+			return fmt.Errorf("CORS credentials can not be allowed for the wildcard origin")
+		}
+	}
+
+	return nil
+}
+
+// CORSMiddleware returns gin middleware setting the
+// Access-Control-Allow-* headers for requests from one of the
+// allowed origins. OPTIONS preflight requests are answered
+// directly with a 204 without reaching the route handlers.
+// Call Validate on cfg first, CORSMiddleware does not.
+func CORSMiddleware(cfg CORSConfig) gin.HandlerFunc {
+	allowAny := false
+	allowed := make(map[string]bool, len(cfg.AllowedOrigins))
+	for _, origin := range cfg.AllowedOrigins {
+		if origin == "*" {
+			allowAny = true
+		}
+		allowed[strings.TrimSuffix(origin, "/")] = true
+	}
+
+	methods := cfg.AllowedMethods
+	if len(methods) == 0 {
+		methods = DefaultCORSMethods
+	}
+	allowMethods := strings.ToUpper(strings.Join(methods, ", "))
+
+	headers := cfg.AllowedHeaders
+	if len(headers) == 0 {
+		headers = DefaultCORSHeaders
+	}
+	allowHeaders := strings.Join(headers, ", ")
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" {
+			c.Next()
+			return
+		}
+
+		c.Writer.Header().Add("Vary", "Origin")
+
+		if !allowAny && !allowed[origin] {
+			// let the browser enforce the missing headers
+			if c.Request.Method == http.MethodOptions {
+				c.AbortWithStatus(http.StatusNoContent)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		// browsers refuse credentials with a wildcard origin
+		h := c.Writer.Header()
+		if allowAny && !cfg.AllowCredentials {
+			h.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			h.Set("Access-Control-Allow-Origin", origin)
+		}
+
+		if cfg.AllowCredentials {
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		// let browser clients read the headers volm sets
+		h.Set("Access-Control-Expose-Headers", corsExposeHeaders)
+
+		if c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != "" {
+			h.Set("Access-Control-Allow-Methods", allowMethods)
+			h.Set("Access-Control-Allow-Headers", allowHeaders)
+			h.Set("Access-Control-Max-Age", corsMaxAge)
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,63 @@
+package volm
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCORSPreflight(t *testing.T) {
+	a, _ := testAPI(t, &Config{Cs: fake.NewSimpleClientset(testPVC("default", "data"))})
+
+	r := gin.New()
+	r.Use(CORSMiddleware(CORSConfig{AllowedOrigins: []string{"https://dash.example.com"}}))
+	a.RegisterRoutes(r, APIPrefix)
+
+	preflight := func(origin string) *http.Response {
+		w := serve(r, http.MethodOptions, "/v1/vol/data", http.Header{
+			"Origin":                         {origin},
+			"Access-Control-Request-Method":  {http.MethodDelete},
+			"Access-Control-Request-Headers": {"Authorization"},
+		})
+		return w.Result()
+	}
+
+	resp := preflight("https://dash.example.com")
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected 204 for an allowed preflight, got %d", resp.StatusCode)
+	}
+
+	for header, expected := range map[string]string{
+		"Access-Control-Allow-Origin":  "https://dash.example.com",
+		"Access-Control-Allow-Methods": "GET, POST, PATCH, DELETE, OPTIONS",
+		"Access-Control-Allow-Headers": "Authorization, Content-Type, X-API-Key",
+		"Access-Control-Max-Age":       corsMaxAge,
+		"Vary":                         "Origin",
+	} {
+		if got := resp.Header.Get(header); got != expected {
+			t.Errorf("expected %s %q, got %q", header, expected, got)
+		}
+	}
+
+	resp = preflight("https://evil.example.com")
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected 204 for a disallowed preflight, got %d", resp.StatusCode)
+	}
+
+	for _, header := range []string{"Access-Control-Allow-Origin", "Access-Control-Allow-Methods", "Access-Control-Allow-Headers"} {
+		if got := resp.Header.Get(header); got != "" {
+			t.Errorf("expected no %s for a disallowed origin, got %q", header, got)
+		}
+	}
+
+	// the actual request from an allowed origin reaches the handler
+	w := serve(r, http.MethodGet, "/v1/vol/data", http.Header{"Origin": {"https://dash.example.com"}})
+	if w.Code != http.StatusOK || w.Header().Get("Access-Control-Allow-Origin") != "https://dash.example.com" {
+		t.Errorf("expected 200 with Access-Control-Allow-Origin, got %d %q", w.Code, w.Header().Get("Access-Control-Allow-Origin"))
+	}
+	if got := w.Header().Get("Access-Control-Expose-Headers"); got != corsExposeHeaders {
+		t.Errorf("expected Access-Control-Expose-Headers %q, got %q", corsExposeHeaders, got)
+	}
+}
@@ -0,0 +1,46 @@
+package volm
+
+import (
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/tools/cache"
+)
+
+// watchPersistentVolumes starts a PV lister and invalidates the
+// list cache on PV events, which change BoundVolumeMissing.
+func (a *API) watchPersistentVolumes() {
+	informer := a.privateInformers.Core().V1().PersistentVolumes()
+	a.PVLister = informer.Lister()
+
+	invalidate := func(interface{}) { a.listCache.invalidate() }
+	informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: invalidate,
+		UpdateFunc: func(_, newObj interface{}) {
+			invalidate(newObj)
+		},
+		DeleteFunc: invalidate,
+	})
+}
+
+// setBoundVolume sets the phase of the PV a PVC is bound to and
+// flags the PVC when the PV is gone, Released or Failed, leaving
+// a dangling claim. Nothing is set unless PVs are watched.
+func (a *API) setBoundVolume(volInfo *VolumeInfo, pvc v1.PersistentVolumeClaim) {
+	if a.PVLister == nil || pvc.Spec.VolumeName == "" {
+		return
+	}
+
+	pv, err := a.PVLister.Get(pvc.Spec.VolumeName)
+	if errors.IsNotFound(err) {
+		volInfo.BoundVolumeMissing = true
+		return
+	}
+	if err != nil {
+		return
+	}
+
+	volInfo.VolumePhase = string(pv.Status.Phase)
+	if pv.Status.Phase == v1.VolumeReleased || pv.Status.Phase == v1.VolumeFailed {
+		volInfo.BoundVolumeMissing = true
+	}
+}
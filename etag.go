@@ -0,0 +1,53 @@
+package volm
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// listETag returns a weak ETag for a response built from the stores.
+// It changes with the list cache generation, bumped on every pod and
+// PVC store event, and with the path, query and Accept header
+// selecting the representation. With volume stats enabled it also
+// changes each time the cached list is rebuilt for fresh usage.
+func (a *API) listETag(c *gin.Context) string {
+	a.listCache.Lock()
+	generation := a.listCache.generation
+	computedAt := a.listCache.computedAt.UnixNano()
+	a.listCache.Unlock()
+
+	if a.VolumeStatsCache == nil {
+		computedAt = 0
+	}
+
+	h := fnv.New64a()
+	_, _ = fmt.Fprintf(h, "%d|%d|%d|%s|%s|%s", a.listCache.epoch, generation, computedAt, c.Request.URL.Path, c.Request.URL.RawQuery, c.GetHeader("Accept"))
+
+	return fmt.Sprintf(`W/"%x"`, h.Sum64())
+}
+
+// notModified writes a 304 and returns true when the
+// request If-None-Match lists etag.
+func notModified(c *gin.Context, etag string) bool {
+	for _, match := range strings.Split(c.GetHeader("If-None-Match"), ",") {
+		match = strings.TrimSpace(match)
+		if match == "*" || strings.TrimPrefix(match, "W/") == strings.TrimPrefix(etag, "W/") {
+			setETag(c, etag)
+			c.Status(http.StatusNotModified)
+			return true
+		}
+	}
+
+	return false
+}
+
+// setETag sets the ETag of a response clients
+// should revalidate before reusing.
+func setETag(c *gin.Context, etag string) {
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "no-cache")
+}
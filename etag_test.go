@@ -0,0 +1,112 @@
+package volm
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// testAPI returns a synced API built from cfg, logging nowhere and
+// watching the default namespace unless set, and a gin engine
+// serving its routes. The API is stopped at test cleanup.
+func testAPI(t *testing.T, cfg *Config) (*API, *gin.Engine) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	if cfg.Log == nil {
+		cfg.Log = zap.NewNop()
+	}
+	if cfg.PVCNamespace == "" {
+		cfg.PVCNamespace = "default"
+	}
+
+	a, err := NewApi(cfg)
+	if err != nil {
+		t.Fatalf("NewApi: %s", err)
+	}
+	t.Cleanup(func() { close(a.Stopper) })
+
+	if !a.WaitForCacheSync(a.Stopper) {
+		t.Fatal("caches did not sync")
+	}
+
+	r := gin.New()
+	a.RegisterRoutes(r, APIPrefix)
+
+	return a, r
+}
+
+// serve sends a request to r and returns the recorded response
+func serve(r http.Handler, method, path string, header http.Header) *httptest.ResponseRecorder {
+	return serveBody(r, method, path, "", header)
+}
+
+// serveBody sends a request with a JSON body to r and
+// returns the recorded response
+func serveBody(r http.Handler, method, path string, body string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, values := range header {
+		for _, v := range values {
+			req.Header.Add(k, v)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	return w
+}
+
+func TestListETagStableAcrossResync(t *testing.T) {
+	cs := fake.NewSimpleClientset(testPVC("default", "data"), testPod("default", "web", "data"))
+	_, r := testAPI(t, &Config{Cs: cs, ResyncPeriod: time.Second})
+
+	w := serve(r, http.MethodGet, "/v1/vol/", nil)
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag == "" {
+		t.Fatalf("expected 200 with an ETag, got %d %q", w.Code, etag)
+	}
+
+	// the informers resync every second, redelivering
+	// the unchanged PVC and pod as updates
+	time.Sleep(2500 * time.Millisecond)
+
+	w = serve(r, http.MethodGet, "/v1/vol/", http.Header{"If-None-Match": {etag}})
+	if w.Code != http.StatusNotModified {
+		t.Fatalf("expected 304 after resyncs, got %d", w.Code)
+	}
+
+	pvc := testPVC("default", "data")
+	pvc.Labels = map[string]string{"app": "web"}
+	pvc.ResourceVersion = "2"
+	if _, err := cs.CoreV1().PersistentVolumeClaims("default").Update(context.Background(), pvc, metaV1.UpdateOptions{}); err != nil {
+		t.Fatalf("Update: %s", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		w = serve(r, http.MethodGet, "/v1/vol/", http.Header{"If-None-Match": {etag}})
+		if w.Code == http.StatusOK {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected 200 after a PVC update, got %d", w.Code)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if w.Header().Get("ETag") == etag {
+		t.Error("expected a new ETag after a PVC update")
+	}
+}
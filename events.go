@@ -0,0 +1,185 @@
+package volm
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+// EventInfo summarizes a Kubernetes Event involving a PVC
+type EventInfo struct {
+	Type      string       `json:"type"`
+	Reason    string       `json:"reason"`
+	Message   string       `json:"message"`
+	Count     int32        `json:"count"`
+	FirstSeen *metaV1.Time `json:"firstSeen,omitempty"`
+	LastSeen  *metaV1.Time `json:"lastSeen,omitempty"`
+}
+
+func (a *API) GetPVCEventsHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		events, err := a.GetPVCEvents(requestContext(c), c.Param("name"))
+		if err != nil {
+			WriteError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, events)
+	}
+}
+
+// GetPVCEvents returns the events involving a PVC meeting the
+// selector criteria, newest first. Results are cached by PVC for
+// Config.EventsCacheTTL.
+func (a *API) GetPVCEvents(ctx context.Context, name string) ([]EventInfo, error) {
+	var uid types.UID
+	if pvc := a.PVCStore.GetPVC(name); pvc != nil {
+		uid = pvc.UID
+	}
+
+	if entry, ok := a.eventCache.get(name, uid); ok {
+		return entry.events, entry.err
+	}
+
+	events, err := a.getPVCEvents(ctx, name)
+	a.eventCache.put(name, uid, events, err, a.EventsCacheTTL)
+
+	return events, err
+}
+
+func (a *API) getPVCEvents(ctx context.Context, name string) ([]EventInfo, error) {
+	ctx, cancel := a.kubeContext(ctx)
+	defer cancel()
+	events := make([]EventInfo, 0)
+
+	pvc := a.PVCStore.GetPVC(name)
+	if pvc == nil {
+		return events, errPVCNotFound(name)
+	}
+
+	if err := a.checkSelector(pvc.ObjectMeta); err != nil {
+		return events, err
+	}
+
+	// match the UID as well so events left by an earlier
+	// PVC of the same name are not reported
+	selector := fields.Set{
+		"involvedObject.kind":      "PersistentVolumeClaim",
+		"involvedObject.name":      name,
+		"involvedObject.namespace": a.PVCNamespace,
+		"involvedObject.uid":       string(pvc.UID),
+	}.AsSelector().String()
+
+	eventList, err := a.Cs.CoreV1().Events(a.PVCNamespace).List(ctx, metaV1.ListOptions{FieldSelector: selector})
+	if err != nil {
+		a.logger(ctx).Error("GetPVCEvents got error invoking Events.List", zap.Error(err))
+		return events, err
+	}
+
+	for _, e := range eventList.Items {
+		firstSeen := e.FirstTimestamp
+		lastSeen := eventLastSeen(e)
+		if firstSeen.IsZero() {
+			firstSeen = lastSeen
+		}
+
+		count := e.Count
+		if count == 0 {
+			count = 1
+		}
+
+		events = append(events, EventInfo{
+			Type:      e.Type,
+			Reason:    e.Reason,
+			Message:   e.Message,
+			Count:     count,
+			FirstSeen: &firstSeen,
+			LastSeen:  &lastSeen,
+		})
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[j].LastSeen.Before(events[i].LastSeen)
+	})
+
+	return events, nil
+}
+
+// eventsNegativeTTL caps how long a not found
+// GetPVCEvents result is cached.
+const eventsNegativeTTL = time.Second * 5
+
+// eventCache holds GetPVCEvents results by PVC name. Entries are
+// only used while the store holds the same PVC incarnation, so a
+// PVC recreated under the same name never sees the old events.
+type eventCache struct {
+	entries map[string]eventCacheEntry
+	clock   clock.PassiveClock
+	sync.Mutex
+}
+
+type eventCacheEntry struct {
+	uid     types.UID
+	events  []EventInfo
+	err     error
+	expires time.Time
+}
+
+// get returns a copy of the unexpired entry for name
+// when it was cached for the PVC with uid.
+func (ec *eventCache) get(name string, uid types.UID) (eventCacheEntry, bool) {
+	ec.Lock()
+	defer ec.Unlock()
+
+	entry, ok := ec.entries[name]
+	if !ok || entry.uid != uid || ec.clock.Now().After(entry.expires) {
+		return eventCacheEntry{}, false
+	}
+
+	entry.events = append(make([]EventInfo, 0, len(entry.events)), entry.events...)
+
+	return entry, true
+}
+
+// put caches events for ttl and not found errors for at most
+// eventsNegativeTTL, other errors are not cached.
+func (ec *eventCache) put(name string, uid types.UID, events []EventInfo, err error, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+
+	if err != nil {
+		if ToAPIError(err).Status != http.StatusNotFound {
+			return
+		}
+		if ttl > eventsNegativeTTL {
+			ttl = eventsNegativeTTL
+		}
+	}
+
+	ec.Lock()
+	defer ec.Unlock()
+
+	if ec.entries == nil {
+		ec.entries = map[string]eventCacheEntry{}
+	}
+
+	// drop expired entries so deleted PVCs do not accumulate
+	now := ec.clock.Now()
+	for k, entry := range ec.entries {
+		if now.After(entry.expires) {
+			delete(ec.entries, k)
+		}
+	}
+
+	ec.entries[name] = eventCacheEntry{uid: uid, events: events, err: err, expires: now.Add(ttl)}
+}
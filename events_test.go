@@ -0,0 +1,209 @@
+package volm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/client-go/kubernetes/fake"
+	k8sTesting "k8s.io/client-go/testing"
+)
+
+func testEvent(name string, uid types.UID, reason string, lastSeen time.Time) *v1.Event {
+	return &v1.Event{
+		ObjectMeta: metaV1.ObjectMeta{Namespace: "default", Name: name},
+		InvolvedObject: v1.ObjectReference{
+			Kind:      "PersistentVolumeClaim",
+			Namespace: "default",
+			Name:      "data",
+			UID:       uid,
+		},
+		Type:          v1.EventTypeNormal,
+		Reason:        reason,
+		LastTimestamp: metaV1.NewTime(lastSeen),
+	}
+}
+
+// filterEventFields makes the fake clientset apply the field
+// selector of event lists, which its tracker ignores.
+func filterEventFields(cs *fake.Clientset) {
+	cs.PrependReactor("list", "events", func(action k8sTesting.Action) (bool, runtime.Object, error) {
+		selector := action.(k8sTesting.ListAction).GetListRestrictions().Fields
+		if selector == nil || selector.Empty() {
+			return false, nil, nil
+		}
+
+		obj, err := cs.Tracker().List(v1.SchemeGroupVersion.WithResource("events"), v1.SchemeGroupVersion.WithKind("Event"), action.GetNamespace())
+		if err != nil {
+			return true, nil, err
+		}
+
+		list := obj.(*v1.EventList)
+		var items []v1.Event
+		for _, e := range list.Items {
+			if selector.Matches(fields.Set{
+				"involvedObject.kind":      e.InvolvedObject.Kind,
+				"involvedObject.name":      e.InvolvedObject.Name,
+				"involvedObject.namespace": e.InvolvedObject.Namespace,
+				"involvedObject.uid":       string(e.InvolvedObject.UID),
+			}) {
+				items = append(items, e)
+			}
+		}
+		list.Items = items
+
+		return true, list, nil
+	})
+}
+
+func TestGetPVCEvents(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+
+	// an event from an earlier PVC of the same name
+	cs := fake.NewSimpleClientset(
+		testPVC("default", "data"),
+		testEvent("provisioning", "default/data", "Provisioning", now.Add(-time.Hour)),
+		testEvent("resized", "default/data", "Resized", now),
+		testEvent("bound", "default/data", "Bound", now.Add(-time.Minute)),
+		testEvent("old", "recreated", "ProvisioningFailed", now.Add(time.Minute)),
+	)
+	filterEventFields(cs)
+	_, r := testAPI(t, &Config{Cs: cs})
+
+	w := serve(r, http.MethodGet, "/v1/vol/data/events", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	events := []EventInfo{}
+	if err := json.Unmarshal(w.Body.Bytes(), &events); err != nil {
+		t.Fatalf("malformed events: %s", err)
+	}
+
+	var reasons []string
+	for _, e := range events {
+		reasons = append(reasons, e.Reason)
+	}
+	if !reflect.DeepEqual(reasons, []string{"Resized", "Bound", "Provisioning"}) {
+		t.Errorf("expected the events of this PVC newest first, got %v", reasons)
+	}
+
+	// the selector sent to the API server names the PVC UID
+	var selector fields.Selector
+	for _, action := range cs.Actions() {
+		if action.GetVerb() == "list" && action.GetResource().Resource == "events" {
+			if restrictions := action.(k8sTesting.ListAction).GetListRestrictions(); !restrictions.Fields.Empty() {
+				selector = restrictions.Fields
+			}
+		}
+	}
+	if selector == nil {
+		t.Fatal("expected an event list with a field selector")
+	}
+
+	for field, expected := range map[string]string{
+		"involvedObject.kind":      "PersistentVolumeClaim",
+		"involvedObject.name":      "data",
+		"involvedObject.namespace": "default",
+		"involvedObject.uid":       "default/data",
+	} {
+		if value, ok := selector.RequiresExactMatch(field); !ok || value != expected {
+			t.Errorf("expected the field selector to require %s=%s, got %q", field, expected, selector)
+		}
+	}
+}
+
+// eventLists counts the event lists by PVC UID, made by
+// GetPVCEvents rather than the event informer, the fake
+// clientset received.
+func eventLists(cs *fake.Clientset) int {
+	lists := 0
+	for _, action := range cs.Actions() {
+		if action.GetVerb() != "list" || action.GetResource().Resource != "events" {
+			continue
+		}
+
+		if _, ok := action.(k8sTesting.ListAction).GetListRestrictions().Fields.RequiresExactMatch("involvedObject.uid"); ok {
+			lists++
+		}
+	}
+
+	return lists
+}
+
+func TestGetPVCEventsCache(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	cs := fake.NewSimpleClientset(testPVC("default", "data"), testEvent("bound", "default/data", "Bound", now))
+	a, _ := testAPI(t, &Config{Cs: cs, EventsCacheTTL: 30 * time.Second})
+
+	fakeClock := clock.NewFakeClock(now)
+	a.eventCache.clock = fakeClock
+
+	reasons := func() []string {
+		t.Helper()
+
+		events, err := a.GetPVCEvents(context.Background(), "data")
+		if err != nil {
+			t.Fatalf("GetPVCEvents: %s", err)
+		}
+
+		var reasons []string
+		for _, e := range events {
+			reasons = append(reasons, e.Reason)
+		}
+		return reasons
+	}
+
+	reasons()
+	if _, err := cs.CoreV1().Events("default").Create(context.Background(), testEvent("resized", "default/data", "Resized", now.Add(time.Second)), metaV1.CreateOptions{}); err != nil {
+		t.Fatalf("Create: %s", err)
+	}
+
+	fakeClock.Step(29 * time.Second)
+	if got := reasons(); !reflect.DeepEqual(got, []string{"Bound"}) || eventLists(cs) != 1 {
+		t.Errorf("expected the cached Bound event from 1 list within the TTL, got %v from %d", got, eventLists(cs))
+	}
+
+	fakeClock.Step(2 * time.Second)
+	if got := reasons(); !reflect.DeepEqual(got, []string{"Resized", "Bound"}) || eventLists(cs) != 2 {
+		t.Errorf("expected Resized and Bound from a second list after the TTL, got %v from %d", got, eventLists(cs))
+	}
+}
+
+func TestEventCacheNegative(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	ec := &eventCache{clock: fakeClock}
+
+	ec.put("missing", "", nil, errPVCNotFound("missing"), time.Minute)
+	ec.put("failing", "", nil, fmt.Errorf("API server unavailable"), time.Minute)
+
+	if entry, ok := ec.get("missing", ""); !ok || ToAPIError(entry.err).Status != http.StatusNotFound {
+		t.Errorf("expected the not found result cached, got %v %v", entry.err, ok)
+	}
+
+	if _, ok := ec.get("failing", ""); ok {
+		t.Error("expected other errors not to be cached")
+	}
+
+	// not found results expire after eventsNegativeTTL, not the TTL
+	fakeClock.Step(eventsNegativeTTL + time.Second)
+	if _, ok := ec.get("missing", ""); ok {
+		t.Errorf("expected the not found result expired after %s", eventsNegativeTTL)
+	}
+
+	// an entry is only used for the PVC it was cached for
+	ec.put("data", "default/data", []EventInfo{{Reason: "Bound"}}, nil, time.Minute)
+	if _, ok := ec.get("data", "recreated"); ok {
+		t.Error("expected no cached events for a recreated PVC")
+	}
+}
@@ -0,0 +1,97 @@
+package volm
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fieldTree holds the dotted field paths requested for a
+// projection, an empty tree selects the whole value.
+type fieldTree map[string]fieldTree
+
+// parseFields parses a comma separated list of dotted JSON field
+// paths, such as "name,status.phase,usedBy.name", into a fieldTree.
+func parseFields(fields string) fieldTree {
+	tree := fieldTree{}
+
+	for _, field := range strings.Split(fields, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		node := tree
+		for _, key := range strings.Split(field, ".") {
+			if _, ok := node[key]; !ok {
+				node[key] = fieldTree{}
+			}
+			node = node[key]
+		}
+	}
+
+	return tree
+}
+
+// prune returns the parts of a decoded JSON value selected by
+// the tree, projections apply to each element of arrays.
+func (t fieldTree) prune(value interface{}) interface{} {
+	if len(t) == 0 {
+		return value
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		pruned := make(map[string]interface{}, len(t))
+		for key, subtree := range t {
+			if child, ok := v[key]; ok {
+				pruned[key] = subtree.prune(child)
+			}
+		}
+		return pruned
+	case []interface{}:
+		pruned := make([]interface{}, 0, len(v))
+		for _, child := range v {
+			pruned = append(pruned, t.prune(child))
+		}
+		return pruned
+	}
+
+	return value
+}
+
+// ProjectFields reduces v to the comma separated dotted JSON
+// field paths in fields, for example "name,status.phase,usedBy".
+func ProjectFields(v interface{}, fields string) (interface{}, error) {
+	js, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var decoded interface{}
+	if err := json.Unmarshal(js, &decoded); err != nil {
+		return nil, err
+	}
+
+	return parseFields(fields).prune(decoded), nil
+}
+
+// writeProjected writes v as a 200 JSON response reduced to
+// the fields query parameter when present.
+func writeProjected(c *gin.Context, v interface{}) {
+	fields := c.Query("fields")
+	if fields == "" {
+		c.JSON(http.StatusOK, v)
+		return
+	}
+
+	projected, err := ProjectFields(v, fields)
+	if err != nil {
+		WriteError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, projected)
+}
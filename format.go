@@ -0,0 +1,187 @@
+package volm
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// Response formats selected by the format query parameter
+// or the Accept header.
+const (
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+	FormatCSV  = "csv"
+
+	// FormatNDJSON writes one JSON object per line, the
+	// PVC list is streamed as each PVC is built.
+	FormatNDJSON = "ndjson"
+)
+
+// volumeCSVColumns is the stable CSV column set, one row per PVC:
+// name, namespace, phase, storage capacity, storage class, volume
+// mode, number of pods using the PVC and whether it is terminating.
+var volumeCSVColumns = []string{
+	"name",
+	"namespace",
+	"phase",
+	"capacity",
+	"storageClass",
+	"volumeMode",
+	"usedBy",
+	"terminating",
+}
+
+// negotiateFormat returns the format query parameter when set,
+// otherwise the first format the Accept header names,
+// defaulting to FormatJSON.
+func negotiateFormat(c *gin.Context) (string, error) {
+	if f := c.Query("format"); f != "" {
+		switch f {
+		case FormatJSON, FormatYAML, FormatCSV, FormatNDJSON:
+			return f, nil
+		}
+		return "", errBadRequest("unsupported format %s, must be json, yaml, csv or ndjson", f)
+	}
+
+	for _, accept := range strings.Split(c.GetHeader("Accept"), ",") {
+		mediaType := strings.TrimSpace(strings.Split(accept, ";")[0])
+		switch mediaType {
+		case "application/json":
+			return FormatJSON, nil
+		case "application/yaml", "application/x-yaml", "text/yaml":
+			return FormatYAML, nil
+		case "text/csv":
+			return FormatCSV, nil
+		case "application/x-ndjson":
+			return FormatNDJSON, nil
+		}
+	}
+
+	return FormatJSON, nil
+}
+
+// writeVolumes writes v, a VolumeInfo or list of them, in the
+// negotiated format. CSV rows are built from vols, JSON and YAML
+// honor the fields query parameter.
+func writeVolumes(c *gin.Context, v interface{}, vols []VolumeInfo) {
+	format, err := negotiateFormat(c)
+	if err != nil {
+		WriteError(c, err)
+		return
+	}
+
+	if format == FormatCSV {
+		writeVolumeCSV(c, vols)
+		return
+	}
+
+	if format == FormatYAML {
+		writeYAML(c, v)
+		return
+	}
+
+	if format == FormatNDJSON {
+		writeNDJSON(c, vols)
+		return
+	}
+
+	writeProjected(c, v)
+}
+
+// writeNDJSON writes a line of JSON for each VolumeInfo reduced
+// to the fields query parameter when present.
+func writeNDJSON(c *gin.Context, vols []VolumeInfo) {
+	fields := c.Query("fields")
+
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	for _, vol := range vols {
+		if err := writeNDJSONLine(enc, vol, fields); err != nil {
+			WriteError(c, err)
+			return
+		}
+	}
+
+	c.Data(http.StatusOK, "application/x-ndjson", buf.Bytes())
+}
+
+// writeNDJSONLine encodes vol, projected to fields when set,
+// followed by a newline.
+func writeNDJSONLine(enc *json.Encoder, vol interface{}, fields string) error {
+	if fields == "" {
+		return enc.Encode(vol)
+	}
+
+	projected, err := ProjectFields(vol, fields)
+	if err != nil {
+		return err
+	}
+
+	return enc.Encode(projected)
+}
+
+// writeYAML writes v as a 200 YAML response reduced to the
+// fields query parameter when present.
+func writeYAML(c *gin.Context, v interface{}) {
+	if fields := c.Query("fields"); fields != "" {
+		projected, err := ProjectFields(v, fields)
+		if err != nil {
+			WriteError(c, err)
+			return
+		}
+		v = projected
+	}
+
+	// sigs.k8s.io/yaml honors json tags
+	out, err := yaml.Marshal(v)
+	if err != nil {
+		WriteError(c, err)
+		return
+	}
+
+	c.Data(http.StatusOK, "application/yaml; charset=utf-8", out)
+}
+
+// writeVolumeCSV writes a header row of volumeCSVColumns and
+// a row for each VolumeInfo, encoding/csv quotes values
+// containing commas, quotes or newlines.
+func writeVolumeCSV(c *gin.Context, vols []VolumeInfo) {
+	c.Status(http.StatusOK)
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+
+	w := csv.NewWriter(c.Writer)
+	_ = w.Write(volumeCSVColumns)
+
+	for _, vol := range vols {
+		capacity := ""
+		if q, ok := vol.Status.Capacity[v1.ResourceStorage]; ok {
+			capacity = q.String()
+		}
+
+		storageClass := ""
+		if vol.Spec.StorageClassName != nil {
+			storageClass = *vol.Spec.StorageClassName
+		}
+
+		_ = w.Write([]string{
+			vol.Name,
+			vol.Namespace,
+			string(vol.Status.Phase),
+			capacity,
+			storageClass,
+			vol.VolumeMode,
+			strconv.Itoa(len(vol.UsedBy)),
+			strconv.FormatBool(vol.Terminating),
+		})
+	}
+
+	w.Flush()
+}
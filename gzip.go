@@ -0,0 +1,169 @@
+package volm
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultGzipMinSize is the response size in bytes below
+// which GzipMiddleware sends responses uncompressed.
+const DefaultGzipMinSize = 1024
+
+var gzipWriterPool = sync.Pool{
+	New: func() interface{} {
+		return gzip.NewWriter(nil)
+	},
+}
+
+// GzipMiddleware returns gin middleware compressing GET responses
+// for clients sending Accept-Encoding: gzip. Responses are buffered
+// until they reach minSize bytes, smaller responses are sent as is
+// since compressing them costs more than it saves. Streamed responses
+// are compressed from their first flush.
+func GzipMiddleware(minSize int) gin.HandlerFunc {
+	if minSize < 0 {
+		minSize = DefaultGzipMinSize
+	}
+
+	return func(c *gin.Context) {
+		if c.Request.Method != http.MethodGet || !acceptsGzip(c.Request) {
+			c.Next()
+			return
+		}
+
+		gw := &gzipResponseWriter{ResponseWriter: c.Writer, minSize: minSize}
+		c.Writer = gw
+		c.Header("Vary", "Accept-Encoding")
+
+		c.Next()
+
+		gw.close()
+		c.Writer = gw.ResponseWriter
+	}
+}
+
+// acceptsGzip returns true if the request Accept-Encoding
+// lists gzip without a zero quality.
+func acceptsGzip(req *http.Request) bool {
+	for _, enc := range strings.Split(req.Header.Get("Accept-Encoding"), ",") {
+		parts := strings.Split(strings.TrimSpace(enc), ";")
+		if !strings.EqualFold(parts[0], "gzip") {
+			continue
+		}
+
+		for _, param := range parts[1:] {
+			if strings.ReplaceAll(param, " ", "") == "q=0" {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	return false
+}
+
+// gzipResponseWriter buffers a response until minSize bytes are
+// written, then compresses the buffer and everything following.
+type gzipResponseWriter struct {
+	gin.ResponseWriter
+	minSize int
+	buf     bytes.Buffer
+	gz      *gzip.Writer
+
+	// decided is set once the response is being compressed
+	// or written through uncompressed
+	decided bool
+}
+
+func (w *gzipResponseWriter) Write(data []byte) (int, error) {
+	if w.decided {
+		if w.gz != nil {
+			return w.gz.Write(data)
+		}
+		return w.ResponseWriter.Write(data)
+	}
+
+	w.buf.Write(data)
+	if w.buf.Len() >= w.minSize {
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(data), nil
+}
+
+func (w *gzipResponseWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush compresses a streamed response from the first flush
+func (w *gzipResponseWriter) Flush() {
+	if !w.decided {
+		_ = w.decide(true)
+	}
+
+	if w.gz != nil {
+		_ = w.gz.Flush()
+	}
+
+	w.ResponseWriter.Flush()
+}
+
+// decide starts compressing the response, or writing it through
+// when compress is false, and writes out the buffer.
+func (w *gzipResponseWriter) decide(compress bool) error {
+	w.decided = true
+
+	// handlers may have encoded the body themselves, and
+	// bodiless statuses must stay empty
+	header := w.Header()
+	status := w.Status()
+	if header.Get("Content-Encoding") != "" || status == http.StatusNoContent || status == http.StatusNotModified {
+		compress = false
+	}
+
+	if compress {
+		header.Set("Content-Encoding", "gzip")
+		header.Del("Content-Length")
+
+		w.gz = gzipWriterPool.Get().(*gzip.Writer)
+		w.gz.Reset(w.ResponseWriter)
+	}
+
+	if w.buf.Len() == 0 {
+		return nil
+	}
+
+	var err error
+	if w.gz != nil {
+		_, err = w.gz.Write(w.buf.Bytes())
+	} else {
+		_, err = w.ResponseWriter.Write(w.buf.Bytes())
+	}
+	w.buf.Reset()
+
+	return err
+}
+
+// close writes out a response smaller than minSize uncompressed,
+// or finishes the gzip stream.
+func (w *gzipResponseWriter) close() {
+	if !w.decided {
+		_ = w.decide(false)
+		return
+	}
+
+	if w.gz != nil {
+		_ = w.gz.Close()
+		w.gz.Reset(nil)
+		gzipWriterPool.Put(w.gz)
+		w.gz = nil
+	}
+}
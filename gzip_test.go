@@ -0,0 +1,75 @@
+package volm
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestGzipMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	large := strings.Repeat("volm ", DefaultGzipMinSize)
+	small := "volm"
+
+	r := gin.New()
+	r.Use(GzipMiddleware(DefaultGzipMinSize))
+	r.GET("/large", func(c *gin.Context) { c.String(http.StatusOK, large) })
+	r.GET("/small", func(c *gin.Context) { c.String(http.StatusOK, small) })
+
+	for _, tc := range []struct {
+		name           string
+		path           string
+		acceptEncoding string
+		compressed     bool
+		body           string
+	}{
+		{name: "large with gzip", path: "/large", acceptEncoding: "gzip, deflate", compressed: true, body: large},
+		{name: "large without gzip", path: "/large", acceptEncoding: "deflate", body: large},
+		{name: "large refusing gzip", path: "/large", acceptEncoding: "gzip;q=0", body: large},
+		{name: "large without Accept-Encoding", path: "/large", body: large},
+		{name: "small with gzip", path: "/small", acceptEncoding: "gzip", body: small},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			header := http.Header{}
+			if tc.acceptEncoding != "" {
+				header.Set("Accept-Encoding", tc.acceptEncoding)
+			}
+
+			w := serve(r, http.MethodGet, tc.path, header)
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d", w.Code)
+			}
+
+			body := w.Body.String()
+			if tc.compressed {
+				if got := w.Header().Get("Content-Encoding"); got != "gzip" {
+					t.Fatalf("expected Content-Encoding gzip, got %q", got)
+				}
+				if w.Body.Len() >= len(tc.body) {
+					t.Errorf("expected the body compressed below %d bytes, got %d", len(tc.body), w.Body.Len())
+				}
+
+				gz, err := gzip.NewReader(w.Body)
+				if err != nil {
+					t.Fatalf("gzip.NewReader: %s", err)
+				}
+				data, err := ioutil.ReadAll(gz)
+				if err != nil {
+					t.Fatalf("ReadAll: %s", err)
+				}
+				body = string(data)
+			} else if got := w.Header().Get("Content-Encoding"); got != "" {
+				t.Errorf("expected no Content-Encoding, got %q", got)
+			}
+
+			if body != tc.body {
+				t.Errorf("expected the %d byte body, got %d bytes", len(tc.body), len(body))
+			}
+		})
+	}
+}
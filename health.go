@@ -0,0 +1,114 @@
+package volm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// apiServerPingTimeout bounds the API server ping made by Health
+const apiServerPingTimeout = time.Second * 2
+
+// ComponentHealth is the state of one component in a HealthReport
+type ComponentHealth struct {
+	Name      string     `json:"name"`
+	Healthy   bool       `json:"healthy"`
+	Synced    *bool      `json:"synced,omitempty"`
+	LastEvent *time.Time `json:"lastEvent,omitempty"`
+	Message   string     `json:"message,omitempty"`
+}
+
+// HealthReport is returned by HealthzHandler
+type HealthReport struct {
+	Status     bool              `json:"status"`
+	Components []ComponentHealth `json:"components"`
+}
+
+// HealthzHandler is a liveness handler reporting the pod and PVC
+// stores and API server connectivity. It responds 503 naming the
+// failing components when a store holding objects has gone longer
+// than StaleAfter without an event or the API server can not be
+// reached, so a wedged instance is restarted. Caches still syncing
+// are reported but not failed, a large initial list is not a wedge.
+func (a *API) HealthzHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		report := a.Health(c.Request.Context())
+		if report.Status {
+			c.JSON(http.StatusOK, report)
+			return
+		}
+
+		var failing []string
+		for _, comp := range report.Components {
+			if !comp.Healthy {
+				failing = append(failing, comp.Name)
+			}
+		}
+
+		apiErr := NewAPIError(http.StatusServiceUnavailable, CodeUnhealthy, fmt.Sprintf("unhealthy components: %s", strings.Join(failing, ", ")))
+		apiErr.Details = map[string]interface{}{"components": report.Components}
+		WriteError(c, apiErr)
+	}
+}
+
+// Health reports the state of the stores and pings the API server
+func (a *API) Health(ctx context.Context) HealthReport {
+	maxAge := a.staleAfter()
+
+	report := HealthReport{
+		Components: []ComponentHealth{
+			storeHealth("pvc_store", a.PVCStore.HasSynced(), a.PVCStore.LastEventTime(), a.PVCStore.Stale(maxAge), maxAge),
+			storeHealth("pod_store", a.PodStore.HasSynced(), a.PodStore.LastEventTime(), a.PodStore.Stale(maxAge), maxAge),
+			a.apiServerHealth(ctx),
+		},
+	}
+
+	report.Status = true
+	for _, comp := range report.Components {
+		report.Status = report.Status && comp.Healthy
+	}
+
+	return report
+}
+
+func storeHealth(name string, synced bool, lastEvent time.Time, stale bool, maxAge time.Duration) ComponentHealth {
+	comp := ComponentHealth{
+		Name:      name,
+		Healthy:   !stale,
+		Synced:    &synced,
+		LastEvent: &lastEvent,
+	}
+
+	if stale {
+		comp.Message = fmt.Sprintf("no informer event for longer than %s", maxAge)
+	}
+
+	return comp
+}
+
+// apiServerHealth requests the API server /version, a cheap
+// call any authenticated client may make.
+func (a *API) apiServerHealth(ctx context.Context) ComponentHealth {
+	comp := ComponentHealth{Name: "api_server", Healthy: true}
+
+	ctx, cancel := context.WithTimeout(ctx, apiServerPingTimeout)
+	defer cancel()
+
+	var err error
+	if rc := a.Cs.Discovery().RESTClient(); rc != nil {
+		err = rc.Get().AbsPath("/version").Do(ctx).Error()
+	} else {
+		// fake clientsets have no REST client
+		_, err = a.Cs.Discovery().ServerVersion()
+	}
+	if err != nil {
+		comp.Healthy = false
+		comp.Message = err.Error()
+	}
+
+	return comp
+}
@@ -0,0 +1,238 @@
+package volm
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	// retentionClaims counts PVCs evaluated by the RetentionController
+	// and the action taken for each.
+	retentionClaims = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "volm",
+		Subsystem: "retention",
+		Name:      "claims_total",
+		Help:      "PVCs evaluated by the retention controller by action (evaluated, deleted, dry_run, skipped).",
+	}, []string{"action"})
+
+	// authRequests counts requests seen by API.AuthMiddleware
+	// by the Role of the token presented.
+	authRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "volm",
+		Name:      "requests_total",
+		Help:      "Requests by token role (read, admin, unauthenticated).",
+	}, []string{"role"})
+
+	// pvcDeletes counts API.DeletePVC calls by outcome.
+	pvcDeletes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "volm",
+		Subsystem: "pvc",
+		Name:      "deletes_total",
+		Help:      "PVC deletes by result (success, error, notfound, forbidden).",
+	}, []string{"result"})
+
+	// notifications counts webhook notifications
+	// sent by the Notifier by result.
+	notifications = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "volm",
+		Subsystem: "notifier",
+		Name:      "notifications_total",
+		Help:      "Webhook notifications by result (delivered, failed, dropped).",
+	}, []string{"result"})
+
+	// volumeCapacityBytes, volumeUsedBytes, volumeAvailableBytes
+	// and volumeInodesUsed report kubelet volume stats by PVC,
+	// set by VolumeStatsCache.Collect.
+	volumeCapacityBytes = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "volm",
+		Subsystem: "volume",
+		Name:      "capacity_bytes",
+		Help:      "Kubelet reported volume filesystem capacity by PVC.",
+	}, []string{"pvc"})
+
+	volumeUsedBytes = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "volm",
+		Subsystem: "volume",
+		Name:      "used_bytes",
+		Help:      "Kubelet reported volume filesystem usage by PVC.",
+	}, []string{"pvc"})
+
+	volumeAvailableBytes = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "volm",
+		Subsystem: "volume",
+		Name:      "available_bytes",
+		Help:      "Kubelet reported volume filesystem available bytes by PVC.",
+	}, []string{"pvc"})
+
+	volumeInodesUsed = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "volm",
+		Subsystem: "volume",
+		Name:      "inodes_used",
+		Help:      "Kubelet reported volume filesystem inodes used by PVC.",
+	}, []string{"pvc"})
+
+	// storePVCCount and storePodCount track the size of
+	// the PVC and pod store maps.
+	storePVCCount = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "volm",
+		Subsystem: "store",
+		Name:      "pvc_count",
+		Help:      "PVCs held in the PVC store.",
+	})
+
+	storePodCount = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "volm",
+		Subsystem: "store",
+		Name:      "pod_count",
+		Help:      "Pods held in the pod store.",
+	})
+
+	// informerEvents counts informer event handler calls
+	// by resource (pod, pvc) and verb (add, update, delete).
+	informerEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "volm",
+		Subsystem: "informer",
+		Name:      "events_total",
+		Help:      "Informer events by resource (pod, pvc) and verb (add, update, delete).",
+	}, []string{"resource", "verb"})
+
+	// rateLimited counts mutating requests rejected by
+	// RateLimitMiddleware by method and route.
+	rateLimited = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "volm",
+		Subsystem: "ratelimit",
+		Name:      "throttled_total",
+		Help:      "Mutating requests rejected by the rate limiter by method and route.",
+	}, []string{"method", "route"})
+
+	// storeDrift counts objects corrected when a store is
+	// reconciled with its informer cache, by resource (pod, pvc).
+	storeDrift = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "volm",
+		Subsystem: "store",
+		Name:      "drift_total",
+		Help:      "Objects corrected when reconciling a store with its informer cache by resource (pod, pvc).",
+	}, []string{"resource"})
+
+	// informerWatchErrors counts informer watch failures
+	// by resource (pod, pvc).
+	informerWatchErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "volm",
+		Subsystem: "informer",
+		Name:      "watch_errors_total",
+		Help:      "Informer watch errors by resource (pod, pvc).",
+	}, []string{"resource"})
+)
+
+// deleteResult returns the pvcDeletes result label for
+// the error returned by a delete.
+func deleteResult(err error) string {
+	if err == nil {
+		return "success"
+	}
+
+	switch ToAPIError(err).Status {
+	case http.StatusNotFound:
+		return "notfound"
+	case http.StatusForbidden, http.StatusMethodNotAllowed:
+		return "forbidden"
+	}
+
+	return "error"
+}
+
+// lastEventTimer is implemented by the stores
+type lastEventTimer interface {
+	LastEventTime() time.Time
+}
+
+// lastEventCollector reports volm_store_seconds_since_last_event
+// for the most recently tracked store of each resource.
+type lastEventCollector struct {
+	desc   *prometheus.Desc
+	stores map[string]lastEventTimer
+	sync.Mutex
+}
+
+var storeLastEvent = &lastEventCollector{
+	desc: prometheus.NewDesc(
+		"volm_store_seconds_since_last_event",
+		"Seconds since the store received an informer event by resource (pod, pvc).",
+		[]string{"resource"}, nil,
+	),
+	stores: map[string]lastEventTimer{},
+}
+
+func init() {
+	prometheus.MustRegister(storeLastEvent)
+}
+
+func (lc *lastEventCollector) track(resource string, store lastEventTimer) {
+	lc.Lock()
+	lc.stores[resource] = store
+	lc.Unlock()
+}
+
+func (lc *lastEventCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- lc.desc
+}
+
+func (lc *lastEventCollector) Collect(ch chan<- prometheus.Metric) {
+	lc.Lock()
+	defer lc.Unlock()
+
+	for resource, store := range lc.stores {
+		ch <- prometheus.MustNewConstMetric(lc.desc, prometheus.GaugeValue, time.Since(store.LastEventTime()).Seconds(), resource)
+	}
+}
+
+// pendingCollector reports volm_pvc_pending_seconds for the
+// Pending PVCs meeting the selector criteria at scrape time.
+type pendingCollector struct {
+	desc *prometheus.Desc
+	api  *API
+	sync.Mutex
+}
+
+var pvcPendingSeconds = &pendingCollector{
+	desc: prometheus.NewDesc(
+		"volm_pvc_pending_seconds",
+		"Seconds PVCs meeting the selector have been Pending by PVC.",
+		[]string{"pvc"}, nil,
+	),
+}
+
+func init() {
+	prometheus.MustRegister(pvcPendingSeconds)
+}
+
+func (pc *pendingCollector) track(api *API) {
+	pc.Lock()
+	pc.api = api
+	pc.Unlock()
+}
+
+func (pc *pendingCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- pc.desc
+}
+
+func (pc *pendingCollector) Collect(ch chan<- prometheus.Metric) {
+	pc.Lock()
+	defer pc.Unlock()
+
+	if pc.api == nil || pc.api.PVCStore == nil {
+		return
+	}
+
+	for _, pvc := range pc.api.PVCStore.GetPVCs() {
+		if !pvcPending(pvc) || !pc.api.matchesSelector(pvc.ObjectMeta) {
+			continue
+		}
+
+		ch <- prometheus.MustNewConstMetric(pc.desc, prometheus.GaugeValue, time.Since(pvc.CreationTimestamp.Time).Seconds(), pvc.Name)
+	}
+}
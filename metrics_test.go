@@ -0,0 +1,110 @@
+package volm
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestStoreMetrics(t *testing.T) {
+	pvcAdds := testutil.ToFloat64(informerEvents.WithLabelValues("pvc", "add"))
+
+	cs := fake.NewSimpleClientset(
+		testPVC("default", "data"),
+		testPVC("default", "logs"),
+		testPod("default", "web", "data"),
+	)
+	testAPI(t, &Config{Cs: cs})
+
+	if count := testutil.ToFloat64(storePVCCount); count != 2 {
+		t.Errorf("expected a PVC count of 2, got %v", count)
+	}
+	if count := testutil.ToFloat64(storePodCount); count != 1 {
+		t.Errorf("expected a pod count of 1, got %v", count)
+	}
+	if adds := testutil.ToFloat64(informerEvents.WithLabelValues("pvc", "add")) - pvcAdds; adds != 2 {
+		t.Errorf("expected 2 PVC add events, got %v", adds)
+	}
+
+	if err := cs.CoreV1().PersistentVolumeClaims("default").Delete(context.Background(), "logs", metaV1.DeleteOptions{}); err != nil {
+		t.Fatalf("Delete: %s", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for testutil.ToFloat64(storePVCCount) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected a PVC count of 1 after a delete, got %v", testutil.ToFloat64(storePVCCount))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRequestMetrics(t *testing.T) {
+	cs := fake.NewSimpleClientset(testPVC("default", "data"))
+	_, r := testAPI(t, &Config{Cs: cs, APITokens: map[string]Role{"reader": RoleRead, "admin-token": RoleAdmin}})
+
+	before := map[string]float64{}
+	for _, role := range []string{"read", "admin", "unauthenticated"} {
+		before[role] = testutil.ToFloat64(authRequests.WithLabelValues(role))
+	}
+
+	serve(r, http.MethodGet, "/v1/vol/data", http.Header{"Authorization": {"Bearer reader"}})
+	serve(r, http.MethodGet, "/v1/vol/data", http.Header{"Authorization": {"Bearer reader"}})
+	serve(r, http.MethodGet, "/v1/vol/data", http.Header{"Authorization": {"Bearer admin-token"}})
+	serve(r, http.MethodGet, "/v1/vol/data", nil)
+
+	for role, expected := range map[string]float64{"read": 2, "admin": 1, "unauthenticated": 1} {
+		if got := testutil.ToFloat64(authRequests.WithLabelValues(role)) - before[role]; got != expected {
+			t.Errorf("expected %v %s requests, got %v", expected, role, got)
+		}
+	}
+}
+
+func TestDeleteMetrics(t *testing.T) {
+	labeled := testPVC("default", "data")
+	labeled.Labels = map[string]string{"app": "web"}
+
+	protected := testPVC("default", "protected")
+	protected.Labels = map[string]string{"app": "web"}
+	protected.Annotations = map[string]string{ProtectedAnnotation: "true"}
+
+	used := testPVC("default", "used")
+	used.Labels = map[string]string{"app": "web"}
+
+	cs := fake.NewSimpleClientset(labeled, protected, used, testPVC("default", "unlabeled"), testPod("default", "web", "used"))
+	_, r := testAPI(t, &Config{Cs: cs, PVCSelector: "app=web"})
+
+	for _, tc := range []struct {
+		name   string
+		path   string
+		result string
+	}{
+		{name: "deleted", path: "/v1/vol/data", result: "success"},
+		{name: "missing", path: "/v1/vol/missing", result: "notfound"},
+		{name: "outside the selector", path: "/v1/vol/unlabeled", result: "notfound"},
+		{name: "protected", path: "/v1/vol/protected", result: "forbidden"},
+		{name: "in use", path: "/v1/vol/used", result: "error"},
+	} {
+		before := map[string]float64{}
+		for _, result := range []string{"success", "error", "notfound", "forbidden"} {
+			before[result] = testutil.ToFloat64(pvcDeletes.WithLabelValues(result))
+		}
+
+		serve(r, http.MethodDelete, tc.path, nil)
+
+		for result, count := range before {
+			expected := count
+			if result == tc.result {
+				expected++
+			}
+			if got := testutil.ToFloat64(pvcDeletes.WithLabelValues(result)); got != expected {
+				t.Errorf("%s: expected %s deletes to be %v, got %v", tc.name, result, expected, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,344 @@
+package volm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"text/template"
+	"time"
+
+	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Notification events sent by the Notifier
+const (
+	NotifyTerminating = "terminating"
+	NotifyPending     = "pending"
+	NotifyDeleted     = "deleted"
+)
+
+const (
+	// DefaultNotifyPendingAfter is how long a PVC must be
+	// Pending before a NotifyPending notification is sent.
+	DefaultNotifyPendingAfter = time.Minute * 5
+
+	// DefaultNotifyTimeout bounds each webhook request.
+	DefaultNotifyTimeout = time.Second * 10
+
+	// DefaultNotifyRetries is the number of times a failed
+	// webhook request is retried.
+	DefaultNotifyRetries = 3
+
+	// DefaultNotifyBackoff is the delay before the first
+	// retry, doubled for each further retry.
+	DefaultNotifyBackoff = time.Second
+
+	// notifyQueueSize is the number of notifications buffered
+	// for delivery, further notifications are dropped.
+	notifyQueueSize = 100
+)
+
+// Notification is the webhook payload, or the data passed
+// to NotifierConfig.Template when one is set.
+type Notification struct {
+	Event     string     `json:"event"`
+	PVC       VolumeInfo `json:"pvc"`
+	Timestamp time.Time  `json:"timestamp"`
+}
+
+// NotifierConfig configures the Notifier
+type NotifierConfig struct {
+	// URL the notifications are POSTed to.
+	URL string
+
+	// Template is an optional text/template rendering the request
+	// body from a Notification, for webhooks expecting their own
+	// JSON shape such as Slack's {"text": "..."}. The Notification
+	// is sent as JSON when empty.
+	Template string
+
+	// PendingAfter defaults to DefaultNotifyPendingAfter.
+	PendingAfter time.Duration
+
+	// Timeout defaults to DefaultNotifyTimeout.
+	Timeout time.Duration
+
+	// Retries defaults to DefaultNotifyRetries.
+	Retries int
+
+	// Backoff defaults to DefaultNotifyBackoff.
+	Backoff time.Duration
+}
+
+// Notifier POSTs a Notification to a webhook when a PVC meeting
+// the selector criteria starts terminating, stays Pending for longer
+// than PendingAfter or is deleted through volm. Each event is sent
+// once per PVC, so informer resyncs do not repeat notifications.
+type Notifier struct {
+	NotifierConfig
+	api      *API
+	client   *http.Client
+	template *template.Template
+	queue    chan queuedNotification
+
+	// notified holds the events already sent for each PVC,
+	// entries are removed when the PVC leaves the store
+	notified map[types.UID]map[string]bool
+	sync.Mutex
+}
+
+// queuedNotification is a notification awaiting delivery, the
+// VolumeInfo is built by the delivery goroutine so store event
+// handlers never block.
+type queuedNotification struct {
+	event string
+	pvc   v1.PersistentVolumeClaim
+	at    time.Time
+}
+
+// NewNotifier constructs a Notifier and registers it on the PVC
+// store, call Run to start delivering notifications.
+func NewNotifier(api *API, cfg NotifierConfig) (*Notifier, error) {
+	if api == nil {
+		return nil, fmt.Errorf("must specify API")
+	}
+
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("must specify a webhook URL")
+	}
+
+	if cfg.PendingAfter <= 0 {
+		cfg.PendingAfter = DefaultNotifyPendingAfter
+	}
+
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultNotifyTimeout
+	}
+
+	if cfg.Retries < 0 {
+		return nil, fmt.Errorf("Retries must not be negative")
+	}
+
+	if cfg.Retries == 0 {
+		cfg.Retries = DefaultNotifyRetries
+	}
+
+	if cfg.Backoff <= 0 {
+		cfg.Backoff = DefaultNotifyBackoff
+	}
+
+	n := &Notifier{
+		NotifierConfig: cfg,
+		api:            api,
+		client:         &http.Client{Timeout: cfg.Timeout},
+		queue:          make(chan queuedNotification, notifyQueueSize),
+		notified:       make(map[types.UID]map[string]bool),
+	}
+
+	if cfg.Template != "" {
+		tmpl, err := template.New("webhook").Parse(cfg.Template)
+		if err != nil {
+			return nil, fmt.Errorf("malformed webhook template: %w", err)
+		}
+		n.template = tmpl
+	}
+
+	api.PVCStore.OnAdd(n.observe)
+	api.PVCStore.OnUpdate(n.observe)
+	api.PVCStore.OnDelete(func(pvc v1.PersistentVolumeClaim) {
+		n.Forget(pvc.UID)
+	})
+
+	return n, nil
+}
+
+// Run delivers queued notifications and checks for PVCs stuck
+// Pending until stop is closed.
+func (n *Notifier) Run(stop <-chan struct{}) {
+	n.api.Log.Info("Starting webhook notifier",
+		zap.Duration("pending_after", n.PendingAfter),
+		zap.Int("retries", n.Retries),
+	)
+
+	// without resyncs a PVC stuck Pending may see no further
+	// events, so the store is scanned as well
+	ticker := time.NewTicker(time.Minute)
+
+	go func() {
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				for _, pvc := range n.api.PVCStore.GetPVCs() {
+					n.observe(pvc)
+				}
+			}
+		}
+	}()
+
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case qn := <-n.queue:
+				n.deliver(stop, qn)
+			}
+		}
+	}()
+}
+
+// Notify queues the event for the PVC unless it was already sent,
+// returning false if it was a repeat or the queue is full.
+func (n *Notifier) Notify(event string, pvc v1.PersistentVolumeClaim) bool {
+	// a PVC is only deleted once, and its store delete may
+	// arrive first, so deletes are not tracked
+	if event != NotifyDeleted {
+		n.Lock()
+		if n.notified[pvc.UID][event] {
+			n.Unlock()
+			return false
+		}
+
+		if n.notified[pvc.UID] == nil {
+			n.notified[pvc.UID] = make(map[string]bool)
+		}
+		n.notified[pvc.UID][event] = true
+		n.Unlock()
+	}
+
+	select {
+	case n.queue <- queuedNotification{event: event, pvc: pvc, at: time.Now().UTC()}:
+		return true
+	default:
+		// unmark the event so a later resync can queue it again
+		if event != NotifyDeleted {
+			n.Lock()
+			delete(n.notified[pvc.UID], event)
+			n.Unlock()
+		}
+
+		notifications.WithLabelValues("dropped").Inc()
+		n.api.Log.Warn("Notification queue full, dropping notification",
+			zap.String("event", event),
+			zap.String("name", pvc.Name),
+		)
+		return false
+	}
+}
+
+// Forget clears the events sent for a PVC
+func (n *Notifier) Forget(uid types.UID) {
+	n.Lock()
+	delete(n.notified, uid)
+	n.Unlock()
+}
+
+// observe queues terminating and pending notifications
+// for a PVC seen by the store.
+func (n *Notifier) observe(pvc v1.PersistentVolumeClaim) {
+	if !n.api.matchesSelector(pvc.ObjectMeta) {
+		return
+	}
+
+	if pvc.DeletionTimestamp != nil {
+		n.Notify(NotifyTerminating, pvc)
+		return
+	}
+
+	if pvc.Status.Phase == v1.ClaimPending && time.Since(pvc.CreationTimestamp.Time) > n.PendingAfter {
+		n.Notify(NotifyPending, pvc)
+	}
+}
+
+// deliver sends the notification, retrying failures
+// with exponential backoff.
+func (n *Notifier) deliver(stop <-chan struct{}, qn queuedNotification) {
+	vol, err := n.api.volumeInfo(qn.pvc)
+	if err != nil {
+		notifications.WithLabelValues("failed").Inc()
+		n.api.Log.Error("Notifier got error invoking volumeInfo", zap.String("name", qn.pvc.Name), zap.Error(err))
+		return
+	}
+
+	body, err := n.body(Notification{Event: qn.event, PVC: vol, Timestamp: qn.at})
+	if err != nil {
+		notifications.WithLabelValues("failed").Inc()
+		n.api.Log.Error("Notifier got error rendering body", zap.String("name", qn.pvc.Name), zap.Error(err))
+		return
+	}
+
+	backoff := n.Backoff
+	for attempt := 0; ; attempt++ {
+		err = n.send(body)
+		if err == nil {
+			notifications.WithLabelValues("delivered").Inc()
+			return
+		}
+
+		if attempt >= n.Retries {
+			break
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+
+	notifications.WithLabelValues("failed").Inc()
+	n.api.Log.Error("Notifier failed to deliver notification",
+		zap.String("event", qn.event),
+		zap.String("name", qn.pvc.Name),
+		zap.Int("retries", n.Retries),
+		zap.Error(err),
+	)
+}
+
+// body renders the request body for a Notification
+func (n *Notifier) body(notification Notification) ([]byte, error) {
+	if n.template == nil {
+		return json.Marshal(notification)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := n.template.Execute(buf, notification); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// send POSTs a single webhook request
+func (n *Notifier) send(body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), n.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded %s", resp.Status)
+	}
+
+	return nil
+}
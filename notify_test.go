@@ -0,0 +1,159 @@
+package volm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// webhook returns a server answering each request with the next
+// of statuses, then 200, and counting the requests received.
+func webhook(t *testing.T, statuses ...int) (*httptest.Server, *int32) {
+	t.Helper()
+
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		i := int(atomic.AddInt32(&requests, 1)) - 1
+		if i < len(statuses) {
+			w.WriteHeader(statuses[i])
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, &requests
+}
+
+// waitNotified waits for the notifications counter of result
+// to reach count.
+func waitNotified(t *testing.T, result string, count float64) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for testutil.ToFloat64(notifications.WithLabelValues(result)) < count {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %v %s notifications, got %v", count, result, testutil.ToFloat64(notifications.WithLabelValues(result)))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestNotifierDebounce(t *testing.T) {
+	srv, requests := webhook(t)
+
+	cs := fake.NewSimpleClientset()
+	a, _ := testAPI(t, &Config{Cs: cs, ResyncPeriod: time.Second})
+
+	n, err := NewNotifier(a, NotifierConfig{URL: srv.URL})
+	if err != nil {
+		t.Fatalf("NewNotifier: %s", err)
+	}
+	n.Run(a.Stopper)
+
+	delivered := testutil.ToFloat64(notifications.WithLabelValues("delivered"))
+
+	pvc := testPVC("default", "data")
+	pvc.ResourceVersion = "1"
+	pvc.DeletionTimestamp = &metaV1.Time{Time: time.Now()}
+	if _, err := cs.CoreV1().PersistentVolumeClaims("default").Create(context.Background(), pvc, metaV1.CreateOptions{}); err != nil {
+		t.Fatalf("Create: %s", err)
+	}
+	waitNotified(t, "delivered", delivered+1)
+
+	// an update while still terminating, then resyncs
+	pvc = pvc.DeepCopy()
+	pvc.ResourceVersion = "2"
+	pvc.Labels = map[string]string{"app": "web"}
+	if _, err := cs.CoreV1().PersistentVolumeClaims("default").Update(context.Background(), pvc, metaV1.UpdateOptions{}); err != nil {
+		t.Fatalf("Update: %s", err)
+	}
+	time.Sleep(2500 * time.Millisecond)
+
+	if got := atomic.LoadInt32(requests); got != 1 {
+		t.Errorf("expected 1 webhook request, got %d", got)
+	}
+
+	if n.Notify(NotifyTerminating, *pvc) {
+		t.Error("expected a repeated terminating notification to be skipped")
+	}
+}
+
+func TestNotifierRetries(t *testing.T) {
+	cs := fake.NewSimpleClientset(testPVC("default", "data"))
+	a, _ := testAPI(t, &Config{Cs: cs})
+	pvc := *testPVC("default", "data")
+
+	for _, tc := range []struct {
+		name     string
+		statuses []int
+		result   string
+		requests int32
+	}{
+		{name: "fail twice then succeed", statuses: []int{500, 502}, result: "delivered", requests: 3},
+		{name: "retries exhausted", statuses: []int{500, 500, 500}, result: "failed", requests: 3},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv, requests := webhook(t, tc.statuses...)
+
+			n, err := NewNotifier(a, NotifierConfig{URL: srv.URL, Retries: 2, Backoff: time.Millisecond})
+			if err != nil {
+				t.Fatalf("NewNotifier: %s", err)
+			}
+
+			stop := make(chan struct{})
+			defer close(stop)
+			n.Run(stop)
+
+			count := testutil.ToFloat64(notifications.WithLabelValues(tc.result))
+			if !n.Notify(NotifyDeleted, pvc) {
+				t.Fatal("expected the notification to be queued")
+			}
+			waitNotified(t, tc.result, count+1)
+
+			if got := atomic.LoadInt32(requests); got != tc.requests {
+				t.Errorf("expected %d webhook requests, got %d", tc.requests, got)
+			}
+		})
+	}
+}
+
+func TestNotifierQueueFull(t *testing.T) {
+	cs := fake.NewSimpleClientset()
+	a, _ := testAPI(t, &Config{Cs: cs})
+
+	// not running, so nothing drains the queue
+	n, err := NewNotifier(a, NotifierConfig{URL: "http://localhost"})
+	if err != nil {
+		t.Fatalf("NewNotifier: %s", err)
+	}
+
+	for i := 0; i < notifyQueueSize; i++ {
+		if !n.Notify(NotifyTerminating, *testPVC("default", fmt.Sprintf("data-%d", i))) {
+			t.Fatalf("expected notification %d to be queued", i)
+		}
+	}
+
+	dropped := testutil.ToFloat64(notifications.WithLabelValues("dropped"))
+	pvc := *testPVC("default", "full")
+	if n.Notify(NotifyTerminating, pvc) {
+		t.Fatal("expected a notification to a full queue to be dropped")
+	}
+	if got := testutil.ToFloat64(notifications.WithLabelValues("dropped")); got != dropped+1 {
+		t.Errorf("expected the dropped counter to increase by 1, got %v", got-dropped)
+	}
+
+	// a dropped notification is not marked sent
+	<-n.queue
+	if !n.Notify(NotifyTerminating, pvc) {
+		t.Error("expected a dropped notification to be queued again")
+	}
+}
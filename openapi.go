@@ -0,0 +1,375 @@
+package volm
+
+import (
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// OpenAPIVersion is the OpenAPI specification version of the
+// document served by OpenAPIHandler.
+const OpenAPIVersion = "3.0.3"
+
+// openAPIParam describes a query parameter
+type openAPIParam struct {
+	Name        string
+	Type        string
+	Description string
+}
+
+// openAPIRoute describes a route. Body and Response are zero
+// values of the Go types the handler binds and writes, schemas
+// are derived from them so they follow the types.
+type openAPIRoute struct {
+	Method   string
+	Path     string
+	Summary  string
+	Query    []openAPIParam
+	Body     interface{}
+	Status   int
+	Response interface{}
+}
+
+var (
+	fieldsParam = openAPIParam{Name: "fields", Type: "string", Description: "Comma separated dotted paths to include in the response"}
+	formatParam = openAPIParam{Name: "format", Type: "string", Description: "Response format, json, yaml, csv or ndjson, overrides the Accept header"}
+	dryRunParam = openAPIParam{Name: "dryRun", Type: "boolean", Description: "Preview the delete without performing it"}
+	forceParam  = openAPIParam{Name: "force", Type: "boolean", Description: "Delete PVCs in use by active pods"}
+	activeParam = openAPIParam{Name: "activeOnly", Type: "boolean", Description: "Only list active pods in usedBy"}
+)
+
+// openAPIRoutes lists every route served by cmd/volm.go
+var openAPIRoutes = []openAPIRoute{
+	{Method: http.MethodGet, Path: "/", Summary: "Service information", Status: http.StatusOK, Response: ServiceInfo{}},
+	{Method: http.MethodGet, Path: "/healthz", Summary: "Liveness, 503 naming the failing components when a store is stale or the API server is unreachable", Status: http.StatusOK, Response: HealthReport{}},
+	{Method: http.MethodGet, Path: "/readyz", Summary: "Readiness, 503 until the caches sync or while a store is stale", Status: http.StatusOK, Response: StatusResponse{}},
+	{Method: http.MethodGet, Path: "/openapi.json", Summary: "OpenAPI document", Status: http.StatusOK, Response: map[string]interface{}{}},
+	{Method: http.MethodGet, Path: "/vol/", Summary: "List PVCs", Status: http.StatusOK, Response: []VolumeInfo{}, Query: []openAPIParam{
+		{Name: "createdBefore", Type: "string", Description: "RFC3339 time PVCs must be created before"},
+		{Name: "createdAfter", Type: "string", Description: "RFC3339 time PVCs must be created after"},
+		{Name: "minSize", Type: "string", Description: "Minimum requested storage, inclusive (e.g. 100Gi)"},
+		{Name: "maxSize", Type: "string", Description: "Maximum requested storage, inclusive (e.g. 1Ti)"},
+		{Name: "view", Type: "string", Description: "full (default) or summary, listing flattened VolumeBrief objects"},
+		{Name: "danglingOnly", Type: "boolean", Description: "Only list PVCs bound to a missing, Released or Failed PV, requires watching PersistentVolumes"},
+		fieldsParam,
+		formatParam,
+		activeParam,
+		{Name: "watch", Type: "boolean", Description: "Long-poll for changes, responds with a WatchResult"},
+		{Name: "since", Type: "string", Description: "Token from the previous watch response, changes after it are returned"},
+		{Name: "timeoutSeconds", Type: "integer", Description: "Seconds a watch waits for a change, default 30, at most 300"},
+	}},
+	{Method: http.MethodDelete, Path: "/vol/", Summary: "Delete PVCs by label selector", Status: http.StatusMultiStatus, Response: BulkDeleteResult{}, Query: []openAPIParam{
+		{Name: "labelSelector", Type: "string", Description: "Kubernetes label selector matching the PVCs to delete"},
+		dryRunParam,
+		forceParam,
+	}},
+	{Method: http.MethodPost, Path: "/vol/refresh", Summary: "Re-list PVCs and pods into the caches", Status: http.StatusOK, Response: RefreshResult{}},
+	{Method: http.MethodGet, Path: "/vol/-/summary", Summary: "PVC summary", Status: http.StatusOK, Response: VolumeSummary{}},
+	{Method: http.MethodGet, Path: "/vol/-/stats", Summary: "Alias of GET /vol/-/summary for dashboards", Status: http.StatusOK, Response: VolumeSummary{}},
+	{Method: http.MethodGet, Path: "/vol/-/storageclasses", Summary: "PVC usage by storage class, sorted by requested capacity descending", Status: http.StatusOK, Response: []StorageClassInfo{}},
+	{Method: http.MethodGet, Path: "/vol/-/aggregate", Summary: "PVC counts and requested bytes grouped by label value", Status: http.StatusOK, Response: LabelAggregate{}, Query: []openAPIParam{
+		{Name: "by", Type: "string", Description: "Label key to group by, PVCs without it are grouped as (none)"},
+	}},
+	{Method: http.MethodGet, Path: "/vol/-/unused", Summary: "List PVCs no pod references", Status: http.StatusOK, Response: UnusedReport{}, Query: []openAPIParam{
+		{Name: "olderThan", Type: "string", Description: "Minimum unused duration (e.g. 72h)"},
+	}},
+	{Method: http.MethodGet, Path: "/vol/-/uid/:uid", Summary: "Get a PVC by UID", Status: http.StatusOK, Response: VolumeInfo{}, Query: []openAPIParam{
+		fieldsParam,
+		formatParam,
+		activeParam,
+	}},
+	{Method: http.MethodGet, Path: "/vol/:name", Summary: "Get a PVC", Status: http.StatusOK, Response: VolumeInfo{}, Query: []openAPIParam{
+		fieldsParam,
+		formatParam,
+		activeParam,
+		{Name: "events", Type: "boolean", Description: "Include the PVC's events, newest first"},
+	}},
+	{Method: http.MethodDelete, Path: "/vol/:name", Summary: "Delete a PVC", Status: http.StatusOK, Response: StatusResponse{}, Query: []openAPIParam{
+		dryRunParam,
+		forceParam,
+		{Name: "removeFinalizers", Type: "boolean", Description: "Clear finalizers after the delete, returns a DeletePreview of the PVC after the patch"},
+		{Name: "confirm", Type: "string", Description: "PVC name, required with removeFinalizers"},
+		{Name: "gracePeriodSeconds", Type: "integer", Description: "Delete grace period passed to the API server"},
+		{Name: "propagationPolicy", Type: "string", Description: "Orphan, Background or Foreground"},
+		{Name: "uid", Type: "string", Description: "Only delete the PVC if its uid matches"},
+		{Name: "resourceVersion", Type: "string", Description: "Only delete the PVC if its resourceVersion matches, also read from If-Match"},
+		{Name: "reclaimPv", Type: "boolean", Description: "Also delete the bound PV when its reclaim policy is Retain, returns a DeletePreview"},
+	}},
+	{Method: http.MethodGet, Path: "/vol/:name/events", Summary: "List PVC events", Status: http.StatusOK, Response: []EventInfo{}},
+	{Method: http.MethodGet, Path: "/vol/:name/pods", Summary: "List pods using a PVC", Status: http.StatusOK, Response: []PodInfo{}, Query: []openAPIParam{activeParam}},
+	{Method: http.MethodGet, Path: "/vol/:name/snapshots", Summary: "List PVC snapshots", Status: http.StatusOK, Response: []SnapshotInfo{}},
+	{Method: http.MethodPost, Path: "/vol/:name/snapshots", Summary: "Create a PVC snapshot", Body: SnapshotRequest{}, Status: http.StatusCreated, Response: SnapshotInfo{}},
+	{Method: http.MethodPost, Path: "/vol/:name/snapshot", Summary: "Create a PVC snapshot, same as POST snapshots", Body: SnapshotRequest{}, Status: http.StatusCreated, Response: SnapshotInfo{}},
+	{Method: http.MethodPost, Path: "/vol/:name/restore", Summary: "Restore a PVC snapshot to a new PVC", Body: RestoreRequest{}, Status: http.StatusCreated, Response: VolumeInfo{}},
+	{Method: http.MethodPost, Path: "/vol/:name/clone", Summary: "Clone a PVC", Body: CloneRequest{}, Status: http.StatusCreated, Response: VolumeInfo{}},
+	{Method: http.MethodPatch, Path: "/vol/:name/metadata", Summary: "Patch PVC labels and annotations", Body: MetadataPatch{}, Status: http.StatusOK, Response: VolumeInfo{}},
+	{Method: http.MethodPost, Path: "/vol/:name/protect", Summary: "Protect a PVC from deletion", Status: http.StatusOK, Response: VolumeInfo{}},
+	{Method: http.MethodDelete, Path: "/vol/:name/protect", Summary: "Remove PVC deletion protection", Status: http.StatusOK, Response: VolumeInfo{}},
+	{Method: http.MethodGet, Path: "/storageclass/", Summary: "List storage classes with PVC usage", Status: http.StatusOK, Response: []StorageClassInfo{}},
+	{Method: http.MethodGet, Path: "/templates/", Summary: "List PVC templates", Status: http.StatusOK, Response: []PVCTemplate{}},
+	{Method: http.MethodPost, Path: "/vol/-/from-template/:template", Summary: "Create a PVC from a template", Body: TemplateRequest{}, Status: http.StatusCreated, Response: VolumeInfo{}},
+}
+
+var pathParam = regexp.MustCompile(`:(\w+)`)
+
+func (a *API) OpenAPIHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, a.OpenAPI())
+	}
+}
+
+// OpenAPI builds an OpenAPI 3 document describing every route,
+// with component schemas derived from the Go types by reflection.
+func (a *API) OpenAPI() map[string]interface{} {
+	sb := &schemaBuilder{schemas: map[string]interface{}{}}
+	errorRef := sb.schema(reflect.TypeOf(APIError{}))
+
+	paths := map[string]interface{}{}
+	for _, route := range openAPIRoutes {
+		// everything but /, the probes and this document sits
+		// behind auth and under the current API version prefix
+		public := route.Path == "/" || route.Path == "/healthz" || route.Path == "/readyz" || route.Path == "/openapi.json"
+
+		path := pathParam.ReplaceAllString(route.Path, "{$1}")
+		if !public {
+			path = APIPrefix + path
+		}
+
+		var params []interface{}
+		for _, m := range pathParam.FindAllStringSubmatch(route.Path, -1) {
+			params = append(params, map[string]interface{}{
+				"name":     m[1],
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]interface{}{"type": "string"},
+			})
+		}
+
+		for _, q := range route.Query {
+			params = append(params, map[string]interface{}{
+				"name":        q.Name,
+				"in":          "query",
+				"description": q.Description,
+				"schema":      map[string]interface{}{"type": q.Type},
+			})
+		}
+
+		op := map[string]interface{}{"summary": route.Summary}
+
+		if !public {
+			op["security"] = []interface{}{
+				map[string]interface{}{"bearer": []string{}},
+				map[string]interface{}{"apiKey": []string{}},
+			}
+		}
+
+		op["responses"] = map[string]interface{}{
+			strconv.Itoa(route.Status): jsonContent(http.StatusText(route.Status), sb.schema(reflect.TypeOf(route.Response))),
+			"default":                  jsonContent("Error", errorRef),
+		}
+
+		if len(params) > 0 {
+			op["parameters"] = params
+		}
+
+		if route.Body != nil {
+			body := jsonContent("", sb.schema(reflect.TypeOf(route.Body)))
+			delete(body, "description")
+			body["required"] = true
+			op["requestBody"] = body
+		}
+
+		if _, ok := paths[path]; !ok {
+			paths[path] = map[string]interface{}{}
+		}
+		paths[path].(map[string]interface{})[strings.ToLower(route.Method)] = op
+	}
+
+	return map[string]interface{}{
+		"openapi": OpenAPIVersion,
+		"info": map[string]interface{}{
+			"title":   a.Service,
+			"version": a.Version,
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": sb.schemas,
+			"securitySchemes": map[string]interface{}{
+				"bearer": map[string]interface{}{"type": "http", "scheme": "bearer"},
+				"apiKey": map[string]interface{}{"type": "apiKey", "in": "header", "name": "X-API-Key"},
+			},
+		},
+	}
+}
+
+// jsonContent wraps a schema in an application/json
+// response or request body object.
+func jsonContent(description string, schema map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"description": description,
+		"content": map[string]interface{}{
+			"application/json": map[string]interface{}{"schema": schema},
+		},
+	}
+}
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	metaTimeType = reflect.TypeOf(metaV1.Time{})
+	quantityType = reflect.TypeOf(resource.Quantity{})
+)
+
+// schemaBuilder derives JSON schemas from Go types following
+// encoding/json rules, named structs are added to schemas and
+// referenced.
+type schemaBuilder struct {
+	schemas map[string]interface{}
+}
+
+func (sb *schemaBuilder) schema(t reflect.Type) map[string]interface{} {
+	switch t {
+	case timeType, metaTimeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case quantityType:
+		return map[string]interface{}{"type": "string", "example": "10Gi"}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return sb.schema(t.Elem())
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]interface{}{"type": "integer", "format": "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": sb.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": sb.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return sb.object(t)
+		}
+
+		name := schemaName(t)
+		if _, ok := sb.schemas[name]; !ok {
+			// reserve the name before descending so
+			// recursive types terminate
+			sb.schemas[name] = map[string]interface{}{}
+			sb.schemas[name] = sb.object(t)
+		}
+
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	}
+
+	// interface{} and anything else accepts any value
+	return map[string]interface{}{}
+}
+
+// object builds an object schema from the exported struct fields,
+// embedded structs without a json name are flattened.
+func (sb *schemaBuilder) object(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	var required []string
+	sb.properties(t, properties, &required)
+
+	obj := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		sort.Strings(required)
+		obj["required"] = required
+	}
+
+	return obj
+}
+
+// properties adds a schema for each field to properties. Fields
+// without omitempty are always encoded so they are required, and
+// those that may encode as null are marked nullable.
+func (sb *schemaBuilder) properties(t reflect.Type, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		opts := strings.Split(tag, ",")
+		name := opts[0]
+
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			sb.properties(ft, properties, required)
+			continue
+		}
+
+		if f.PkgPath != "" {
+			continue
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+
+		schema := sb.schema(f.Type)
+
+		omitEmpty := false
+		for _, opt := range opts[1:] {
+			if opt == "omitempty" {
+				omitEmpty = true
+			}
+		}
+
+		if !omitEmpty {
+			*required = append(*required, name)
+
+			switch f.Type.Kind() {
+			case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Interface:
+				if _, isRef := schema["$ref"]; isRef {
+					// siblings of $ref are ignored in OpenAPI 3.0
+					schema = map[string]interface{}{"allOf": []interface{}{schema}, "nullable": true}
+				} else {
+					schema["nullable"] = true
+				}
+			}
+		}
+
+		properties[name] = schema
+	}
+}
+
+// schemaName names volm types by their Go name and other types
+// by the last two elements of their package path, e.g.
+// core.v1.PersistentVolumeClaimSpec.
+func schemaName(t reflect.Type) string {
+	if t.PkgPath() == reflect.TypeOf(API{}).PkgPath() {
+		return t.Name()
+	}
+
+	parts := strings.Split(t.PkgPath(), "/")
+	if len(parts) > 2 {
+		parts = parts[len(parts)-2:]
+	}
+
+	return strings.Join(parts, ".") + "." + t.Name()
+}
@@ -0,0 +1,62 @@
+package volm
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestOpenAPIRoutes(t *testing.T) {
+	a, r := testAPI(t, &Config{Cs: fake.NewSimpleClientset()})
+
+	doc := a.OpenAPI()
+	paths := doc["paths"].(map[string]interface{})
+
+	param := regexp.MustCompile(`:(\w+)`)
+	served := map[string]bool{}
+	for _, route := range r.Routes() {
+		// the unprefixed deprecated aliases are not documented
+		public := !strings.HasPrefix(route.Path, APIPrefix+"/")
+		if public && route.Path != "/" && route.Path != "/healthz" && route.Path != "/readyz" && route.Path != "/openapi.json" {
+			continue
+		}
+
+		path := param.ReplaceAllString(route.Path, "{$1}")
+		method := strings.ToLower(route.Method)
+		served[method+" "+path] = true
+
+		ops, ok := paths[path].(map[string]interface{})
+		if !ok || ops[method] == nil {
+			t.Errorf("%s %s is served but not documented", route.Method, path)
+		}
+	}
+
+	for path, ops := range paths {
+		for method := range ops.(map[string]interface{}) {
+			if !served[method+" "+path] {
+				t.Errorf("%s %s is documented but not served", strings.ToUpper(method), path)
+			}
+		}
+	}
+
+	schemas := doc["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+	for _, name := range []string{"VolumeInfo", "PodInfo", "APIError"} {
+		if _, ok := schemas[name]; !ok {
+			t.Errorf("expected a %s schema", name)
+		}
+	}
+
+	// VolumeInfo lists its pods by reference
+	volumeInfo := schemas["VolumeInfo"].(map[string]interface{})["properties"].(map[string]interface{})
+	usedBy, _ := volumeInfo["usedBy"].(map[string]interface{})
+	if items, _ := usedBy["items"].(map[string]interface{}); items["$ref"] != "#/components/schemas/PodInfo" {
+		t.Errorf("expected usedBy items to reference PodInfo, got %v", usedBy)
+	}
+
+	if w := serve(r, http.MethodGet, "/openapi.json", nil); w.Code != http.StatusOK {
+		t.Errorf("expected 200 serving the document, got %d", w.Code)
+	}
+}
@@ -0,0 +1,64 @@
+package volm
+
+import (
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// OwnerInfo identifies the workload controlling a pod or PVC
+type OwnerInfo struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+}
+
+// podOwner returns the controller of the pod, or nil
+// for pods created directly.
+func podOwner(pod v1.Pod) *OwnerInfo {
+	ref := metaV1.GetControllerOf(&pod)
+	if ref == nil {
+		return nil
+	}
+
+	return &OwnerInfo{Kind: ref.Kind, Name: ref.Name}
+}
+
+// resolveOwner returns the Deployment controlling a ReplicaSet
+// owner, or the owner unchanged. ReplicaSets are read from the
+// informer cache so no API calls are made per request.
+func (a *API) resolveOwner(owner *OwnerInfo) *OwnerInfo {
+	if owner == nil || owner.Kind != "ReplicaSet" || a.ReplicaSetLister == nil {
+		return owner
+	}
+
+	rs, err := a.ReplicaSetLister.ReplicaSets(a.PVCNamespace).Get(owner.Name)
+	if err != nil {
+		return owner
+	}
+
+	ref := metaV1.GetControllerOf(rs)
+	if ref == nil {
+		return owner
+	}
+
+	return &OwnerInfo{Kind: ref.Kind, Name: ref.Name}
+}
+
+// statefulSetOwner returns the StatefulSet that created the PVC
+// from a volumeClaimTemplate, detected by a StatefulSet pod using
+// a claim named <template>-<pod name>. Deleting such a PVC only
+// causes the StatefulSet to recreate it.
+func statefulSetOwner(pvcName string, usedBy []PodInfo) *OwnerInfo {
+	for _, p := range usedBy {
+		if p.Owner == nil || p.Owner.Kind != "StatefulSet" {
+			continue
+		}
+
+		if strings.HasSuffix(pvcName, "-"+p.Name) {
+			return &OwnerInfo{Kind: p.Owner.Kind, Name: p.Owner.Name}
+		}
+	}
+
+	return nil
+}
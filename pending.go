@@ -0,0 +1,114 @@
+package volm
+
+import (
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+	coreInformers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// pvcEventUIDIndex indexes PVC events by the involved PVC UID
+const pvcEventUIDIndex = "involvedObject.uid"
+
+// newPVCEventInformer returns an informer on the events involving
+// PVCs in the PVC namespace, indexed by the PVC UID.
+func (a *API) newPVCEventInformer(cs kubernetes.Interface, resync time.Duration) cache.SharedIndexInformer {
+	indexers := cache.Indexers{
+		pvcEventUIDIndex: func(obj interface{}) ([]string, error) {
+			e, ok := obj.(*v1.Event)
+			if !ok {
+				return nil, fmt.Errorf("unexpected object type %T", obj)
+			}
+			return []string{string(e.InvolvedObject.UID)}, nil
+		},
+	}
+
+	selector := fields.OneTermEqualSelector("involvedObject.kind", "PersistentVolumeClaim").String()
+
+	return coreInformers.NewFilteredEventInformer(cs, a.PVCNamespace, resync, indexers, func(opts *metaV1.ListOptions) {
+		opts.FieldSelector = selector
+	})
+}
+
+// watchPVCEvents invalidates the list cache when an event
+// involving a Pending PVC may change its PendingReason.
+func (a *API) watchPVCEvents(informer cache.SharedIndexInformer) {
+	invalidate := func(obj interface{}) {
+		e, ok := obj.(*v1.Event)
+		if !ok {
+			return
+		}
+
+		if pvc := a.PVCStore.GetPVC(e.InvolvedObject.Name); pvc != nil && pvcPending(*pvc) {
+			a.listCache.invalidate()
+		}
+	}
+
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: invalidate,
+		UpdateFunc: func(_, newObj interface{}) {
+			invalidate(newObj)
+		},
+	})
+}
+
+// pvcPending returns true for PVCs in the Pending phase,
+// new PVCs have no phase until the controller sets Pending.
+func pvcPending(pvc v1.PersistentVolumeClaim) bool {
+	return pvc.Status.Phase == v1.ClaimPending || pvc.Status.Phase == ""
+}
+
+// eventLastSeen returns when an event was last seen, events
+// from the events.k8s.io API only set EventTime.
+func eventLastSeen(e v1.Event) metaV1.Time {
+	if e.LastTimestamp.IsZero() {
+		return metaV1.NewTime(e.EventTime.Time)
+	}
+
+	return e.LastTimestamp
+}
+
+// pendingReason returns the reason and message of the most recent
+// Warning event involving the PVC, or of its most recent event when
+// there is no warning, such as WaitForFirstConsumer.
+func (a *API) pendingReason(uid types.UID) string {
+	if a.PVCEventIndexer == nil {
+		return ""
+	}
+
+	objs, err := a.PVCEventIndexer.ByIndex(pvcEventUIDIndex, string(uid))
+	if err != nil {
+		return ""
+	}
+
+	var latest, latestWarning *v1.Event
+	for _, obj := range objs {
+		e, ok := obj.(*v1.Event)
+		if !ok {
+			continue
+		}
+
+		lastSeen := eventLastSeen(*e)
+		if latest == nil || eventLastSeen(*latest).Time.Before(lastSeen.Time) {
+			latest = e
+		}
+		if e.Type == v1.EventTypeWarning && (latestWarning == nil || eventLastSeen(*latestWarning).Time.Before(lastSeen.Time)) {
+			latestWarning = e
+		}
+	}
+
+	if latestWarning != nil {
+		latest = latestWarning
+	}
+	if latest == nil {
+		return ""
+	}
+
+	return latest.Reason + ": " + latest.Message
+}
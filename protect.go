@@ -0,0 +1,40 @@
+package volm
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ProtectedAnnotation prevents DeletePVC from deleting
+// a PVC when set to "true".
+const ProtectedAnnotation = "volm.txn2.com/protected"
+
+// ProtectPVCHandler sets or removes ProtectedAnnotation on
+// a PVC, use with POST to protect and DELETE to unprotect.
+func (a *API) ProtectPVCHandler(protected bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		volInfo, err := a.SetPVCProtection(requestContext(c), c.Param("name"), protected)
+		if err != nil {
+			WriteError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, volInfo)
+	}
+}
+
+// SetPVCProtection adds or removes ProtectedAnnotation on
+// a PVC meeting the selector criteria.
+func (a *API) SetPVCProtection(ctx context.Context, name string, protected bool) (VolumeInfo, error) {
+	patch := MetadataPatch{}
+
+	if protected {
+		patch.Annotations = map[string]string{ProtectedAnnotation: "true"}
+	} else {
+		patch.RemoveAnnotations = []string{ProtectedAnnotation}
+	}
+
+	return a.PatchPVCMetadata(ctx, name, patch)
+}
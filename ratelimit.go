@@ -0,0 +1,107 @@
+package volm
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+// rateLimitIdle is how long a client's limiter is kept
+// after its last mutating request.
+const rateLimitIdle = time.Minute * 10
+
+// clientLimiter is the token bucket of one client
+type clientLimiter struct {
+	limiter  flowcontrol.RateLimiter
+	lastSeen time.Time
+}
+
+// RateLimitMiddleware returns gin middleware limiting each client to
+// rps mutating requests per second with bursts of up to burst. Clients
+// presenting a valid token are keyed by its identity and others by
+// client IP. Requests over the limit get a 429 with
+// a Retry-After header, GET, HEAD and OPTIONS requests are exempt.
+// An rps of zero or less disables the limit.
+func (a *API) RateLimitMiddleware(rps float64, burst int) gin.HandlerFunc {
+	if rps <= 0 {
+		return func(c *gin.Context) {
+			c.Next()
+		}
+	}
+
+	if burst < 1 {
+		burst = 1
+	}
+
+	// the time for one token to refill, rounded up
+	retryAfter := int(math.Ceil(1 / rps))
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+
+	var (
+		clients   = make(map[string]*clientLimiter)
+		lastSweep = time.Now()
+		mu        sync.Mutex
+	)
+
+	return func(c *gin.Context) {
+		if readMethod(c.Request.Method) {
+			c.Next()
+			return
+		}
+
+		// only valid tokens get a bucket of their own, keying
+		// unknown tokens by them would let clients add buckets
+		key := c.ClientIP()
+		if token := requestToken(c); token != "" {
+			if _, ok := lookupToken(a.APITokens, token); ok {
+				key = tokenIdentity(token)
+			}
+		}
+
+		now := time.Now()
+
+		mu.Lock()
+		if now.Sub(lastSweep) > rateLimitIdle {
+			for k, cl := range clients {
+				if now.Sub(cl.lastSeen) > rateLimitIdle {
+					delete(clients, k)
+				}
+			}
+			lastSweep = now
+		}
+
+		cl, ok := clients[key]
+		if !ok {
+			cl = &clientLimiter{limiter: flowcontrol.NewTokenBucketRateLimiter(float32(rps), burst)}
+			clients[key] = cl
+		}
+		cl.lastSeen = now
+		allowed := cl.limiter.TryAccept()
+		mu.Unlock()
+
+		if allowed {
+			c.Next()
+			return
+		}
+
+		route := c.FullPath()
+		rateLimited.WithLabelValues(c.Request.Method, route).Inc()
+		a.logger(requestContext(c)).Warn("Rate limited request",
+			zap.String("client", key),
+			zap.String("method", c.Request.Method),
+			zap.String("route", route),
+		)
+
+		apiErr := NewAPIError(http.StatusTooManyRequests, CodeTooManyRequests, fmt.Sprintf("rate limit of %g requests per second exceeded", rps))
+		apiErr.RetryAfter = retryAfter
+		WriteError(c, apiErr)
+	}
+}
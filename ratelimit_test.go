@@ -0,0 +1,80 @@
+package volm
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// rateLimitedAPI returns a gin engine serving the routes of
+// an API on cfg behind a limit of 1 request per second with
+// bursts of 2.
+func rateLimitedAPI(t *testing.T, cfg *Config) *gin.Engine {
+	t.Helper()
+
+	a, _ := testAPI(t, cfg)
+
+	r := gin.New()
+	r.Use(a.RateLimitMiddleware(1, 2))
+	a.RegisterRoutes(r, APIPrefix)
+
+	return r
+}
+
+func TestRateLimitMutating(t *testing.T) {
+	cs := fake.NewSimpleClientset(testPVC("default", "data"))
+	r := rateLimitedAPI(t, &Config{Cs: cs})
+
+	limited := 0
+	for i := 0; i < 5; i++ {
+		w := serve(r, http.MethodDelete, "/v1/vol/missing", nil)
+		switch w.Code {
+		case http.StatusTooManyRequests:
+			limited++
+			if w.Header().Get("Retry-After") != "1" {
+				t.Errorf("expected Retry-After 1, got %q", w.Header().Get("Retry-After"))
+			}
+		case http.StatusNotFound:
+		default:
+			t.Errorf("expected 404 or 429, got %d", w.Code)
+		}
+	}
+
+	if limited != 3 {
+		t.Errorf("expected 3 of 5 deletes over the burst of 2 rejected, got %d", limited)
+	}
+
+	// reads are never limited
+	for i := 0; i < 5; i++ {
+		if w := serve(r, http.MethodGet, "/v1/vol/", nil); w.Code != http.StatusOK {
+			t.Fatalf("expected reads unaffected by the limit, got %d", w.Code)
+		}
+	}
+}
+
+func TestRateLimitUnknownTokens(t *testing.T) {
+	cs := fake.NewSimpleClientset()
+	r := rateLimitedAPI(t, &Config{Cs: cs, APITokens: map[string]Role{"admin-token": RoleAdmin}})
+
+	// unknown tokens share the bucket of the client IP
+	limited := 0
+	for i := 0; i < 5; i++ {
+		header := http.Header{"Authorization": {fmt.Sprintf("Bearer bogus-%d", i)}}
+		if w := serve(r, http.MethodDelete, "/v1/vol/missing", header); w.Code == http.StatusTooManyRequests {
+			limited++
+		}
+	}
+
+	if limited != 3 {
+		t.Errorf("expected 3 of 5 deletes with unknown tokens rejected, got %d", limited)
+	}
+
+	// a valid token has a bucket of its own
+	header := http.Header{"Authorization": {"Bearer admin-token"}}
+	if w := serve(r, http.MethodDelete, "/v1/vol/missing", header); w.Code != http.StatusNotFound {
+		t.Errorf("expected a valid token to pass the limit, got %d", w.Code)
+	}
+}
@@ -0,0 +1,73 @@
+package volm
+
+import (
+	"context"
+	"fmt"
+
+	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// PVReclaim reports whether DeletePVC deleted the
+// PersistentVolume bound to the deleted PVC, and why not.
+type PVReclaim struct {
+	PV      string `json:"pv"`
+	Deleted bool   `json:"deleted"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// reclaimPV deletes the Retain policy PV bound to a deleted PVC so
+// it does not linger Released, the backing storage is kept as the
+// policy promises. PVs with other policies are left to their reclaim
+// policy and PVs bound to another claim are never touched. Errors are
+// reported in the result since the PVC is already deleted.
+func (a *API) reclaimPV(ctx context.Context, pvc *v1.PersistentVolumeClaim, dryRun bool) *PVReclaim {
+	result := &PVReclaim{PV: pvc.Spec.VolumeName}
+
+	if pvc.Spec.VolumeName == "" {
+		result.Reason = "PVC is not bound to a PV"
+		return result
+	}
+
+	pvClient := a.Cs.CoreV1().PersistentVolumes()
+
+	pv, err := pvClient.Get(ctx, pvc.Spec.VolumeName, metaV1.GetOptions{})
+	if err != nil {
+		a.logger(ctx).Error("reclaimPV got error invoking pvClient.Get", zap.String("pv", pvc.Spec.VolumeName), zap.Error(err))
+		result.Reason = err.Error()
+		return result
+	}
+
+	if pv.Spec.PersistentVolumeReclaimPolicy != v1.PersistentVolumeReclaimRetain {
+		result.Reason = fmt.Sprintf("reclaim policy is %s, not Retain", pv.Spec.PersistentVolumeReclaimPolicy)
+		return result
+	}
+
+	ref := pv.Spec.ClaimRef
+	if ref == nil || ref.Namespace != pvc.Namespace || ref.Name != pvc.Name || ref.UID != pvc.UID {
+		result.Reason = "PV is not bound to this PVC"
+		return result
+	}
+
+	deleteOptions := metaV1.DeleteOptions{Preconditions: &metaV1.Preconditions{UID: &pv.UID}}
+	if dryRun {
+		deleteOptions.DryRun = []string{metaV1.DryRunAll}
+	}
+
+	// the pv-protection finalizer holds the delete
+	// until the PVC is removed
+	err = pvClient.Delete(ctx, pv.Name, deleteOptions)
+	if err != nil {
+		a.logger(ctx).Error("reclaimPV got error invoking pvClient.Delete", zap.String("pv", pv.Name), zap.Error(err))
+		result.Reason = err.Error()
+		return result
+	}
+
+	if !dryRun {
+		a.logger(ctx).Info("Deleted Retain PV of deleted PVC", zap.String("pv", pv.Name), zap.String("pvc", pvc.Name))
+	}
+	result.Deleted = true
+
+	return result
+}
@@ -0,0 +1,75 @@
+package volm
+
+import (
+	"context"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestReclaimPV(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		policy   v1.PersistentVolumeReclaimPolicy
+		unbound  bool
+		claimRef func(ref *v1.ObjectReference)
+		deleted  bool
+		reason   string
+	}{
+		{name: "Retain", policy: v1.PersistentVolumeReclaimRetain, deleted: true},
+		{name: "Delete", policy: v1.PersistentVolumeReclaimDelete, reason: "reclaim policy is Delete, not Retain"},
+		{name: "Recycle", policy: v1.PersistentVolumeReclaimRecycle, reason: "reclaim policy is Recycle, not Retain"},
+		{name: "unbound PVC", policy: v1.PersistentVolumeReclaimRetain, unbound: true, reason: "PVC is not bound to a PV"},
+		{
+			name:     "bound to another claim",
+			policy:   v1.PersistentVolumeReclaimRetain,
+			claimRef: func(ref *v1.ObjectReference) { ref.Name = "other" },
+			reason:   "PV is not bound to this PVC",
+		},
+		{
+			name:     "bound to a recreated claim",
+			policy:   v1.PersistentVolumeReclaimRetain,
+			claimRef: func(ref *v1.ObjectReference) { ref.UID = "recreated" },
+			reason:   "PV is not bound to this PVC",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			pvc := testPVC("default", "data")
+			pv := testPV("pv-data", tc.policy, pvc)
+			if tc.claimRef != nil {
+				tc.claimRef(pv.Spec.ClaimRef)
+			}
+			if tc.unbound {
+				pvc.Spec.VolumeName = ""
+			}
+
+			cs := fake.NewSimpleClientset(pv)
+			a, _ := testAPI(t, &Config{Cs: cs})
+
+			result := a.reclaimPV(context.Background(), pvc, false)
+			if result.Deleted != tc.deleted || result.Reason != tc.reason {
+				t.Errorf("expected deleted %v with reason %q, got %+v", tc.deleted, tc.reason, result)
+			}
+
+			_, err := cs.CoreV1().PersistentVolumes().Get(context.Background(), pv.Name, metaV1.GetOptions{})
+			if gone := errors.IsNotFound(err); gone != tc.deleted {
+				t.Errorf("expected the PV deleted %v, got error %v", tc.deleted, err)
+			}
+		})
+	}
+}
+
+func TestReclaimPVMissing(t *testing.T) {
+	a, _ := testAPI(t, &Config{Cs: fake.NewSimpleClientset()})
+
+	pvc := testPVC("default", "data")
+	pvc.Spec.VolumeName = "pv-gone"
+
+	result := a.reclaimPV(context.Background(), pvc, false)
+	if result.Deleted || result.PV != "pv-gone" || result.Reason == "" {
+		t.Errorf("expected a missing PV reported with a reason, got %+v", result)
+	}
+}
@@ -0,0 +1,104 @@
+package volm
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// RefreshResult is returned by RefreshHandler with the
+// number of objects in each store after the refresh.
+type RefreshResult struct {
+	PVCs int `json:"pvcs"`
+	Pods int `json:"pods"`
+}
+
+func (a *API) RefreshHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		result, err := a.Resync(requestContext(c))
+		if err != nil {
+			WriteError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// Resync lists PVCs and pods from the API server and replaces
+// the store contents, for when the informer caches have drifted.
+// Informer events continue to update the stores afterwards. A
+// Resync started while another is running is rejected.
+func (a *API) Resync(ctx context.Context) (RefreshResult, error) {
+	result := RefreshResult{}
+
+	if !atomic.CompareAndSwapInt32(&a.refreshing, 0, 1) {
+		return result, NewAPIError(http.StatusConflict, CodeConflict, "a refresh is already running")
+	}
+	defer atomic.StoreInt32(&a.refreshing, 0)
+
+	ctx, cancel := a.kubeContext(ctx)
+	defer cancel()
+
+	pvcList, err := a.Cs.CoreV1().PersistentVolumeClaims(a.PVCNamespace).List(ctx, metaV1.ListOptions{})
+	if err != nil {
+		a.logger(ctx).Error("Resync got error invoking pvcClient.List", zap.Error(err))
+		return result, err
+	}
+
+	podList, err := a.Cs.CoreV1().Pods(a.PVCNamespace).List(ctx, metaV1.ListOptions{})
+	if err != nil {
+		a.logger(ctx).Error("Resync got error invoking podClient.List", zap.Error(err))
+		return result, err
+	}
+
+	// pods first so PVCs are never listed without their pods
+	a.PodStore.Replace(podList.Items)
+	a.PVCStore.Replace(pvcList.Items)
+	a.listCache.invalidate()
+
+	result.PVCs = len(a.PVCStore.GetPVCs())
+	result.Pods = len(a.PodStore.GetPods())
+
+	a.logger(ctx).Info("Resynced stores",
+		zap.String("caller", CallerFromContext(ctx)),
+		zap.Int("pvcs", result.PVCs),
+		zap.Int("pods", result.Pods),
+	)
+
+	return result, nil
+}
+
+// ReconcileStores rebuilds the pod and PVC stores from their informer
+// caches, so stores that drifted through missed or mishandled events
+// heal without a live list. It returns the number of objects corrected.
+func (a *API) ReconcileStores() int {
+	// pods first so PVCs are never listed without their pods
+	drift := a.PodStore.Resync() + a.PVCStore.Resync()
+	if drift > 0 {
+		a.listCache.invalidate()
+	}
+
+	return drift
+}
+
+// reconcileStores calls ReconcileStores every interval
+// until stop is closed.
+func (a *API) reconcileStores(stop <-chan struct{}, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			a.ReconcileStores()
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package volm
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// listNames returns the names of the PVCs listed by r
+func listNames(t *testing.T, r http.Handler) []string {
+	t.Helper()
+
+	w := serve(r, http.MethodGet, "/v1/vol/", nil)
+	vols := []VolumeInfo{}
+	if err := json.Unmarshal(w.Body.Bytes(), &vols); err != nil {
+		t.Fatalf("malformed list %q: %s", w.Body.String(), err)
+	}
+
+	names := []string{}
+	for _, vol := range vols {
+		names = append(names, vol.Name)
+	}
+
+	return names
+}
+
+// drift puts the stores of a out of step with the cluster
+// holding data, logs and the pod web: a ghost PVC and pod are
+// added and data is removed.
+func drift(a *API) {
+	a.PVCStore.AddPVC(*testPVC("default", "ghost"))
+	a.PVCStore.DeletePVC("data")
+	a.PodStore.AddPod(*testPod("default", "ghost-web", "ghost"))
+}
+
+func TestResyncReplacesStores(t *testing.T) {
+	cs := fake.NewSimpleClientset(testPVC("default", "data"), testPVC("default", "logs"), testPod("default", "web", "data"))
+	a, r := testAPI(t, &Config{Cs: cs, DisableResync: true})
+
+	drift(a)
+	if names := listNames(t, r); !reflect.DeepEqual(names, []string{"ghost", "logs"}) {
+		t.Fatalf("expected the drifted list ghost and logs, got %v", names)
+	}
+
+	w := serve(r, http.MethodPost, "/v1/vol/refresh", nil)
+	result := RefreshResult{}
+	if err := json.Unmarshal(w.Body.Bytes(), &result); w.Code != http.StatusOK || err != nil {
+		t.Fatalf("expected 200 with a RefreshResult, got %d: %s", w.Code, w.Body.String())
+	}
+
+	if result.PVCs != 2 || result.Pods != 1 {
+		t.Errorf("expected 2 PVCs and 1 pod after the refresh, got %+v", result)
+	}
+
+	// the cached list is invalidated with the stores
+	if names := listNames(t, r); !reflect.DeepEqual(names, []string{"data", "logs"}) {
+		t.Errorf("expected data and logs after the refresh, got %v", names)
+	}
+
+	if pods := a.PodStore.PodsForPVC("ghost"); len(pods) != 0 {
+		t.Errorf("expected the ghost pod removed, got %v", pods)
+	}
+}
+
+func TestReconcileStoresDrift(t *testing.T) {
+	cs := fake.NewSimpleClientset(testPVC("default", "data"), testPVC("default", "logs"), testPod("default", "web", "data"))
+	a, r := testAPI(t, &Config{Cs: cs, DisableResync: true})
+
+	pvcDrift := testutil.ToFloat64(storeDrift.WithLabelValues("pvc"))
+	podDrift := testutil.ToFloat64(storeDrift.WithLabelValues("pod"))
+
+	drift(a)
+	listNames(t, r)
+
+	// ghost and data for PVCs, ghost-web for pods
+	if corrected := a.ReconcileStores(); corrected != 3 {
+		t.Errorf("expected 3 objects corrected, got %d", corrected)
+	}
+
+	if got := testutil.ToFloat64(storeDrift.WithLabelValues("pvc")) - pvcDrift; got != 2 {
+		t.Errorf("expected a PVC drift of 2, got %v", got)
+	}
+	if got := testutil.ToFloat64(storeDrift.WithLabelValues("pod")) - podDrift; got != 1 {
+		t.Errorf("expected a pod drift of 1, got %v", got)
+	}
+
+	if names := listNames(t, r); !reflect.DeepEqual(names, []string{"data", "logs"}) {
+		t.Errorf("expected data and logs after reconciling, got %v", names)
+	}
+
+	if corrected := a.ReconcileStores(); corrected != 0 {
+		t.Errorf("expected no drift once reconciled, got %d", corrected)
+	}
+}
@@ -0,0 +1,95 @@
+package volm
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// RequestIDHeader carries the request ID in requests and responses
+const RequestIDHeader = "X-Request-ID"
+
+// RequestIDKey is the gin context key RequestIDMiddleware
+// stores the request ID under.
+const RequestIDKey = "volm.request_id"
+
+// maxRequestIDLength bounds client supplied request IDs
+const maxRequestIDLength = 128
+
+type requestIDContextKey struct{}
+
+// RequestIDMiddleware returns gin middleware taking the request ID
+// from the X-Request-ID header, or generating one, and returning
+// it in the response header. Register it before the access log so
+// every log line of a request can carry the ID.
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+
+		c.Set(RequestIDKey, id)
+		c.Header(RequestIDHeader, id)
+		c.Next()
+	}
+}
+
+// RequestID returns the request ID set by RequestIDMiddleware,
+// or an empty string.
+func RequestID(c *gin.Context) string {
+	return c.GetString(RequestIDKey)
+}
+
+// WithRequestID returns a context carrying the request ID
+// attached to log entries written for the request.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey{}, id)
+}
+
+// RequestIDFromContext returns the request ID set by
+// WithRequestID, or an empty string.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey{}).(string)
+	return id
+}
+
+// logger returns the API logger with the request ID
+// of ctx attached when there is one.
+func (a *API) logger(ctx context.Context) *zap.Logger {
+	if id := RequestIDFromContext(ctx); id != "" {
+		return a.Log.With(zap.String("request_id", id))
+	}
+
+	return a.Log
+}
+
+// validRequestID accepts IDs of printable ASCII without
+// spaces, so they are safe to log and echo back.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for _, r := range id {
+		if r <= ' ' || r > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// newRequestID returns a random version 4 UUID
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -0,0 +1,178 @@
+package volm
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// RetainAnnotation opts a PVC out of deletion by the
+// RetentionController when set to "true".
+const RetainAnnotation = "volm.txn2.com/retain"
+
+// RetentionConfig configures the RetentionController
+type RetentionConfig struct {
+	// TTL is how long a PVC must go unused before it is deleted.
+	TTL time.Duration
+
+	// DryRun logs and counts PVCs that would be deleted
+	// without deleting them.
+	DryRun bool
+
+	// Interval between scans of the PVC store.
+	Interval time.Duration
+}
+
+// RetentionController periodically deletes PVCs meeting the
+// selector criteria that no pod has referenced for longer
+// than the configured TTL.
+type RetentionController struct {
+	RetentionConfig
+	api     *API
+	Stopper chan struct{}
+
+	// firstSeenUnused tracks when the controller first observed
+	// a PVC without pods, for PVCs lacking LastUsedAnnotation. It
+	// is keyed by UID so a PVC recreated under the same name starts over.
+	firstSeenUnused map[types.UID]time.Time
+	stopOnce        sync.Once
+}
+
+// NewRetentionController constructs a RetentionController, call
+// Run to start it.
+func NewRetentionController(api *API, cfg RetentionConfig) (*RetentionController, error) {
+	if api == nil {
+		return nil, fmt.Errorf("must specify API")
+	}
+
+	if api.ReadOnly {
+		return nil, fmt.Errorf("retention can not delete PVCs in read-only mode")
+	}
+
+	if cfg.TTL <= 0 {
+		return nil, fmt.Errorf("must specify a positive TTL")
+	}
+
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Minute * 10
+	}
+
+	return &RetentionController{
+		RetentionConfig: cfg,
+		api:             api,
+		Stopper:         make(chan struct{}),
+		firstSeenUnused: make(map[types.UID]time.Time),
+	}, nil
+}
+
+// Run scans the PVC store every Interval until Stop is called.
+func (rc *RetentionController) Run() {
+	rc.api.Log.Info("Starting retention controller",
+		zap.Duration("ttl", rc.TTL),
+		zap.Duration("interval", rc.Interval),
+		zap.Bool("dry_run", rc.DryRun),
+	)
+
+	ticker := time.NewTicker(rc.Interval)
+
+	go func() {
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-rc.Stopper:
+				return
+			case <-ticker.C:
+				rc.Reconcile()
+			}
+		}
+	}()
+}
+
+// Stop stops the controller.
+func (rc *RetentionController) Stop() {
+	rc.stopOnce.Do(func() {
+		close(rc.Stopper)
+	})
+}
+
+// Reconcile evaluates every PVC meeting the selector criteria
+// and deletes those unused for longer than the TTL.
+func (rc *RetentionController) Reconcile() {
+	now := time.Now()
+	unused := make(map[types.UID]time.Time)
+
+	for _, pvc := range rc.api.PVCStore.GetPVCs() {
+		if !rc.api.matchesSelector(pvc.ObjectMeta) {
+			continue
+		}
+
+		retentionClaims.WithLabelValues("evaluated").Inc()
+
+		if pvc.DeletionTimestamp != nil || rc.api.pvcInUse(pvc.Name) {
+			continue
+		}
+
+		// without a last used stamp the creation time says nothing
+		// about when the PVC was released, so require the controller
+		// to have observed it unused for the TTL as well
+		firstSeen, ok := rc.firstSeenUnused[pvc.UID]
+		if !ok {
+			firstSeen = now
+		}
+		unused[pvc.UID] = firstSeen
+
+		since := unusedSince(pvc).Time
+		if _, stamped := pvc.Annotations[LastUsedAnnotation]; !stamped && firstSeen.After(since) {
+			since = firstSeen
+		}
+
+		if now.Sub(since) < rc.TTL {
+			continue
+		}
+
+		if pvc.Annotations[RetainAnnotation] == "true" {
+			retentionClaims.WithLabelValues("skipped").Inc()
+			continue
+		}
+
+		rc.delete(pvc, now.Sub(since))
+	}
+
+	rc.firstSeenUnused = unused
+}
+
+func (rc *RetentionController) delete(pvc v1.PersistentVolumeClaim, unusedFor time.Duration) {
+	if rc.DryRun {
+		rc.api.Log.Info("Retention would delete PVC",
+			zap.String("name", pvc.Name),
+			zap.Duration("unused_for", unusedFor),
+		)
+		retentionClaims.WithLabelValues("dry_run").Inc()
+		return
+	}
+
+	// the UID precondition keeps a PVC recreated under the
+	// same name since the scan from being deleted
+	_, err := rc.api.DeletePVC(context.Background(), pvc.Name, DeletePVCOptions{
+		Caller: "retention",
+		Reason: fmt.Sprintf("unused for %s, longer than the retention TTL of %s", unusedFor.Round(time.Second), rc.TTL),
+		UID:    pvc.UID,
+	})
+	if err != nil {
+		rc.api.Log.Error("Retention got error invoking DeletePVC", zap.String("name", pvc.Name), zap.Error(err))
+		retentionClaims.WithLabelValues("skipped").Inc()
+		return
+	}
+
+	rc.api.Log.Info("Retention deleted PVC",
+		zap.String("name", pvc.Name),
+		zap.Duration("unused_for", unusedFor),
+	)
+	retentionClaims.WithLabelValues("deleted").Inc()
+}
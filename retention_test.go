@@ -0,0 +1,136 @@
+package volm
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	v1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+// retentionAPI returns an API over the pvcs recording events to
+// a fake recorder, and a RetentionController with a one hour TTL.
+func retentionAPI(t *testing.T, pvcs ...*v1.PersistentVolumeClaim) (*fake.Clientset, *record.FakeRecorder, *RetentionController) {
+	t.Helper()
+
+	cs := fake.NewSimpleClientset()
+	for _, pvc := range pvcs {
+		if err := cs.Tracker().Add(pvc); err != nil {
+			t.Fatalf("Add: %s", err)
+		}
+	}
+
+	a, _ := testAPI(t, &Config{Cs: cs})
+	recorder := record.NewFakeRecorder(10)
+	a.Recorder = recorder
+
+	rc, err := NewRetentionController(a, RetentionConfig{TTL: time.Hour})
+	if err != nil {
+		t.Fatalf("NewRetentionController: %s", err)
+	}
+	t.Cleanup(rc.Stop)
+
+	return cs, recorder, rc
+}
+
+// lastUsed returns a PVC stamped as last used ago
+func lastUsed(name string, ago time.Duration) *v1.PersistentVolumeClaim {
+	pvc := testPVC("default", name)
+	pvc.Annotations = map[string]string{LastUsedAnnotation: time.Now().Add(-ago).Format(time.RFC3339)}
+	return pvc
+}
+
+// deletedNames returns the names of the PVCs deleted through cs
+func deletedNames(cs *fake.Clientset) []string {
+	var names []string
+	for _, action := range deleteActions(cs) {
+		names = append(names, action.GetName())
+	}
+	return names
+}
+
+func TestRetentionTTL(t *testing.T) {
+	old := testPVC("default", "old")
+	old.CreationTimestamp = metaV1.NewTime(time.Now().Add(-48 * time.Hour))
+
+	cs, recorder, rc := retentionAPI(t,
+		lastUsed("expired", 2*time.Hour),
+		lastUsed("recent", 30*time.Minute),
+		old,
+	)
+
+	deleted := testutil.ToFloat64(retentionClaims.WithLabelValues("deleted"))
+	rc.Reconcile()
+
+	// an unstamped PVC must be seen unused for the TTL,
+	// however old it is
+	if names := deletedNames(cs); len(names) != 1 || names[0] != "expired" {
+		t.Fatalf("expected only expired deleted, got %v", names)
+	}
+	if got := testutil.ToFloat64(retentionClaims.WithLabelValues("deleted")); got != deleted+1 {
+		t.Errorf("expected the deleted counter to increase by 1, got %v", got-deleted)
+	}
+
+	// one event per delete, from the API's recorder
+	select {
+	case event := <-recorder.Events:
+		if !strings.HasPrefix(event, "Normal DeletedByVolm Deleted by volm on behalf of retention: unused for 2h") {
+			t.Errorf("unexpected event %q", event)
+		}
+	default:
+		t.Error("expected an event on the deleted PVC")
+	}
+	if len(recorder.Events) != 0 {
+		t.Errorf("expected one event, got %d more", len(recorder.Events))
+	}
+
+	// observed unused for longer than the TTL
+	rc.firstSeenUnused[old.UID] = time.Now().Add(-2 * time.Hour)
+	rc.Reconcile()
+
+	if names := deletedNames(cs); len(names) != 2 || names[1] != "old" {
+		t.Errorf("expected old deleted after the grace period, got %v", names)
+	}
+}
+
+func TestRetentionRetainAnnotation(t *testing.T) {
+	retained := lastUsed("retained", 2*time.Hour)
+	retained.Annotations[RetainAnnotation] = "true"
+
+	cs, recorder, rc := retentionAPI(t, retained)
+
+	skipped := testutil.ToFloat64(retentionClaims.WithLabelValues("skipped"))
+	rc.Reconcile()
+
+	if names := deletedNames(cs); len(names) != 0 {
+		t.Errorf("expected no delete of a retained PVC, got %v", names)
+	}
+	if len(recorder.Events) != 0 {
+		t.Errorf("expected no events, got %d", len(recorder.Events))
+	}
+	if got := testutil.ToFloat64(retentionClaims.WithLabelValues("skipped")); got != skipped+1 {
+		t.Errorf("expected the skipped counter to increase by 1, got %v", got-skipped)
+	}
+}
+
+func TestRetentionUIDPrecondition(t *testing.T) {
+	cs, _, rc := retentionAPI(t, lastUsed("data", 2*time.Hour))
+
+	// scanned before the PVC was recreated under the same name
+	scanned := *lastUsed("data", 2*time.Hour)
+	scanned.UID = "deleted-since"
+
+	skipped := testutil.ToFloat64(retentionClaims.WithLabelValues("skipped"))
+	rc.delete(scanned, 2*time.Hour)
+
+	if names := deletedNames(cs); len(names) != 0 {
+		t.Errorf("expected no delete of the recreated PVC, got %v", names)
+	}
+	if got := testutil.ToFloat64(retentionClaims.WithLabelValues("skipped")); got != skipped+1 {
+		t.Errorf("expected the skipped counter to increase by 1, got %v", got-skipped)
+	}
+}
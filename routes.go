@@ -0,0 +1,132 @@
+package volm
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIVersions lists the API versions served, each under a
+// path prefix of the same name.
+var APIVersions = []string{"v1"}
+
+// APIPrefix is the path prefix of the current API version.
+const APIPrefix = "/v1"
+
+// RegisterRoutes registers the status, probe and OpenAPI routes on
+// r and the vol/, storageclass/ and templates/ routes under prefix.
+// When prefix is not empty these routes are also registered
+// unprefixed as deprecated aliases, answered with a Deprecation
+// header and a Link to the prefixed route.
+func (a *API) RegisterRoutes(r *gin.Engine, prefix string) {
+	// status
+	r.GET("/", a.OkHandler(a.Version, a.Mode, a.Service))
+
+	// liveness
+	r.GET("/healthz", a.HealthzHandler())
+
+	// readiness
+	r.GET("/readyz", a.ReadyzHandler())
+
+	// OpenAPI document
+	r.GET("/openapi.json", a.OpenAPIHandler())
+
+	prefix = strings.TrimSuffix(prefix, "/")
+	a.registerVolRoutes(r.Group(prefix))
+
+	if prefix != "" {
+		a.registerVolRoutes(r.Group("/", deprecatedRoute(prefix)))
+	}
+}
+
+// registerVolRoutes registers the authenticated routes on g
+func (a *API) registerVolRoutes(g *gin.RouterGroup) {
+	// token auth, disabled when no tokens are set
+	auth := a.AuthMiddleware()
+
+	// removing PVC protection may require separate tokens
+	unprotectAuth := auth
+	if len(a.ProtectTokens) > 0 {
+		unprotectAuth = TokenAuthMiddleware(a.ProtectTokens)
+	}
+
+	// list PVCs
+	g.GET("vol/", auth, a.ListPVCHandler())
+
+	// delete PVCs by label selector
+	g.DELETE("vol/", auth, a.BulkDeletePVCHandler())
+
+	// re-list PVCs and pods into the stores
+	g.POST("vol/refresh", auth, a.RefreshHandler())
+
+	// PVC summary
+	g.GET("vol/-/summary", auth, a.SummaryHandler())
+
+	// PVC stats for dashboards, an alias of the summary
+	g.GET("vol/-/stats", auth, a.SummaryHandler())
+
+	// PVC usage by storage class, largest first
+	g.GET("vol/-/storageclasses", auth, a.StorageClassUsageHandler())
+
+	// PVC counts and requested bytes by label value
+	g.GET("vol/-/aggregate", auth, a.AggregatePVCHandler())
+
+	// list unused PVCs
+	g.GET("vol/-/unused", auth, a.UnusedPVCHandler())
+
+	// create PVC from a template
+	g.POST("vol/-/from-template/:template", auth, a.CreateFromTemplateHandler())
+
+	// get PVC by UID
+	g.GET("vol/-/uid/:uid", auth, a.GetPVCByUIDHandler())
+
+	// get PVC
+	g.GET("vol/:name", auth, a.GetPVCHandler())
+
+	// list PVC events
+	g.GET("vol/:name/events", auth, a.GetPVCEventsHandler())
+
+	// list pods using a PVC
+	g.GET("vol/:name/pods", auth, a.GetPVCPodsHandler())
+
+	// list PVC snapshots
+	g.GET("vol/:name/snapshots", auth, a.ListSnapshotsHandler())
+
+	// create PVC snapshot
+	g.POST("vol/:name/snapshots", auth, a.CreateSnapshotHandler())
+	g.POST("vol/:name/snapshot", auth, a.CreateSnapshotHandler())
+
+	// restore PVC snapshot to a new PVC
+	g.POST("vol/:name/restore", auth, a.RestoreSnapshotHandler())
+
+	// clone PVC
+	g.POST("vol/:name/clone", auth, a.ClonePVCHandler())
+
+	// delete PVC
+	g.DELETE("vol/:name", auth, a.DeletePVCHandler())
+
+	// patch PVC labels and annotations
+	g.PATCH("vol/:name/metadata", auth, a.PatchPVCMetadataHandler())
+
+	// protect PVC from deletion
+	g.POST("vol/:name/protect", auth, a.ProtectPVCHandler(true))
+
+	// remove PVC deletion protection
+	g.DELETE("vol/:name/protect", unprotectAuth, a.ProtectPVCHandler(false))
+
+	// list storage classes with PVC usage
+	g.GET("storageclass/", auth, a.ListStorageClassHandler())
+
+	// list PVC templates
+	g.GET("templates/", auth, a.ListTemplatesHandler())
+}
+
+// deprecatedRoute returns gin middleware marking responses of an
+// unprefixed alias as deprecated in favor of the route under prefix.
+func deprecatedRoute(prefix string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Deprecation", "true")
+		c.Header("Link", "<"+prefix+c.Request.URL.Path+">; rel=\"successor-version\"")
+		c.Next()
+	}
+}
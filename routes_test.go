@@ -0,0 +1,50 @@
+package volm
+
+import (
+	"net/http"
+	"testing"
+
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestDeprecatedRoutes(t *testing.T) {
+	cs := fake.NewSimpleClientset(testPVC("default", "data"), testPod("default", "web", "data"))
+	_, r := testAPI(t, &Config{Cs: cs})
+
+	for _, path := range []string{"/vol/", "/vol/data", "/vol/data/pods", "/vol/-/unused", "/storageclass/"} {
+		t.Run(path, func(t *testing.T) {
+			current := serve(r, http.MethodGet, APIPrefix+path, nil)
+			alias := serve(r, http.MethodGet, path, nil)
+
+			if current.Code != http.StatusOK {
+				t.Fatalf("expected 200 from %s, got %d", APIPrefix+path, current.Code)
+			}
+			if alias.Code != current.Code || alias.Body.String() != current.Body.String() {
+				t.Errorf("expected the alias to answer as %s, got %d %s", APIPrefix+path, alias.Code, alias.Body.String())
+			}
+
+			if current.Header().Get("Deprecation") != "" || current.Header().Get("Link") != "" {
+				t.Errorf("expected no deprecation headers under %s", APIPrefix)
+			}
+
+			if got := alias.Header().Get("Deprecation"); got != "true" {
+				t.Errorf("expected Deprecation true, got %q", got)
+			}
+			if got, want := alias.Header().Get("Link"), "<"+APIPrefix+path+">; rel=\"successor-version\""; got != want {
+				t.Errorf("expected Link %s, got %s", want, got)
+			}
+		})
+	}
+
+	// errors are the same through the alias
+	if w := serve(r, http.MethodGet, "/vol/missing", nil); w.Code != http.StatusNotFound || w.Header().Get("Deprecation") != "true" {
+		t.Errorf("expected a deprecated 404 for an unknown PVC, got %d", w.Code)
+	}
+
+	// status and probe routes are not versioned
+	for _, path := range []string{"/", "/healthz", "/readyz"} {
+		if w := serve(r, http.MethodGet, path, nil); w.Code != http.StatusOK || w.Header().Get("Deprecation") != "" {
+			t.Errorf("expected %s to answer 200 without deprecation, got %d", path, w.Code)
+		}
+	}
+}
@@ -0,0 +1,332 @@
+package volm
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// SnapshotGroupVersion is the CSI external snapshotter API
+const SnapshotGroupVersion = "snapshot.storage.k8s.io/v1"
+
+var volumeSnapshotResource = schema.GroupVersionResource{
+	Group:    "snapshot.storage.k8s.io",
+	Version:  "v1",
+	Resource: "volumesnapshots",
+}
+
+// SnapshotInfo summarizes a VolumeSnapshot of a PVC
+type SnapshotInfo struct {
+	Name              string       `json:"name"`
+	PVCName           string       `json:"pvcName"`
+	SnapshotClassName string       `json:"snapshotClassName,omitempty"`
+	ReadyToUse        bool         `json:"readyToUse"`
+	RestoreSize       string       `json:"restoreSize,omitempty"`
+	CreationTimestamp *metaV1.Time `json:"creationTimestamp,omitempty"`
+	Error             string       `json:"error,omitempty"`
+}
+
+// SnapshotRequest is the body of a create snapshot request
+type SnapshotRequest struct {
+	Name              string `json:"name"`
+	SnapshotClassName string `json:"snapshotClassName"`
+}
+
+// RestoreRequest is the body of a restore request. Size
+// defaults to the snapshot restore size.
+type RestoreRequest struct {
+	Snapshot string            `json:"snapshot" binding:"required"`
+	Name     string            `json:"name" binding:"required"`
+	Size     string            `json:"size"`
+	Labels   map[string]string `json:"labels"`
+}
+
+// errSnapshotsUnavailable is returned when no dynamic client is
+// configured or the snapshot CRDs are not installed.
+var errSnapshotsUnavailable = NewAPIError(http.StatusNotImplemented, CodeNotImplemented,
+	fmt.Sprintf("VolumeSnapshots are not available, %s is not installed or configured", SnapshotGroupVersion))
+
+// snapshotsAvailable returns errSnapshotsUnavailable unless the
+// snapshot API is served by the cluster.
+func (a *API) snapshotsAvailable() error {
+	if a.DynamicClient == nil {
+		return errSnapshotsUnavailable
+	}
+
+	_, err := a.Cs.Discovery().ServerResourcesForGroupVersion(SnapshotGroupVersion)
+	if IsNotFound(err) {
+		return errSnapshotsUnavailable
+	}
+
+	return err
+}
+
+func (a *API) CreateSnapshotHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// the body is optional, a snapshot with a generated
+		// name and the default class is created without one
+		req := SnapshotRequest{}
+		if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+			WriteError(c, errBadRequest(err.Error()))
+			return
+		}
+
+		snapshot, err := a.CreateSnapshot(requestContext(c), c.Param("name"), req)
+		if err != nil {
+			WriteError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, snapshot)
+	}
+}
+
+func (a *API) ListSnapshotsHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		snapshots, err := a.ListSnapshots(requestContext(c), c.Param("name"))
+		if err != nil {
+			WriteError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, snapshots)
+	}
+}
+
+func (a *API) RestoreSnapshotHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		req := RestoreRequest{}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			WriteError(c, errBadRequest(err.Error()))
+			return
+		}
+
+		volInfo, err := a.RestoreSnapshot(requestContext(c), c.Param("name"), req)
+		if err != nil {
+			WriteError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, volInfo)
+	}
+}
+
+// CreateSnapshot creates a VolumeSnapshot of a PVC meeting the
+// selector criteria. The snapshot name defaults to the PVC name
+// suffixed with the current time.
+func (a *API) CreateSnapshot(ctx context.Context, pvcName string, req SnapshotRequest) (info SnapshotInfo, err error) {
+	ctx, cancel := a.kubeContext(ctx)
+	defer cancel()
+
+	start := time.Now()
+	defer func() {
+		a.audit(ctx, "create_snapshot", pvcName, CallerFromContext(ctx), start, err)
+	}()
+
+	if a.ReadOnly {
+		return SnapshotInfo{}, errReadOnly()
+	}
+
+	if err := a.snapshotsAvailable(); err != nil {
+		return SnapshotInfo{}, err
+	}
+
+	if _, err := a.GetPVC(pvcName); err != nil {
+		return SnapshotInfo{}, err
+	}
+
+	name := req.Name
+	if name == "" {
+		name = fmt.Sprintf("%s-%s", pvcName, time.Now().UTC().Format("20060102150405"))
+	}
+
+	spec := map[string]interface{}{
+		"source": map[string]interface{}{
+			"persistentVolumeClaimName": pvcName,
+		},
+	}
+	if req.SnapshotClassName != "" {
+		spec["volumeSnapshotClassName"] = req.SnapshotClassName
+	}
+
+	snapshot := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": SnapshotGroupVersion,
+		"kind":       "VolumeSnapshot",
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": a.PVCNamespace,
+		},
+		"spec": spec,
+	}}
+
+	created, err := a.DynamicClient.Resource(volumeSnapshotResource).Namespace(a.PVCNamespace).Create(ctx, snapshot, metaV1.CreateOptions{})
+	if err != nil {
+		a.logger(ctx).Error("CreateSnapshot got error invoking VolumeSnapshot Create", zap.Error(err))
+		return SnapshotInfo{}, err
+	}
+
+	return snapshotInfo(*created), nil
+}
+
+// ListSnapshots returns the VolumeSnapshots of a PVC meeting
+// the selector criteria, newest first.
+func (a *API) ListSnapshots(ctx context.Context, pvcName string) ([]SnapshotInfo, error) {
+	ctx, cancel := a.kubeContext(ctx)
+	defer cancel()
+	snapshots := make([]SnapshotInfo, 0)
+
+	if err := a.snapshotsAvailable(); err != nil {
+		return snapshots, err
+	}
+
+	if _, err := a.GetPVC(pvcName); err != nil {
+		return snapshots, err
+	}
+
+	list, err := a.DynamicClient.Resource(volumeSnapshotResource).Namespace(a.PVCNamespace).List(ctx, metaV1.ListOptions{})
+	if err != nil {
+		a.logger(ctx).Error("ListSnapshots got error invoking VolumeSnapshot List", zap.Error(err))
+		return snapshots, err
+	}
+
+	for _, item := range list.Items {
+		info := snapshotInfo(item)
+		if info.PVCName == pvcName {
+			snapshots = append(snapshots, info)
+		}
+	}
+
+	sort.SliceStable(snapshots, func(i, j int) bool {
+		return snapshots[j].CreationTimestamp.Before(snapshots[i].CreationTimestamp)
+	})
+
+	return snapshots, nil
+}
+
+// RestoreSnapshot creates a new PVC from a VolumeSnapshot of the
+// named PVC, copying its storage class and access modes and the
+// selector labels so the new PVC is visible through the API.
+func (a *API) RestoreSnapshot(ctx context.Context, pvcName string, req RestoreRequest) (volInfo VolumeInfo, err error) {
+	ctx, cancel := a.kubeContext(ctx)
+	defer cancel()
+
+	start := time.Now()
+	defer func() {
+		a.audit(ctx, "restore_snapshot", pvcName, CallerFromContext(ctx), start, err)
+	}()
+
+	if a.ReadOnly {
+		return VolumeInfo{}, errReadOnly()
+	}
+
+	if err := a.snapshotsAvailable(); err != nil {
+		return VolumeInfo{}, err
+	}
+
+	source := a.PVCStore.GetPVC(pvcName)
+	if source == nil {
+		return VolumeInfo{}, errPVCNotFound(pvcName)
+	}
+
+	if err := a.checkSelector(source.ObjectMeta); err != nil {
+		return VolumeInfo{}, err
+	}
+
+	item, err := a.DynamicClient.Resource(volumeSnapshotResource).Namespace(a.PVCNamespace).Get(ctx, req.Snapshot, metaV1.GetOptions{})
+	if err != nil {
+		return VolumeInfo{}, err
+	}
+
+	snapshot := snapshotInfo(*item)
+	if snapshot.PVCName != pvcName {
+		return VolumeInfo{}, errBadRequest("snapshot %s is not a snapshot of %s", req.Snapshot, pvcName)
+	}
+
+	size := req.Size
+	if size == "" {
+		size = snapshot.RestoreSize
+	}
+	if size == "" {
+		return VolumeInfo{}, errBadRequest("snapshot %s has no restore size yet, specify a size", req.Snapshot)
+	}
+
+	quantity, err := resource.ParseQuantity(size)
+	if err != nil {
+		return VolumeInfo{}, errBadRequest("invalid size %s: %s", size, err.Error())
+	}
+
+	labels := map[string]string{}
+	for k, v := range req.Labels {
+		labels[k] = v
+	}
+	for k, v := range a.PVCSelectorMap {
+		labels[k] = v
+	}
+
+	// keep the new PVC visible to the annotation selector
+	annotations := map[string]string{}
+	for k, v := range a.AnnotationMap {
+		annotations[k] = v
+	}
+
+	apiGroup := volumeSnapshotResource.Group
+	pvc := &v1.PersistentVolumeClaim{
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:        req.Name,
+			Namespace:   a.PVCNamespace,
+			Labels:      labels,
+			Annotations: annotations,
+		},
+		Spec: v1.PersistentVolumeClaimSpec{
+			AccessModes:      source.Spec.AccessModes,
+			StorageClassName: source.Spec.StorageClassName,
+			VolumeMode:       source.Spec.VolumeMode,
+			Resources: v1.ResourceRequirements{
+				Requests: v1.ResourceList{v1.ResourceStorage: quantity},
+			},
+			DataSource: &v1.TypedLocalObjectReference{
+				APIGroup: &apiGroup,
+				Kind:     "VolumeSnapshot",
+				Name:     req.Snapshot,
+			},
+		},
+	}
+
+	created, err := a.Cs.CoreV1().PersistentVolumeClaims(a.PVCNamespace).Create(ctx, pvc, metaV1.CreateOptions{})
+	if err != nil {
+		a.logger(ctx).Error("RestoreSnapshot got error invoking pvcClient.Create", zap.Error(err))
+		return VolumeInfo{}, err
+	}
+
+	return a.volumeInfo(*created)
+}
+
+// snapshotInfo maps an unstructured VolumeSnapshot
+// to a SnapshotInfo.
+func snapshotInfo(u unstructured.Unstructured) SnapshotInfo {
+	creationTimestamp := u.GetCreationTimestamp()
+
+	info := SnapshotInfo{
+		Name:              u.GetName(),
+		CreationTimestamp: &creationTimestamp,
+	}
+
+	info.PVCName, _, _ = unstructured.NestedString(u.Object, "spec", "source", "persistentVolumeClaimName")
+	info.SnapshotClassName, _, _ = unstructured.NestedString(u.Object, "spec", "volumeSnapshotClassName")
+	info.ReadyToUse, _, _ = unstructured.NestedBool(u.Object, "status", "readyToUse")
+	info.RestoreSize, _, _ = unstructured.NestedString(u.Object, "status", "restoreSize")
+	info.Error, _, _ = unstructured.NestedString(u.Object, "status", "error", "message")
+
+	return info
+}
@@ -0,0 +1,143 @@
+package volm
+
+import (
+	"context"
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	storageV1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// StorageClassInfo describes a StorageClass along with the
+// usage of the PVCs meeting the selector criteria.
+type StorageClassInfo struct {
+	Name                 string `json:"name"`
+	Provisioner          string `json:"provisioner,omitempty"`
+	AllowVolumeExpansion bool   `json:"allowVolumeExpansion"`
+	ReclaimPolicy        string `json:"reclaimPolicy,omitempty"`
+	StorageClassUsage
+}
+
+func (a *API) ListStorageClassHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		classes, err := a.GetStorageClassList(requestContext(c))
+		if err != nil {
+			WriteError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, classes)
+	}
+}
+
+// GetStorageClassList returns every StorageClass, plus the
+// NoStorageClass group and any classes referenced by PVCs that
+// no longer exist, sorted by name.
+func (a *API) GetStorageClassList(ctx context.Context) ([]StorageClassInfo, error) {
+	ctx, cancel := a.kubeContext(ctx)
+	defer cancel()
+
+	scList, err := a.Cs.StorageV1().StorageClasses().List(ctx, metaV1.ListOptions{})
+	if err != nil {
+		a.logger(ctx).Error("GetStorageClassList got error invoking StorageClasses.List", zap.Error(err))
+		return nil, err
+	}
+
+	_, byClass := a.storageClassUsage()
+
+	classes := make([]StorageClassInfo, 0, len(scList.Items))
+	for i := range scList.Items {
+		sc := &scList.Items[i]
+
+		ua, ok := byClass[sc.Name]
+		if !ok {
+			ua = newUsageAccumulator()
+		}
+		delete(byClass, sc.Name)
+
+		classes = append(classes, newStorageClassInfo(sc.Name, sc, ua))
+	}
+
+	for class, ua := range byClass {
+		classes = append(classes, StorageClassInfo{
+			Name:              class,
+			StorageClassUsage: ua.usage(),
+		})
+	}
+
+	sort.Slice(classes, func(i, j int) bool {
+		return classes[i].Name < classes[j].Name
+	})
+
+	return classes, nil
+}
+
+// newStorageClassInfo combines a StorageClass, nil when it is
+// unknown, with the usage of its PVCs.
+func newStorageClassInfo(name string, sc *storageV1.StorageClass, ua *usageAccumulator) StorageClassInfo {
+	info := StorageClassInfo{
+		Name:              name,
+		StorageClassUsage: ua.usage(),
+	}
+
+	if sc == nil {
+		return info
+	}
+
+	info.Provisioner = sc.Provisioner
+
+	if sc.AllowVolumeExpansion != nil {
+		info.AllowVolumeExpansion = *sc.AllowVolumeExpansion
+	}
+
+	if sc.ReclaimPolicy != nil {
+		info.ReclaimPolicy = string(*sc.ReclaimPolicy)
+	}
+
+	return info
+}
+
+func (a *API) StorageClassUsageHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !a.requireSynced(c) {
+			return
+		}
+
+		c.JSON(http.StatusOK, a.StorageClassUsage())
+	}
+}
+
+// StorageClassUsage aggregates the PVCs meeting the selector
+// criteria by storage class directly from the PVC store, sorted
+// by requested capacity descending. Classes only include their
+// provisioner and expansion flag when StorageClassLister is set.
+func (a *API) StorageClassUsage() []StorageClassInfo {
+	_, byClass := a.storageClassUsage()
+
+	classes := make([]StorageClassInfo, 0, len(byClass))
+	for class, ua := range byClass {
+		var sc *storageV1.StorageClass
+		if a.StorageClassLister != nil && class != NoStorageClass {
+			var err error
+			sc, err = a.StorageClassLister.Get(class)
+			if err != nil && !errors.IsNotFound(err) {
+				a.Log.Warn("StorageClassUsage got error invoking StorageClassLister.Get", zap.String("storage_class", class), zap.Error(err))
+			}
+		}
+
+		classes = append(classes, newStorageClassInfo(class, sc, ua))
+	}
+
+	sort.Slice(classes, func(i, j int) bool {
+		if classes[i].RequestedBytes != classes[j].RequestedBytes {
+			return classes[i].RequestedBytes > classes[j].RequestedBytes
+		}
+		return classes[i].Name < classes[j].Name
+	})
+
+	return classes
+}
@@ -0,0 +1,136 @@
+package volm
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// maxDeletedChanges bounds the deletions remembered for
+// ChangesSince, older tokens expire once it is exceeded.
+const maxDeletedChanges = 1000
+
+var (
+	// ErrTokenExpired is returned by ChangesSince for tokens older
+	// than the remembered deletions or issued by another process.
+	ErrTokenExpired = errors.New("change token expired")
+
+	// ErrMalformedToken is returned by ChangesSince
+	// for tokens it did not issue.
+	ErrMalformedToken = errors.New("malformed change token")
+)
+
+// pvcChanges tracks a version bumped on every store change and the
+// version each PVC last changed at. Tokens are the store epoch and
+// version, so tokens from before a restart are not mistaken for
+// current ones. Callers hold the PVCStore lock.
+type pvcChanges struct {
+	epoch   string
+	version uint64
+
+	// compacted is the newest version of a forgotten deletion,
+	// changes since older tokens are incomplete
+	compacted uint64
+	byName    map[string]pvcChange
+	deleted   int
+
+	// next is closed and replaced on every change
+	next chan struct{}
+}
+
+// pvcChange keeps the metadata of deleted PVCs so deletions
+// can still be matched against selectors.
+type pvcChange struct {
+	version uint64
+	deleted *metaV1.ObjectMeta
+}
+
+func (pc *pvcChanges) init() {
+	pc.epoch = strconv.FormatInt(time.Now().UnixNano(), 36)
+	pc.byName = make(map[string]pvcChange)
+	pc.next = make(chan struct{})
+}
+
+// record bumps the version for a change to the named PVC, deleted
+// is the metadata of a removed PVC, and wakes the callers waiting
+// on next.
+func (pc *pvcChanges) record(name string, deleted *metaV1.ObjectMeta) {
+	pc.version++
+
+	if prev, ok := pc.byName[name]; ok && prev.deleted != nil {
+		pc.deleted--
+	}
+	pc.byName[name] = pvcChange{version: pc.version, deleted: deleted}
+	if deleted != nil {
+		pc.deleted++
+	}
+
+	if pc.deleted > maxDeletedChanges {
+		pc.forgetOldestDeleted()
+	}
+
+	close(pc.next)
+	pc.next = make(chan struct{})
+}
+
+// forgetOldestDeleted drops the oldest deletion
+func (pc *pvcChanges) forgetOldestDeleted() {
+	oldest := ""
+	for name, change := range pc.byName {
+		if change.deleted != nil && (oldest == "" || change.version < pc.byName[oldest].version) {
+			oldest = name
+		}
+	}
+
+	pc.compacted = pc.byName[oldest].version
+	delete(pc.byName, oldest)
+	pc.deleted--
+}
+
+func (pc *pvcChanges) token() string {
+	return fmt.Sprintf("%s-%d", pc.epoch, pc.version)
+}
+
+// since returns the names of the PVCs changed and the metadata
+// of those deleted after token, sorted by name.
+func (pc *pvcChanges) since(token string) ([]string, []metaV1.ObjectMeta, error) {
+	parts := strings.SplitN(token, "-", 2)
+	if len(parts) != 2 {
+		return nil, nil, ErrMalformedToken
+	}
+
+	version, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return nil, nil, ErrMalformedToken
+	}
+
+	if parts[0] != pc.epoch || version > pc.version || version < pc.compacted {
+		return nil, nil, ErrTokenExpired
+	}
+
+	changed := make([]string, 0)
+	deleted := make([]metaV1.ObjectMeta, 0)
+	for name, change := range pc.byName {
+		if change.version <= version {
+			continue
+		}
+
+		if change.deleted != nil {
+			deleted = append(deleted, *change.deleted)
+		} else {
+			changed = append(changed, name)
+		}
+	}
+
+	sort.Strings(changed)
+	sort.Slice(deleted, func(i, j int) bool {
+		return deleted[i].Name < deleted[j].Name
+	})
+
+	return changed, deleted, nil
+}
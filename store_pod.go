@@ -2,35 +2,125 @@ package volm
 
 import (
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
 	"go.uber.org/zap"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/clock"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
 )
 
+// DefaultResyncPeriod is the informer resync period used
+// when a store config does not set one.
+const DefaultResyncPeriod = time.Second * 60
+
 type PodStoreConfig struct {
 	Namespace string
 	Log       *zap.Logger
-	Cs        *kubernetes.Clientset
+	Cs        kubernetes.Interface
+
+	// ResyncPeriod of the informer, defaults to DefaultResyncPeriod
+	ResyncPeriod time.Duration
+
+	// SharedInformerFactory, when set, supplies the informer in
+	// place of a factory of the store's own and Cs and ResyncPeriod
+	// are not used. It may watch all namespaces, objects outside
+	// Namespace are ignored. Its owner starts and stops it.
+	SharedInformerFactory informers.SharedInformerFactory
 }
 
 type PodStore struct {
 	*PodStoreConfig
-	Stopper chan struct{}
-	podMap  map[string]v1.Pod
+	Stopper   chan struct{}
+	podMap    map[string]v1.Pod
+	pvcToPods map[string]map[string]PodInfo
+	synced    cache.InformerSynced
+	source    cache.Store
+	lastEvent time.Time
+	clock     clock.PassiveClock
+	handlers  podHandlers
 	sync.Mutex
 }
 
-func NewPodStore(cfg *PodStoreConfig) (*PodStore, error) {
-	ps := &PodStore{PodStoreConfig: cfg}
+// PodHandler is called with the pod of a store event
+type PodHandler func(pod v1.Pod)
 
-	if ps.Cs == nil {
-		return nil, fmt.Errorf("must specify kubernetes.Clientset")
+// PodChangeHandler is called with the previous and
+// the updated pod of a store update
+type PodChangeHandler func(oldPod, newPod v1.Pod)
+
+// podHandlers holds the handlers registered on a PodStore
+type podHandlers struct {
+	add    []PodHandler
+	update []PodHandler
+	delete []PodHandler
+	change []PodChangeHandler
+	sync.RWMutex
+}
+
+// OnAdd registers a handler called after a pod is added to the
+// store. Handlers run on the informer goroutine and must not block.
+func (ps *PodStore) OnAdd(fn PodHandler) {
+	ps.handlers.Lock()
+	ps.handlers.add = append(ps.handlers.add, fn)
+	ps.handlers.Unlock()
+}
+
+// OnUpdate registers a handler called after a pod is updated in
+// the store, resyncs of unchanged pods are skipped. Handlers run
+// on the informer goroutine and must not block.
+func (ps *PodStore) OnUpdate(fn PodHandler) {
+	ps.handlers.Lock()
+	ps.handlers.update = append(ps.handlers.update, fn)
+	ps.handlers.Unlock()
+}
+
+// OnDelete registers a handler called after a pod is removed from
+// the store. Handlers run on the informer goroutine and must not block.
+func (ps *PodStore) OnDelete(fn PodHandler) {
+	ps.handlers.Lock()
+	ps.handlers.delete = append(ps.handlers.delete, fn)
+	ps.handlers.Unlock()
+}
+
+// OnChange registers a handler called with the previous and the
+// updated pod after a pod is updated in the store, resyncs of
+// unchanged pods are skipped. Handlers run on the informer
+// goroutine and must not block.
+func (ps *PodStore) OnChange(fn PodChangeHandler) {
+	ps.handlers.Lock()
+	ps.handlers.change = append(ps.handlers.change, fn)
+	ps.handlers.Unlock()
+}
+
+// notifyChange calls each change handler with the pods
+func (h *podHandlers) notifyChange(oldPod, newPod v1.Pod) {
+	h.RLock()
+	fns := h.change
+	h.RUnlock()
+
+	for _, fn := range fns {
+		fn(oldPod, newPod)
+	}
+}
+
+// notify calls each handler with the pod
+func (h *podHandlers) notify(handlers *[]PodHandler, pod v1.Pod) {
+	h.RLock()
+	fns := *handlers
+	h.RUnlock()
+
+	for _, fn := range fns {
+		fn(pod)
 	}
+}
+
+func NewPodStore(cfg *PodStoreConfig) (*PodStore, error) {
+	ps := &PodStore{PodStoreConfig: cfg}
 
 	if ps.Log == nil {
 		return nil, fmt.Errorf("must specify zap.Logger")
@@ -40,53 +130,312 @@ func NewPodStore(cfg *PodStoreConfig) (*PodStore, error) {
 		return nil, fmt.Errorf("must specify a Namespace")
 	}
 
-	ps.podMap = make(map[string]v1.Pod, 0)
-	ps.Stopper = make(chan struct{})
-	ps.PodWatch()
+	if ps.SharedInformerFactory != nil {
+		ps.init()
+		ps.PodWatch(ps.SharedInformerFactory.Core().V1().Pods().Informer())
+
+		return ps, nil
+	}
+
+	if ps.Cs == nil {
+		return nil, fmt.Errorf("must specify kubernetes.Interface")
+	}
+
+	if ps.ResyncPeriod < 0 {
+		return nil, fmt.Errorf("ResyncPeriod must not be negative")
+	}
+
+	if ps.ResyncPeriod == 0 {
+		ps.ResyncPeriod = DefaultResyncPeriod
+	}
+
+	factory := informers.NewSharedInformerFactoryWithOptions(ps.Cs, ps.ResyncPeriod, informers.WithNamespace(ps.Namespace))
+
+	ps.init()
+	ps.PodWatch(factory.Core().V1().Pods().Informer())
+	factory.Start(ps.Stopper)
 
 	return ps, nil
 }
 
-func (ps *PodStore) PodWatch() {
-	factory := informers.NewSharedInformerFactoryWithOptions(ps.Cs, time.Second*60, informers.WithNamespace(ps.Namespace))
-	informer := factory.Core().V1().Pods().Informer()
+// NewPodStoreFromInformer returns a PodStore fed by a pod informer
+// the caller owns, typically from a SharedInformerFactory shared
+// with a PVCStore. The caller is responsible for starting it.
+func NewPodStoreFromInformer(informer cache.SharedIndexInformer, log *zap.Logger) (*PodStore, error) {
+	if informer == nil {
+		return nil, fmt.Errorf("must specify cache.SharedIndexInformer")
+	}
+
+	if log == nil {
+		return nil, fmt.Errorf("must specify zap.Logger")
+	}
+
+	ps := &PodStore{PodStoreConfig: &PodStoreConfig{Log: log}}
+	ps.init()
+	ps.PodWatch(informer)
+
+	return ps, nil
+}
+
+func (ps *PodStore) init() {
+	ps.podMap = make(map[string]v1.Pod, 0)
+	ps.pvcToPods = make(map[string]map[string]PodInfo, 0)
+	ps.Stopper = make(chan struct{})
+	ps.clock = clock.RealClock{}
+}
+
+// PodWatch registers the store's event handlers on the informer
+func (ps *PodStore) PodWatch(informer cache.SharedIndexInformer) {
+	ps.synced = informer.HasSynced
+	ps.source = informer.GetStore()
+	ps.touch()
+	storeLastEvent.track("pod", ps)
+
+	// surface watch failures that would otherwise
+	// leave the store silently serving old data
+	err := informer.SetWatchErrorHandler(func(r *cache.Reflector, err error) {
+		informerWatchErrors.WithLabelValues("pod").Inc()
+		ps.Log.Warn("Informer watch error", zap.String("resource", "pod"), zap.Error(err))
+	})
+	if err != nil {
+		ps.Log.Error("Unable to set watch error handler", zap.String("resource", "pod"), zap.Error(err))
+	}
 
 	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
+			informerEvents.WithLabelValues("pod", "add").Inc()
+			ps.touch()
 			pod := obj.(*v1.Pod)
+			if !ps.inNamespace(pod.Namespace) {
+				return
+			}
 			ps.AddPod(*pod)
+			ps.handlers.notify(&ps.handlers.add, *pod)
 		},
 		DeleteFunc: func(obj interface{}) {
-			pod := obj.(*v1.Pod)
+			informerEvents.WithLabelValues("pod", "delete").Inc()
+			ps.touch()
+			// deletes missed while the watch was down
+			// arrive wrapped in a tombstone
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			pod, ok := obj.(*v1.Pod)
+			if !ok || !ps.inNamespace(pod.Namespace) {
+				return
+			}
 			ps.DeletePod(pod.Name)
+			ps.handlers.notify(&ps.handlers.delete, *pod)
 		},
 		UpdateFunc: func(oldObj, newObj interface{}) {
+			informerEvents.WithLabelValues("pod", "update").Inc()
+			ps.touch()
 			pod := newObj.(*v1.Pod)
+			if !ps.inNamespace(pod.Namespace) {
+				return
+			}
 			ps.AddPod(*pod)
+
+			// resyncs deliver unchanged pods, handlers
+			// only see real updates
+			oldPod, ok := oldObj.(*v1.Pod)
+			if ok && oldPod.ResourceVersion == pod.ResourceVersion {
+				return
+			}
+			ps.handlers.notify(&ps.handlers.update, *pod)
+			if ok {
+				ps.handlers.notifyChange(*oldPod, *pod)
+			}
 		},
 	})
-
-	go informer.Run(ps.Stopper)
 }
 
 func (ps *PodStore) AddPod(pod v1.Pod) {
 	ps.Lock()
 	ps.Log.Info("AddPod", zap.String("name", pod.Name))
+
+	// on update drop the pod from claims it no longer references
+	if oldPod, ok := ps.podMap[pod.Name]; ok {
+		ps.unindexPod(oldPod)
+	}
+
 	ps.podMap[pod.Name] = pod
+	ps.indexPod(pod)
+	storePodCount.Set(float64(len(ps.podMap)))
 	ps.Unlock()
 }
 
 func (ps *PodStore) DeletePod(podName string) {
 	ps.Lock()
-	_, ok := ps.podMap[podName]
+	pod, ok := ps.podMap[podName]
 	if ok {
 		ps.Log.Info("DeletePod", zap.String("name", podName))
+		ps.unindexPod(pod)
 		delete(ps.podMap, podName)
+		storePodCount.Set(float64(len(ps.podMap)))
 	}
 	ps.Unlock()
 }
 
+// Replace swaps the stored pods for the given list, for
+// reconciling the store with a live list.
+func (ps *PodStore) Replace(pods []v1.Pod) {
+	ps.Lock()
+	ps.Log.Info("ReplacePods", zap.Int("count", len(pods)))
+	ps.podMap = make(map[string]v1.Pod, len(pods))
+	ps.pvcToPods = make(map[string]map[string]PodInfo)
+	for _, pod := range pods {
+		ps.podMap[pod.Name] = pod
+		ps.indexPod(pod)
+	}
+	storePodCount.Set(float64(len(ps.podMap)))
+	ps.Unlock()
+}
+
+// Resync rebuilds the store from the informer cache, the source
+// of truth, so pods added or removed by missed or mishandled events
+// are corrected. It returns the number of pods that differed and
+// only replaces the store when there are any.
+func (ps *PodStore) Resync() int {
+	if ps.source == nil {
+		return 0
+	}
+
+	var pods []v1.Pod
+	for _, obj := range ps.source.List() {
+		if pod, ok := obj.(*v1.Pod); ok && ps.inNamespace(pod.Namespace) {
+			pods = append(pods, *pod)
+		}
+	}
+
+	ps.Lock()
+	drift := 0
+	current := make(map[string]bool, len(pods))
+	for _, pod := range pods {
+		current[pod.Name] = true
+		stored, ok := ps.podMap[pod.Name]
+		if !ok || stored.ResourceVersion != pod.ResourceVersion {
+			drift++
+		}
+	}
+	for name := range ps.podMap {
+		if !current[name] {
+			drift++
+		}
+	}
+	ps.Unlock()
+
+	if drift > 0 {
+		storeDrift.WithLabelValues("pod").Add(float64(drift))
+		ps.Log.Warn("Pod store drifted from the informer cache", zap.Int("drift", drift))
+		ps.Replace(pods)
+	}
+
+	return drift
+}
+
+// inNamespace returns true for objects in the store's Namespace,
+// a shared informer may deliver every namespace. A store without
+// a Namespace, fed by NewPodStoreFromInformer, keeps all objects.
+func (ps *PodStore) inNamespace(ns string) bool {
+	return ps.Namespace == "" || ps.Namespace == ns
+}
+
+// indexPod adds the pod to the pvcToPods entry of each
+// claim it references, callers must hold the lock.
+func (ps *PodStore) indexPod(pod v1.Pod) {
+	for _, v := range pod.Spec.Volumes {
+		if v.PersistentVolumeClaim == nil {
+			continue
+		}
+
+		claimName := v.PersistentVolumeClaim.ClaimName
+		if _, ok := ps.pvcToPods[claimName]; !ok {
+			ps.pvcToPods[claimName] = make(map[string]PodInfo)
+		}
+
+		ps.pvcToPods[claimName][pod.Name] = podInfo(pod, v.Name)
+	}
+}
+
+// unindexPod removes the pod from the pvcToPods entry of
+// each claim it references, callers must hold the lock.
+func (ps *PodStore) unindexPod(pod v1.Pod) {
+	for _, v := range pod.Spec.Volumes {
+		if v.PersistentVolumeClaim == nil {
+			continue
+		}
+
+		claimName := v.PersistentVolumeClaim.ClaimName
+		delete(ps.pvcToPods[claimName], pod.Name)
+		if len(ps.pvcToPods[claimName]) == 0 {
+			delete(ps.pvcToPods, claimName)
+		}
+	}
+}
+
+// touch records an informer event
+func (ps *PodStore) touch() {
+	ps.Lock()
+	ps.lastEvent = ps.clock.Now()
+	ps.Unlock()
+}
+
+// LastEventTime returns the time of the last informer event,
+// or when the store started watching if there were none.
+func (ps *PodStore) LastEventTime() time.Time {
+	ps.Lock()
+	defer ps.Unlock()
+
+	return ps.lastEvent
+}
+
+// Stale returns true if the store holds objects but has not
+// received an event for longer than maxAge, a maxAge of zero
+// disables the check. An empty store receives no resync events
+// so it is never stale.
+func (ps *PodStore) Stale(maxAge time.Duration) bool {
+	ps.Lock()
+	defer ps.Unlock()
+
+	if maxAge <= 0 || len(ps.podMap) == 0 {
+		return false
+	}
+
+	return ps.clock.Since(ps.lastEvent) > maxAge
+}
+
+// HasSynced returns true once the informer has delivered
+// the initial list of pods.
+func (ps *PodStore) HasSynced() bool {
+	return ps.synced != nil && ps.synced()
+}
+
+// PodsForPVC returns PodInfo for every pod referencing
+// the named PVC, sorted by namespace then name.
+func (ps *PodStore) PodsForPVC(pvcName string) []PodInfo {
+	ps.Lock()
+	defer ps.Unlock()
+
+	var podInfoList []PodInfo
+	for _, p := range ps.pvcToPods[pvcName] {
+		podInfoList = append(podInfoList, p)
+	}
+
+	sort.Slice(podInfoList, func(i, j int) bool {
+		if podInfoList[i].Namespace != podInfoList[j].Namespace {
+			return podInfoList[i].Namespace < podInfoList[j].Namespace
+		}
+		return podInfoList[i].Name < podInfoList[j].Name
+	})
+
+	return podInfoList
+}
+
 func (ps *PodStore) GetPod(podName string) *v1.Pod {
+	ps.Lock()
+	defer ps.Unlock()
+
 	pod, ok := ps.podMap[podName]
 	if ok {
 		return &pod
@@ -94,10 +443,21 @@ func (ps *PodStore) GetPod(podName string) *v1.Pod {
 	return nil
 }
 
+// GetPods returns the stored pods sorted by namespace then name.
 func (ps *PodStore) GetPods() []v1.Pod {
+	ps.Lock()
 	var pods []v1.Pod
 	for _, p := range ps.podMap {
 		pods = append(pods, p)
 	}
+	ps.Unlock()
+
+	sort.Slice(pods, func(i, j int) bool {
+		if pods[i].Namespace != pods[j].Namespace {
+			return pods[i].Namespace < pods[j].Namespace
+		}
+		return pods[i].Name < pods[j].Name
+	})
+
 	return pods
 }
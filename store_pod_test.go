@@ -0,0 +1,194 @@
+package volm
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func testPodStore() *PodStore {
+	ps := &PodStore{PodStoreConfig: &PodStoreConfig{Log: zap.NewNop()}}
+	ps.init()
+
+	return ps
+}
+
+// podNames returns the names of the pods indexed for the PVC
+func podNames(ps *PodStore, pvcName string) []string {
+	names := make([]string, 0)
+	for _, p := range ps.PodsForPVC(pvcName) {
+		names = append(names, p.Name)
+	}
+
+	return names
+}
+
+func TestPodStoreIndex(t *testing.T) {
+	ps := testPodStore()
+
+	ps.AddPod(*testPod("default", "web", "data"))
+	ps.AddPod(*testPod("default", "batch", "data"))
+	if names := podNames(ps, "data"); len(names) != 2 || names[0] != "batch" || names[1] != "web" {
+		t.Fatalf("expected batch and web to use data, got %v", names)
+	}
+
+	// an update moving web to another claim drops it from data
+	pod := testPod("default", "web", "logs")
+	pod.Spec.Volumes = append(pod.Spec.Volumes, v1.Volume{
+		Name: "scratch",
+		VolumeSource: v1.VolumeSource{
+			PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{ClaimName: "scratch"},
+		},
+	})
+	ps.AddPod(*pod)
+
+	if names := podNames(ps, "data"); len(names) != 1 || names[0] != "batch" {
+		t.Errorf("expected only batch to use data, got %v", names)
+	}
+	for _, claim := range []string{"logs", "scratch"} {
+		if names := podNames(ps, claim); len(names) != 1 || names[0] != "web" {
+			t.Errorf("expected web to use %s, got %v", claim, names)
+		}
+	}
+
+	ps.DeletePod("web")
+	ps.DeletePod("batch")
+
+	if len(ps.pvcToPods) != 0 {
+		t.Errorf("expected an empty index after deleting every pod, got %v", ps.pvcToPods)
+	}
+	if len(ps.podMap) != 0 {
+		t.Errorf("expected no pods, got %d", len(ps.podMap))
+	}
+}
+
+func TestPodStoreStale(t *testing.T) {
+	ps := testPodStore()
+	fakeClock := clock.NewFakeClock(time.Now())
+	ps.clock = fakeClock
+	ps.touch()
+
+	// an empty store receives no resyncs
+	fakeClock.Step(time.Hour)
+	if ps.Stale(time.Minute) {
+		t.Error("expected an empty store never to be stale")
+	}
+
+	ps.touch()
+	ps.AddPod(*testPod("default", "web", "data"))
+
+	fakeClock.Step(30 * time.Second)
+	if ps.Stale(time.Minute) {
+		t.Error("expected the store to be fresh within maxAge")
+	}
+
+	fakeClock.Step(time.Minute)
+	if !ps.Stale(time.Minute) {
+		t.Error("expected the store to be stale past maxAge without events")
+	}
+
+	if ps.Stale(0) {
+		t.Error("expected a zero maxAge to disable the check")
+	}
+
+	ps.touch()
+	if ps.Stale(time.Minute) {
+		t.Error("expected an event to make the store fresh")
+	}
+
+	if !ps.LastEventTime().Equal(fakeClock.Now()) {
+		t.Errorf("expected the last event at %s, got %s", fakeClock.Now(), ps.LastEventTime())
+	}
+}
+
+// receivePod returns the next pod sent on ch, failing
+// the test if none arrives in time.
+func receivePod(t *testing.T, ch <-chan v1.Pod, event string) v1.Pod {
+	t.Helper()
+
+	select {
+	case pod := <-ch:
+		return pod
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no %s callback", event)
+	}
+
+	return v1.Pod{}
+}
+
+func TestPodStoreCallbacks(t *testing.T) {
+	cs := fake.NewSimpleClientset()
+	ps, err := NewPodStore(&PodStoreConfig{Namespace: "default", Log: zap.NewNop(), Cs: cs})
+	if err != nil {
+		t.Fatalf("NewPodStore: %s", err)
+	}
+	defer close(ps.Stopper)
+
+	added := make(chan v1.Pod, 1)
+	updated := make(chan v1.Pod, 1)
+	deleted := make(chan v1.Pod, 1)
+	ps.OnAdd(func(pod v1.Pod) { added <- pod })
+	ps.OnUpdate(func(pod v1.Pod) { updated <- pod })
+	ps.OnDelete(func(pod v1.Pod) { deleted <- pod })
+
+	ctx := context.Background()
+	pods := cs.CoreV1().Pods("default")
+
+	pod := testPod("default", "web", "data")
+	pod.ResourceVersion = "1"
+	if _, err := pods.Create(ctx, pod, metaV1.CreateOptions{}); err != nil {
+		t.Fatalf("Create: %s", err)
+	}
+
+	// callbacks run after the store is updated
+	if got := receivePod(t, added, "add"); got.Name != "web" || len(ps.PodsForPVC("data")) != 1 {
+		t.Errorf("expected the add callback with web indexed, got %s", got.Name)
+	}
+
+	pod = pod.DeepCopy()
+	pod.ResourceVersion = "2"
+	pod.Status.Phase = v1.PodRunning
+	if _, err := pods.UpdateStatus(ctx, pod, metaV1.UpdateOptions{}); err != nil {
+		t.Fatalf("UpdateStatus: %s", err)
+	}
+
+	if got := receivePod(t, updated, "update"); got.Status.Phase != v1.PodRunning || ps.GetPod("web").Status.Phase != v1.PodRunning {
+		t.Errorf("expected the update callback with a Running web, got %s", got.Status.Phase)
+	}
+
+	if err := pods.Delete(ctx, "web", metaV1.DeleteOptions{}); err != nil {
+		t.Fatalf("Delete: %s", err)
+	}
+
+	if got := receivePod(t, deleted, "delete"); got.Name != "web" || len(ps.PodsForPVC("data")) != 0 {
+		t.Errorf("expected the delete callback with web unindexed, got %s", got.Name)
+	}
+}
+
+func TestPodStorePodsForPVCOrder(t *testing.T) {
+	ps := testPodStore()
+	for _, key := range []string{"team-b/web", "team-a/worker", "team-a/api", "team-b/batch"} {
+		parts := strings.SplitN(key, "/", 2)
+		ps.AddPod(*testPod(parts[0], parts[1], "data"))
+	}
+
+	expected := []string{"team-a/api", "team-a/worker", "team-b/batch", "team-b/web"}
+	for i := 0; i < 10; i++ {
+		var got []string
+		for _, p := range ps.PodsForPVC("data") {
+			got = append(got, p.Namespace+"/"+p.Name)
+		}
+
+		if !reflect.DeepEqual(got, expected) {
+			t.Fatalf("expected %v, got %v", expected, got)
+		}
+	}
+}
@@ -2,11 +2,15 @@ package volm
 
 import (
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
 	"go.uber.org/zap"
 	v1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/clock"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
@@ -15,22 +19,86 @@ import (
 type PVCStoreConfig struct {
 	Namespace string
 	Log       *zap.Logger
-	Cs        *kubernetes.Clientset
+	Cs        kubernetes.Interface
+
+	// ResyncPeriod of the informer, defaults to DefaultResyncPeriod
+	ResyncPeriod time.Duration
+
+	// SharedInformerFactory, when set, supplies the informer in
+	// place of a factory of the store's own and Cs and ResyncPeriod
+	// are not used. It may watch all namespaces, objects outside
+	// Namespace are ignored. Its owner starts and stops it.
+	SharedInformerFactory informers.SharedInformerFactory
+
+	// PhaseFilter limits the store to PVCs in the given phases,
+	// all PVCs are kept when empty. PVC phase is not a supported
+	// field selector so the filter is applied client side in AddPVC.
+	PhaseFilter []v1.PersistentVolumeClaimPhase
 }
 
 type PVCStore struct {
 	*PVCStoreConfig
-	Stopper chan struct{}
-	pvcMap  map[string]v1.PersistentVolumeClaim
+	Stopper   chan struct{}
+	pvcMap    map[string]v1.PersistentVolumeClaim
+	uidMap    map[types.UID]string
+	synced    cache.InformerSynced
+	source    cache.Store
+	lastEvent time.Time
+	clock     clock.PassiveClock
+	handlers  pvcHandlers
+	changes   pvcChanges
 	sync.Mutex
 }
 
-func NewPVCStore(cfg *PVCStoreConfig) (*PVCStore, error) {
-	ps := &PVCStore{PVCStoreConfig: cfg}
+// PVCHandler is called with the PVC of a store event
+type PVCHandler func(pvc v1.PersistentVolumeClaim)
 
-	if ps.Cs == nil {
-		return nil, fmt.Errorf("must specify kubernetes.Clientset")
+// pvcHandlers holds the handlers registered on a PVCStore
+type pvcHandlers struct {
+	add    []PVCHandler
+	update []PVCHandler
+	delete []PVCHandler
+	sync.RWMutex
+}
+
+// OnAdd registers a handler called after a PVC is added to the
+// store. Handlers run on the informer goroutine and must not block.
+func (pvcs *PVCStore) OnAdd(fn PVCHandler) {
+	pvcs.handlers.Lock()
+	pvcs.handlers.add = append(pvcs.handlers.add, fn)
+	pvcs.handlers.Unlock()
+}
+
+// OnUpdate registers a handler called after a PVC is updated in
+// the store, resyncs of unchanged PVCs are skipped. Handlers run
+// on the informer goroutine and must not block.
+func (pvcs *PVCStore) OnUpdate(fn PVCHandler) {
+	pvcs.handlers.Lock()
+	pvcs.handlers.update = append(pvcs.handlers.update, fn)
+	pvcs.handlers.Unlock()
+}
+
+// OnDelete registers a handler called after a PVC is removed from
+// the store. Handlers run on the informer goroutine and must not block.
+func (pvcs *PVCStore) OnDelete(fn PVCHandler) {
+	pvcs.handlers.Lock()
+	pvcs.handlers.delete = append(pvcs.handlers.delete, fn)
+	pvcs.handlers.Unlock()
+}
+
+// notify calls each handler with the PVC
+func (h *pvcHandlers) notify(handlers *[]PVCHandler, pvc v1.PersistentVolumeClaim) {
+	h.RLock()
+	fns := *handlers
+	h.RUnlock()
+
+	for _, fn := range fns {
+		fn(pvc)
 	}
+}
+
+func NewPVCStore(cfg *PVCStoreConfig) (*PVCStore, error) {
+	ps := &PVCStore{PVCStoreConfig: cfg}
 
 	if ps.Log == nil {
 		return nil, fmt.Errorf("must specify zap.Logger")
@@ -40,53 +108,344 @@ func NewPVCStore(cfg *PVCStoreConfig) (*PVCStore, error) {
 		return nil, fmt.Errorf("must specify a Namespace")
 	}
 
-	ps.pvcMap = make(map[string]v1.PersistentVolumeClaim, 0)
-	ps.Stopper = make(chan struct{})
-	ps.PVCWatch()
+	if ps.SharedInformerFactory != nil {
+		ps.init()
+		ps.PVCWatch(ps.SharedInformerFactory.Core().V1().PersistentVolumeClaims().Informer())
+
+		return ps, nil
+	}
+
+	if ps.Cs == nil {
+		return nil, fmt.Errorf("must specify kubernetes.Interface")
+	}
+
+	if ps.ResyncPeriod < 0 {
+		return nil, fmt.Errorf("ResyncPeriod must not be negative")
+	}
+
+	if ps.ResyncPeriod == 0 {
+		ps.ResyncPeriod = DefaultResyncPeriod
+	}
+
+	factory := informers.NewSharedInformerFactoryWithOptions(ps.Cs, ps.ResyncPeriod, informers.WithNamespace(ps.Namespace))
+
+	ps.init()
+	ps.PVCWatch(factory.Core().V1().PersistentVolumeClaims().Informer())
+	factory.Start(ps.Stopper)
 
 	return ps, nil
 }
 
-func (pvcs *PVCStore) PVCWatch() {
-	factory := informers.NewSharedInformerFactoryWithOptions(pvcs.Cs, time.Second*60, informers.WithNamespace(pvcs.Namespace))
-	informer := factory.Core().V1().PersistentVolumeClaims().Informer()
+// NewPVCStoreFromInformer returns a PVCStore fed by a PVC informer
+// the caller owns, typically from a SharedInformerFactory shared
+// with a PodStore. The caller is responsible for starting it.
+func NewPVCStoreFromInformer(informer cache.SharedIndexInformer, log *zap.Logger, phaseFilter []v1.PersistentVolumeClaimPhase) (*PVCStore, error) {
+	if informer == nil {
+		return nil, fmt.Errorf("must specify cache.SharedIndexInformer")
+	}
+
+	if log == nil {
+		return nil, fmt.Errorf("must specify zap.Logger")
+	}
+
+	ps := &PVCStore{PVCStoreConfig: &PVCStoreConfig{Log: log, PhaseFilter: phaseFilter}}
+	ps.init()
+	ps.PVCWatch(informer)
+
+	return ps, nil
+}
+
+func (pvcs *PVCStore) init() {
+	pvcs.pvcMap = make(map[string]v1.PersistentVolumeClaim, 0)
+	pvcs.uidMap = make(map[types.UID]string, 0)
+	pvcs.Stopper = make(chan struct{})
+	pvcs.clock = clock.RealClock{}
+	pvcs.changes.init()
+}
+
+// PVCWatch registers the store's event handlers on the informer
+func (pvcs *PVCStore) PVCWatch(informer cache.SharedIndexInformer) {
+	pvcs.synced = informer.HasSynced
+	pvcs.source = informer.GetStore()
+	pvcs.touch()
+	storeLastEvent.track("pvc", pvcs)
+
+	// surface watch failures that would otherwise
+	// leave the store silently serving old data
+	err := informer.SetWatchErrorHandler(func(r *cache.Reflector, err error) {
+		informerWatchErrors.WithLabelValues("pvc").Inc()
+		pvcs.Log.Warn("Informer watch error", zap.String("resource", "pvc"), zap.Error(err))
+	})
+	if err != nil {
+		pvcs.Log.Error("Unable to set watch error handler", zap.String("resource", "pvc"), zap.Error(err))
+	}
 
 	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
+			informerEvents.WithLabelValues("pvc", "add").Inc()
+			pvcs.touch()
 			pvc := obj.(*v1.PersistentVolumeClaim)
-			pvcs.AddPVC(*pvc)
+			if !pvcs.inNamespace(pvc.Namespace) {
+				return
+			}
+			// PVCs outside the PhaseFilter are not added
+			if pvcs.AddPVC(*pvc) {
+				pvcs.handlers.notify(&pvcs.handlers.add, *pvc)
+			}
 		},
 		DeleteFunc: func(obj interface{}) {
-			pvc := obj.(*v1.PersistentVolumeClaim)
+			informerEvents.WithLabelValues("pvc", "delete").Inc()
+			pvcs.touch()
+			// deletes missed while the watch was down
+			// arrive wrapped in a tombstone
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			pvc, ok := obj.(*v1.PersistentVolumeClaim)
+			if !ok || !pvcs.inNamespace(pvc.Namespace) {
+				return
+			}
 			pvcs.DeletePVC(pvc.Name)
+			pvcs.handlers.notify(&pvcs.handlers.delete, *pvc)
 		},
 		UpdateFunc: func(oldObj, newObj interface{}) {
-			pvc := oldObj.(*v1.PersistentVolumeClaim)
-			pvcs.AddPVC(*pvc)
+			informerEvents.WithLabelValues("pvc", "update").Inc()
+			pvcs.touch()
+			pvc := newObj.(*v1.PersistentVolumeClaim)
+			if !pvcs.inNamespace(pvc.Namespace) {
+				return
+			}
+			admitted := pvcs.AddPVC(*pvc)
+
+			// resyncs deliver unchanged PVCs, handlers
+			// only see real updates
+			oldPVC, ok := oldObj.(*v1.PersistentVolumeClaim)
+			if ok && oldPVC.ResourceVersion == pvc.ResourceVersion {
+				return
+			}
+
+			// a PVC moving out of the PhaseFilter leaves the
+			// store, handlers see it deleted rather than updated
+			if !admitted {
+				if ok && pvcs.admitPhase(oldPVC.Status.Phase) {
+					pvcs.handlers.notify(&pvcs.handlers.delete, *pvc)
+				}
+				return
+			}
+			pvcs.handlers.notify(&pvcs.handlers.update, *pvc)
 		},
 	})
-
-	go informer.Run(pvcs.Stopper)
 }
 
-func (pvcs *PVCStore) AddPVC(pvc v1.PersistentVolumeClaim) {
+// AddPVC adds or updates the PVC in the store and returns true,
+// or removes it and returns false when it fails the PhaseFilter.
+func (pvcs *PVCStore) AddPVC(pvc v1.PersistentVolumeClaim) bool {
+	if !pvcs.admitPhase(pvc.Status.Phase) {
+		// drop PVCs that moved out of the filtered phases
+		pvcs.DeletePVC(pvc.Name)
+		return false
+	}
+
 	pvcs.Lock()
 	pvcs.Log.Info("AddPVC", zap.String("name", pvc.Name))
+	// resyncs deliver unchanged PVCs, they are not changes
+	stored, ok := pvcs.pvcMap[pvc.Name]
+	if !ok || stored.ResourceVersion != pvc.ResourceVersion {
+		pvcs.changes.record(pvc.Name, nil)
+	}
+	// a PVC recreated under the same name replaces the old UID
+	if ok && stored.UID != pvc.UID {
+		delete(pvcs.uidMap, stored.UID)
+	}
 	pvcs.pvcMap[pvc.Name] = pvc
+	pvcs.uidMap[pvc.UID] = pvc.Name
+	storePVCCount.Set(float64(len(pvcs.pvcMap)))
 	pvcs.Unlock()
+
+	return true
+}
+
+// Replace swaps the stored PVCs for the given list, applying the
+// PhaseFilter, for reconciling the store with a live list.
+func (pvcs *PVCStore) Replace(pvcList []v1.PersistentVolumeClaim) {
+	pvcMap := make(map[string]v1.PersistentVolumeClaim, len(pvcList))
+	uidMap := make(map[types.UID]string, len(pvcList))
+	for _, pvc := range pvcList {
+		if pvcs.admitPhase(pvc.Status.Phase) {
+			pvcMap[pvc.Name] = pvc
+			uidMap[pvc.UID] = pvc.Name
+		}
+	}
+
+	pvcs.Lock()
+	pvcs.Log.Info("ReplacePVCs", zap.Int("count", len(pvcMap)))
+	for name, pvc := range pvcMap {
+		if stored, ok := pvcs.pvcMap[name]; !ok || stored.ResourceVersion != pvc.ResourceVersion {
+			pvcs.changes.record(name, nil)
+		}
+	}
+	for name, stored := range pvcs.pvcMap {
+		if _, ok := pvcMap[name]; !ok {
+			meta := stored.ObjectMeta
+			pvcs.changes.record(name, &meta)
+		}
+	}
+	pvcs.pvcMap = pvcMap
+	pvcs.uidMap = uidMap
+	storePVCCount.Set(float64(len(pvcs.pvcMap)))
+	pvcs.Unlock()
+}
+
+// Resync rebuilds the store from the informer cache, the source
+// of truth, so PVCs added or removed by missed or mishandled events
+// are corrected. It returns the number of PVCs that differed and
+// only replaces the store when there are any.
+func (pvcs *PVCStore) Resync() int {
+	if pvcs.source == nil {
+		return 0
+	}
+
+	var pvcList []v1.PersistentVolumeClaim
+	for _, obj := range pvcs.source.List() {
+		if pvc, ok := obj.(*v1.PersistentVolumeClaim); ok && pvcs.inNamespace(pvc.Namespace) && pvcs.admitPhase(pvc.Status.Phase) {
+			pvcList = append(pvcList, *pvc)
+		}
+	}
+
+	pvcs.Lock()
+	drift := 0
+	current := make(map[string]bool, len(pvcList))
+	for _, pvc := range pvcList {
+		current[pvc.Name] = true
+		stored, ok := pvcs.pvcMap[pvc.Name]
+		if !ok || stored.ResourceVersion != pvc.ResourceVersion {
+			drift++
+		}
+	}
+	for name := range pvcs.pvcMap {
+		if !current[name] {
+			drift++
+		}
+	}
+	pvcs.Unlock()
+
+	if drift > 0 {
+		storeDrift.WithLabelValues("pvc").Add(float64(drift))
+		pvcs.Log.Warn("PVC store drifted from the informer cache", zap.Int("drift", drift))
+		pvcs.Replace(pvcList)
+	}
+
+	return drift
+}
+
+// inNamespace returns true for objects in the store's Namespace,
+// a shared informer may deliver every namespace. A store without
+// a Namespace, fed by NewPVCStoreFromInformer, keeps all objects.
+func (pvcs *PVCStore) inNamespace(ns string) bool {
+	return pvcs.Namespace == "" || pvcs.Namespace == ns
+}
+
+// admitPhase returns true if PVCs in the phase
+// pass the PhaseFilter.
+func (pvcs *PVCStore) admitPhase(phase v1.PersistentVolumeClaimPhase) bool {
+	if len(pvcs.PhaseFilter) == 0 {
+		return true
+	}
+
+	for _, p := range pvcs.PhaseFilter {
+		if p == phase {
+			return true
+		}
+	}
+
+	return false
 }
 
 func (pvcs *PVCStore) DeletePVC(podName string) {
 	pvcs.Lock()
-	_, ok := pvcs.pvcMap[podName]
+	stored, ok := pvcs.pvcMap[podName]
 	if ok {
 		pvcs.Log.Info("DeletePVC", zap.String("name", podName))
 		delete(pvcs.pvcMap, podName)
+		delete(pvcs.uidMap, stored.UID)
+		pvcs.changes.record(podName, &stored.ObjectMeta)
+		storePVCCount.Set(float64(len(pvcs.pvcMap)))
 	}
 	pvcs.Unlock()
 }
 
+// MarkChanged records a change to a stored PVC whose VolumeInfo
+// depends on other objects, such as the pods using it.
+func (pvcs *PVCStore) MarkChanged(pvcName string) {
+	pvcs.Lock()
+	if _, ok := pvcs.pvcMap[pvcName]; ok {
+		pvcs.changes.record(pvcName, nil)
+	}
+	pvcs.Unlock()
+}
+
+// Token returns the change token of the current store contents
+func (pvcs *PVCStore) Token() string {
+	pvcs.Lock()
+	defer pvcs.Unlock()
+
+	return pvcs.changes.token()
+}
+
+// ChangesSince returns the names of the PVCs changed and the
+// metadata of those deleted after token along with the current token. It returns
+// ErrTokenExpired when the changes since token are no longer
+// known, and a channel closed on the next change so callers can
+// wait when there are none.
+func (pvcs *PVCStore) ChangesSince(token string) (changed []string, deleted []metaV1.ObjectMeta, current string, next <-chan struct{}, err error) {
+	pvcs.Lock()
+	defer pvcs.Unlock()
+
+	changed, deleted, err = pvcs.changes.since(token)
+	return changed, deleted, pvcs.changes.token(), pvcs.changes.next, err
+}
+
+// touch records an informer event
+func (pvcs *PVCStore) touch() {
+	pvcs.Lock()
+	pvcs.lastEvent = pvcs.clock.Now()
+	pvcs.Unlock()
+}
+
+// LastEventTime returns the time of the last informer event,
+// or when the store started watching if there were none.
+func (pvcs *PVCStore) LastEventTime() time.Time {
+	pvcs.Lock()
+	defer pvcs.Unlock()
+
+	return pvcs.lastEvent
+}
+
+// Stale returns true if the store holds objects but has not
+// received an event for longer than maxAge, a maxAge of zero
+// disables the check. An empty store receives no resync events
+// so it is never stale.
+func (pvcs *PVCStore) Stale(maxAge time.Duration) bool {
+	pvcs.Lock()
+	defer pvcs.Unlock()
+
+	if maxAge <= 0 || len(pvcs.pvcMap) == 0 {
+		return false
+	}
+
+	return pvcs.clock.Since(pvcs.lastEvent) > maxAge
+}
+
+// HasSynced returns true once the informer has delivered
+// the initial list of PVCs.
+func (pvcs *PVCStore) HasSynced() bool {
+	return pvcs.synced != nil && pvcs.synced()
+}
+
 func (pvcs *PVCStore) GetPVC(pvcName string) *v1.PersistentVolumeClaim {
+	pvcs.Lock()
+	defer pvcs.Unlock()
+
 	pvc, ok := pvcs.pvcMap[pvcName]
 	if ok {
 		return &pvc
@@ -94,10 +453,37 @@ func (pvcs *PVCStore) GetPVC(pvcName string) *v1.PersistentVolumeClaim {
 	return nil
 }
 
+// GetPVCByUID returns the stored PVC with the UID, or nil
+// when the store holds no PVC of that incarnation.
+func (pvcs *PVCStore) GetPVCByUID(uid types.UID) *v1.PersistentVolumeClaim {
+	pvcs.Lock()
+	defer pvcs.Unlock()
+
+	name, ok := pvcs.uidMap[uid]
+	if !ok {
+		return nil
+	}
+
+	pvc := pvcs.pvcMap[name]
+	return &pvc
+}
+
+// GetPVCs returns the stored PVCs sorted by namespace then
+// name, so responses built from them are stable between calls.
 func (pvcs *PVCStore) GetPVCs() []v1.PersistentVolumeClaim {
+	pvcs.Lock()
 	var pvcList []v1.PersistentVolumeClaim
 	for _, p := range pvcs.pvcMap {
 		pvcList = append(pvcList, p)
 	}
+	pvcs.Unlock()
+
+	sort.Slice(pvcList, func(i, j int) bool {
+		if pvcList[i].Namespace != pvcList[j].Namespace {
+			return pvcList[i].Namespace < pvcList[j].Namespace
+		}
+		return pvcList[i].Name < pvcList[j].Name
+	})
+
 	return pvcList
 }
@@ -0,0 +1,212 @@
+package volm
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func testPVCStore() *PVCStore {
+	pvcs := &PVCStore{PVCStoreConfig: &PVCStoreConfig{Log: zap.NewNop()}}
+	pvcs.init()
+
+	return pvcs
+}
+
+func TestPVCStoreStale(t *testing.T) {
+	pvcs := testPVCStore()
+	fakeClock := clock.NewFakeClock(time.Now())
+	pvcs.clock = fakeClock
+	pvcs.touch()
+	pvcs.AddPVC(*testPVC("default", "data"))
+
+	fakeClock.Step(StaleAfterResyncs * DefaultResyncPeriod)
+	if pvcs.Stale(StaleAfterResyncs * DefaultResyncPeriod) {
+		t.Error("expected the store to be fresh at maxAge")
+	}
+
+	fakeClock.Step(time.Second)
+	if !pvcs.Stale(StaleAfterResyncs * DefaultResyncPeriod) {
+		t.Error("expected the store to be stale past maxAge without events")
+	}
+
+	pvcs.touch()
+	if pvcs.Stale(StaleAfterResyncs * DefaultResyncPeriod) {
+		t.Error("expected an event to make the store fresh")
+	}
+}
+
+// receivePVC returns the next PVC sent on ch, failing
+// the test if none arrives in time.
+func receivePVC(t *testing.T, ch <-chan v1.PersistentVolumeClaim, event string) v1.PersistentVolumeClaim {
+	t.Helper()
+
+	select {
+	case pvc := <-ch:
+		return pvc
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no %s callback", event)
+	}
+
+	return v1.PersistentVolumeClaim{}
+}
+
+func TestPVCStoreCallbacks(t *testing.T) {
+	cs := fake.NewSimpleClientset()
+	pvcs, err := NewPVCStore(&PVCStoreConfig{Namespace: "default", Log: zap.NewNop(), Cs: cs})
+	if err != nil {
+		t.Fatalf("NewPVCStore: %s", err)
+	}
+	defer close(pvcs.Stopper)
+
+	added := make(chan v1.PersistentVolumeClaim, 1)
+	updated := make(chan v1.PersistentVolumeClaim, 1)
+	deleted := make(chan v1.PersistentVolumeClaim, 1)
+	pvcs.OnAdd(func(pvc v1.PersistentVolumeClaim) { added <- pvc })
+	pvcs.OnUpdate(func(pvc v1.PersistentVolumeClaim) { updated <- pvc })
+	pvcs.OnDelete(func(pvc v1.PersistentVolumeClaim) { deleted <- pvc })
+
+	ctx := context.Background()
+	claims := cs.CoreV1().PersistentVolumeClaims("default")
+
+	pvc := testPVC("default", "data")
+	pvc.ResourceVersion = "1"
+	if _, err := claims.Create(ctx, pvc, metaV1.CreateOptions{}); err != nil {
+		t.Fatalf("Create: %s", err)
+	}
+
+	// callbacks run after the store is updated
+	if got := receivePVC(t, added, "add"); got.UID != pvc.UID || pvcs.GetPVC("data") == nil {
+		t.Errorf("expected the add callback with a stored data, got %s", got.UID)
+	}
+
+	pvc = pvc.DeepCopy()
+	pvc.ResourceVersion = "2"
+	pvc.Labels = map[string]string{"app": "web"}
+	if _, err := claims.Update(ctx, pvc, metaV1.UpdateOptions{}); err != nil {
+		t.Fatalf("Update: %s", err)
+	}
+
+	if got := receivePVC(t, updated, "update"); got.Labels["app"] != "web" || pvcs.GetPVC("data").Labels["app"] != "web" {
+		t.Errorf("expected the update callback with the updated data, got labels %v", got.Labels)
+	}
+
+	if err := claims.Delete(ctx, "data", metaV1.DeleteOptions{}); err != nil {
+		t.Fatalf("Delete: %s", err)
+	}
+
+	if got := receivePVC(t, deleted, "delete"); got.UID != pvc.UID || pvcs.GetPVC("data") != nil {
+		t.Errorf("expected the delete callback with data removed from the store, got %s", got.UID)
+	}
+}
+
+func TestPVCStorePhaseFilter(t *testing.T) {
+	cs := fake.NewSimpleClientset()
+	pvcs, err := NewPVCStore(&PVCStoreConfig{
+		Namespace:   "default",
+		Log:         zap.NewNop(),
+		Cs:          cs,
+		PhaseFilter: []v1.PersistentVolumeClaimPhase{v1.ClaimBound},
+	})
+	if err != nil {
+		t.Fatalf("NewPVCStore: %s", err)
+	}
+	defer close(pvcs.Stopper)
+
+	added := make(chan v1.PersistentVolumeClaim, 2)
+	updated := make(chan v1.PersistentVolumeClaim, 2)
+	deleted := make(chan v1.PersistentVolumeClaim, 2)
+	pvcs.OnAdd(func(pvc v1.PersistentVolumeClaim) { added <- pvc })
+	pvcs.OnUpdate(func(pvc v1.PersistentVolumeClaim) { updated <- pvc })
+	pvcs.OnDelete(func(pvc v1.PersistentVolumeClaim) { deleted <- pvc })
+
+	ctx := context.Background()
+	claims := cs.CoreV1().PersistentVolumeClaims("default")
+
+	pending := testPVC("default", "pending")
+	pending.ResourceVersion = "1"
+	pending.Status.Phase = v1.ClaimPending
+	bound := testPVC("default", "bound")
+	bound.ResourceVersion = "1"
+	bound.Status.Phase = v1.ClaimBound
+
+	for _, pvc := range []*v1.PersistentVolumeClaim{pending, bound} {
+		if _, err := claims.Create(ctx, pvc, metaV1.CreateOptions{}); err != nil {
+			t.Fatalf("Create: %s", err)
+		}
+	}
+
+	// events are delivered in order, so had pending been
+	// added its callback would come first
+	if got := receivePVC(t, added, "add"); got.Name != "bound" {
+		t.Errorf("expected only bound added, got %s", got.Name)
+	}
+
+	if pvcs.GetPVC("pending") != nil {
+		t.Error("expected the Pending PVC excluded by the Bound filter")
+	}
+	if pvcs.GetPVC("bound") == nil {
+		t.Error("expected the Bound PVC in the store")
+	}
+
+	bound = bound.DeepCopy()
+	bound.ResourceVersion = "2"
+	bound.Status.Phase = v1.ClaimLost
+	if _, err := claims.UpdateStatus(ctx, bound, metaV1.UpdateOptions{}); err != nil {
+		t.Fatalf("UpdateStatus: %s", err)
+	}
+
+	if got := receivePVC(t, deleted, "delete"); got.Name != "bound" {
+		t.Errorf("expected bound deleted on leaving the filter, got %s", got.Name)
+	}
+
+	if pvcs.GetPVC("bound") != nil {
+		t.Error("expected the Lost PVC removed from the store")
+	}
+
+	select {
+	case pvc := <-updated:
+		t.Errorf("expected no update callback for a PVC leaving the store, got %s", pvc.Name)
+	default:
+	}
+}
+
+func TestPVCStoreGetPVCsOrder(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		add      []string
+		expected []string
+	}{
+		{name: "by name", add: []string{"default/logs", "default/cache", "default/data"}, expected: []string{"default/cache", "default/data", "default/logs"}},
+		{name: "namespace before name", add: []string{"team-b/a", "team-a/z", "team-b/c", "team-a/b"}, expected: []string{"team-a/b", "team-a/z", "team-b/a", "team-b/c"}},
+		{name: "lexical, not numeric", add: []string{"default/data-2", "default/data-10", "default/data-1"}, expected: []string{"default/data-1", "default/data-10", "default/data-2"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			pvcs := testPVCStore()
+			for _, key := range tc.add {
+				parts := strings.SplitN(key, "/", 2)
+				pvcs.AddPVC(*testPVC(parts[0], parts[1]))
+			}
+
+			// repeated calls iterate the map afresh
+			for i := 0; i < 10; i++ {
+				var got []string
+				for _, pvc := range pvcs.GetPVCs() {
+					got = append(got, pvc.Namespace+"/"+pvc.Name)
+				}
+
+				if !reflect.DeepEqual(got, tc.expected) {
+					t.Fatalf("expected %v, got %v", tc.expected, got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package volm
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// NoStorageClass groups PVCs without a storage class
+const NoStorageClass = "(none)"
+
+// VolumeSummary aggregates the PVCs meeting the selector
+// criteria. Orphaned counts PVCs no pod references, not even
+// a finished one, and ComputedAt lets clients show how fresh
+// the numbers are.
+type VolumeSummary struct {
+	Total               int                          `json:"total"`
+	ByPhase             map[string]int               `json:"byPhase"`
+	Terminating         int                          `json:"terminating"`
+	TotalRequestedBytes int64                        `json:"totalRequestedBytes"`
+	TotalCapacityBytes  int64                        `json:"totalCapacityBytes"`
+	InUse               int                          `json:"inUse"`
+	Orphaned            int                          `json:"orphaned"`
+	ByStorageClass      map[string]StorageClassUsage `json:"byStorageClass"`
+	ComputedAt          time.Time                    `json:"computedAt"`
+}
+
+// StorageClassUsage aggregates the PVCs of a storage class.
+// CapacityBytes sums the provisioned capacity of bound PVCs.
+type StorageClassUsage struct {
+	Claims         int            `json:"claims"`
+	InUse          int            `json:"inUse"`
+	Terminating    int            `json:"terminating"`
+	RequestedBytes int64          `json:"requestedBytes"`
+	CapacityBytes  int64          `json:"capacityBytes"`
+	ByPhase        map[string]int `json:"byPhase"`
+}
+
+// usageAccumulator sums PVC quantities with resource.Quantity
+// math until the totals are read with usage.
+type usageAccumulator struct {
+	claims      int
+	inUse       int
+	orphaned    int
+	terminating int
+	byPhase     map[string]int
+	requested   resource.Quantity
+	capacity    resource.Quantity
+}
+
+func newUsageAccumulator() *usageAccumulator {
+	return &usageAccumulator{
+		byPhase: map[string]int{
+			string(v1.ClaimBound):   0,
+			string(v1.ClaimPending): 0,
+			string(v1.ClaimLost):    0,
+		},
+	}
+}
+
+// add counts the PVC, inUse when active pods reference it and
+// orphaned when no pod references it at all.
+func (ua *usageAccumulator) add(pvc v1.PersistentVolumeClaim, inUse, orphaned bool) {
+	ua.claims++
+
+	// new PVCs have no phase until the controller sets Pending
+	phase := pvc.Status.Phase
+	if phase == "" {
+		phase = v1.ClaimPending
+	}
+	ua.byPhase[string(phase)]++
+
+	if inUse {
+		ua.inUse++
+	}
+
+	if orphaned {
+		ua.orphaned++
+	}
+
+	if pvc.DeletionTimestamp != nil {
+		ua.terminating++
+	}
+
+	if q, ok := pvc.Spec.Resources.Requests[v1.ResourceStorage]; ok {
+		ua.requested.Add(q)
+	}
+
+	if q, ok := pvc.Status.Capacity[v1.ResourceStorage]; ok && phase == v1.ClaimBound {
+		ua.capacity.Add(q)
+	}
+}
+
+func (ua *usageAccumulator) usage() StorageClassUsage {
+	return StorageClassUsage{
+		Claims:         ua.claims,
+		InUse:          ua.inUse,
+		Terminating:    ua.terminating,
+		RequestedBytes: ua.requested.Value(),
+		CapacityBytes:  ua.capacity.Value(),
+		ByPhase:        ua.byPhase,
+	}
+}
+
+// storageClassName returns the PVC storage class or
+// NoStorageClass when unset.
+func storageClassName(pvc v1.PersistentVolumeClaim) string {
+	if pvc.Spec.StorageClassName == nil || *pvc.Spec.StorageClassName == "" {
+		return NoStorageClass
+	}
+
+	return *pvc.Spec.StorageClassName
+}
+
+// storageClassUsage aggregates the PVCs meeting the selector
+// criteria in total and by storage class.
+func (a *API) storageClassUsage() (*usageAccumulator, map[string]*usageAccumulator) {
+	total := newUsageAccumulator()
+	byClass := make(map[string]*usageAccumulator)
+
+	for _, pvc := range a.PVCStore.GetPVCs() {
+		if !a.matchesSelector(pvc.ObjectMeta) {
+			continue
+		}
+
+		// PVCs only referenced by finished pods are
+		// neither in use nor orphaned
+		inUse := a.pvcInUse(pvc.Name)
+		orphaned := len(a.PodStore.PodsForPVC(pvc.Name)) == 0
+		total.add(pvc, inUse, orphaned)
+
+		class := storageClassName(pvc)
+		if _, ok := byClass[class]; !ok {
+			byClass[class] = newUsageAccumulator()
+		}
+		byClass[class].add(pvc, inUse, orphaned)
+	}
+
+	return total, byClass
+}
+
+func (a *API) SummaryHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !a.requireSynced(c) {
+			return
+		}
+
+		c.JSON(http.StatusOK, a.Summary())
+	}
+}
+
+// Summary computes a VolumeSummary directly from the PVC
+// and pod stores without building VolumeInfo for each PVC.
+func (a *API) Summary() VolumeSummary {
+	total, byClass := a.storageClassUsage()
+	usage := total.usage()
+
+	summary := VolumeSummary{
+		Total:               usage.Claims,
+		ByPhase:             usage.ByPhase,
+		Terminating:         usage.Terminating,
+		TotalRequestedBytes: usage.RequestedBytes,
+		TotalCapacityBytes:  usage.CapacityBytes,
+		InUse:               usage.InUse,
+		Orphaned:            total.orphaned,
+		ByStorageClass:      make(map[string]StorageClassUsage, len(byClass)),
+		ComputedAt:          time.Now().UTC(),
+	}
+
+	for class, ua := range byClass {
+		summary.ByStorageClass[class] = ua.usage()
+	}
+
+	return summary
+}
@@ -0,0 +1,145 @@
+package volm
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestSummaryOrphaned(t *testing.T) {
+	running := testPod("default", "web", "used")
+	running.Status.Phase = v1.PodRunning
+
+	finished := testPod("default", "job", "finished")
+	finished.Status.Phase = v1.PodSucceeded
+
+	cs := fake.NewSimpleClientset(
+		testPVC("default", "used"),
+		testPVC("default", "finished"),
+		testPVC("default", "orphan"),
+		running,
+		finished,
+	)
+	a, _ := testAPI(t, &Config{Cs: cs})
+
+	summary := a.Summary()
+	if summary.Total != 3 || summary.InUse != 1 {
+		t.Errorf("expected 3 PVCs with 1 in use, got %d with %d", summary.Total, summary.InUse)
+	}
+
+	// a PVC only referenced by a finished pod is not orphaned
+	if summary.Orphaned != 1 {
+		t.Errorf("expected 1 orphaned PVC, got %d", summary.Orphaned)
+	}
+}
+
+func TestSummaryRoute(t *testing.T) {
+	bound := testPVC("default", "summary")
+	bound.Status.Phase = v1.ClaimBound
+	bound.Spec.Resources.Requests = v1.ResourceList{v1.ResourceStorage: resource.MustParse("1Gi")}
+
+	pending := testPVC("default", "data")
+	pending.Status.Phase = v1.ClaimPending
+	pending.Spec.Resources.Requests = v1.ResourceList{v1.ResourceStorage: resource.MustParse("512Mi")}
+
+	cs := fake.NewSimpleClientset(bound, pending)
+	_, r := testAPI(t, &Config{Cs: cs})
+
+	w := serve(r, http.MethodGet, "/v1/vol/-/summary", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	summary := VolumeSummary{}
+	if err := json.Unmarshal(w.Body.Bytes(), &summary); err != nil {
+		t.Fatalf("malformed VolumeSummary: %s", err)
+	}
+
+	if !reflect.DeepEqual(summary.ByPhase, map[string]int{"Bound": 1, "Pending": 1, "Lost": 0}) {
+		t.Errorf("expected 1 Bound and 1 Pending PVC, got %v", summary.ByPhase)
+	}
+
+	if summary.TotalRequestedBytes != 1536<<20 {
+		t.Errorf("expected %d requested bytes, got %d", 1536<<20, summary.TotalRequestedBytes)
+	}
+
+	// a PVC named like a report is served as a PVC
+	w = serve(r, http.MethodGet, "/v1/vol/summary", nil)
+	vol := VolumeInfo{}
+	if err := json.Unmarshal(w.Body.Bytes(), &vol); w.Code != http.StatusOK || err != nil || vol.Name != "summary" {
+		t.Errorf("expected 200 with the summary PVC, got %d: %s", w.Code, w.Body.String())
+	}
+
+	if w = serve(r, http.MethodGet, "/v1/vol/unused", nil); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a missing PVC named unused, got %d", w.Code)
+	}
+}
+
+func TestStatsByStorageClass(t *testing.T) {
+	fast := "fast"
+
+	bound := testPVC("default", "db")
+	bound.Spec.StorageClassName = &fast
+	bound.Spec.Resources.Requests = v1.ResourceList{v1.ResourceStorage: resource.MustParse("10Gi")}
+	bound.Status.Phase = v1.ClaimBound
+	bound.Status.Capacity = v1.ResourceList{v1.ResourceStorage: resource.MustParse("16Gi")}
+
+	terminating := testPVC("default", "old")
+	terminating.Spec.StorageClassName = &fast
+	terminating.Spec.Resources.Requests = v1.ResourceList{v1.ResourceStorage: resource.MustParse("1Gi")}
+	terminating.DeletionTimestamp = &metaV1.Time{Time: time.Now()}
+
+	unclassified := testPVC("default", "scratch")
+	unclassified.Spec.Resources.Requests = v1.ResourceList{v1.ResourceStorage: resource.MustParse("100Mi")}
+
+	running := testPod("default", "db-0", "db")
+	running.Status.Phase = v1.PodRunning
+
+	cs := fake.NewSimpleClientset(bound, terminating, unclassified, running)
+	_, r := testAPI(t, &Config{Cs: cs})
+
+	before := time.Now().UTC()
+	w := serve(r, http.MethodGet, "/v1/vol/-/stats", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	stats := VolumeSummary{}
+	if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("malformed VolumeSummary: %s", err)
+	}
+
+	if stats.ComputedAt.Before(before.Truncate(time.Second)) || stats.ComputedAt.After(time.Now().UTC()) {
+		t.Errorf("expected computedAt at the request, got %s", stats.ComputedAt)
+	}
+
+	expected := map[string]StorageClassUsage{
+		"fast": {
+			Claims:         2,
+			InUse:          1,
+			Terminating:    1,
+			RequestedBytes: 11 << 30,
+			CapacityBytes:  16 << 30,
+			ByPhase:        map[string]int{"Bound": 1, "Pending": 1, "Lost": 0},
+		},
+		NoStorageClass: {
+			Claims:         1,
+			RequestedBytes: 100 << 20,
+			ByPhase:        map[string]int{"Bound": 0, "Pending": 1, "Lost": 0},
+		},
+	}
+	if !reflect.DeepEqual(stats.ByStorageClass, expected) {
+		t.Errorf("expected storage class usage %v, got %v", expected, stats.ByStorageClass)
+	}
+
+	if stats.Terminating != 1 || stats.TotalRequestedBytes != 11<<30+100<<20 {
+		t.Errorf("expected 1 terminating PVC and %d requested bytes, got %d and %d", 11<<30+100<<20, stats.Terminating, stats.TotalRequestedBytes)
+	}
+}
@@ -0,0 +1,252 @@
+package volm
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// PVCTemplate is a preset for creating PVCs fixing the storage
+// class, access modes and metadata, with optional size bounds.
+type PVCTemplate struct {
+	// Name is the key of the template in Config.Templates,
+	// set when listing
+	Name         string            `json:"name"`
+	Description  string            `json:"description,omitempty"`
+	StorageClass string            `json:"storageClass"`
+	AccessModes  []string          `json:"accessModes"`
+	VolumeMode   string            `json:"volumeMode,omitempty"`
+	Labels       map[string]string `json:"labels,omitempty"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+	MinSize      string            `json:"minSize,omitempty"`
+	MaxSize      string            `json:"maxSize,omitempty"`
+
+	// DefaultSize is used when a request gives no size
+	DefaultSize string `json:"defaultSize,omitempty"`
+}
+
+// TemplateRequest creates a PVC from a PVCTemplate
+type TemplateRequest struct {
+	Name string `json:"name" binding:"required"`
+	Size string `json:"size"`
+}
+
+// LoadPVCTemplates reads a YAML or JSON file of PVCTemplates
+// keyed by template name.
+func LoadPVCTemplates(path string) (map[string]PVCTemplate, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	templates := map[string]PVCTemplate{}
+	if err := yaml.Unmarshal(data, &templates); err != nil {
+		return nil, fmt.Errorf("malformed file: %w", err)
+	}
+
+	return templates, nil
+}
+
+// validate checks the access modes, volume mode and sizes
+// of the template parse and the size bounds are ordered.
+func (t PVCTemplate) validate() error {
+	if len(t.AccessModes) == 0 {
+		return fmt.Errorf("accessModes must not be empty")
+	}
+
+	for _, m := range t.AccessModes {
+		switch v1.PersistentVolumeAccessMode(m) {
+		case v1.ReadWriteOnce, v1.ReadOnlyMany, v1.ReadWriteMany, v1.ReadWriteOncePod:
+		default:
+			return fmt.Errorf("unknown access mode %s", m)
+		}
+	}
+
+	switch v1.PersistentVolumeMode(t.VolumeMode) {
+	case "", v1.PersistentVolumeFilesystem, v1.PersistentVolumeBlock:
+	default:
+		return fmt.Errorf("unknown volume mode %s", t.VolumeMode)
+	}
+
+	for _, s := range []string{t.MinSize, t.MaxSize, t.DefaultSize} {
+		if s == "" {
+			continue
+		}
+		if _, err := resource.ParseQuantity(s); err != nil {
+			return fmt.Errorf("invalid size %s: %w", s, err)
+		}
+	}
+
+	if t.MinSize != "" && t.MaxSize != "" {
+		min := resource.MustParse(t.MinSize)
+		if min.Cmp(resource.MustParse(t.MaxSize)) > 0 {
+			return fmt.Errorf("minSize %s is larger than maxSize %s", t.MinSize, t.MaxSize)
+		}
+	}
+
+	if t.DefaultSize != "" {
+		if err := t.checkSize(resource.MustParse(t.DefaultSize)); err != nil {
+			return fmt.Errorf("defaultSize %s", err.Error())
+		}
+	}
+
+	return nil
+}
+
+// checkSize returns an error naming the violated
+// bound when size is outside the template bounds.
+func (t PVCTemplate) checkSize(size resource.Quantity) error {
+	if t.MinSize != "" && size.Cmp(resource.MustParse(t.MinSize)) < 0 {
+		return fmt.Errorf("%s is below the minSize %s", size.String(), t.MinSize)
+	}
+
+	if t.MaxSize != "" && size.Cmp(resource.MustParse(t.MaxSize)) > 0 {
+		return fmt.Errorf("%s is above the maxSize %s", size.String(), t.MaxSize)
+	}
+
+	return nil
+}
+
+// ListTemplatesHandler lists the PVC templates by name
+func (a *API) ListTemplatesHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, a.ListTemplates())
+	}
+}
+
+// ListTemplates returns the configured PVC templates sorted by name
+func (a *API) ListTemplates() []PVCTemplate {
+	templates := make([]PVCTemplate, 0, len(a.Templates))
+	for name, t := range a.Templates {
+		t.Name = name
+		templates = append(templates, t)
+	}
+
+	sort.Slice(templates, func(i, j int) bool {
+		return templates[i].Name < templates[j].Name
+	})
+
+	return templates
+}
+
+func (a *API) CreateFromTemplateHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		req := TemplateRequest{}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			WriteError(c, errBadRequest(err.Error()))
+			return
+		}
+
+		volInfo, err := a.CreateFromTemplate(requestContext(c), c.Param("template"), req)
+		if err != nil {
+			WriteError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, volInfo)
+	}
+}
+
+// CreateFromTemplate creates a PVC from the named template, sized
+// by the request or the template default within the template bounds.
+// The PVC carries the template metadata and the selector labels and
+// annotations so it is visible through the API.
+func (a *API) CreateFromTemplate(ctx context.Context, template string, req TemplateRequest) (volInfo VolumeInfo, err error) {
+	ctx, cancel := a.kubeContext(ctx)
+	defer cancel()
+
+	start := time.Now()
+	defer func() {
+		a.audit(ctx, "create", req.Name, CallerFromContext(ctx), start, err, zap.String("template", template))
+	}()
+
+	if a.ReadOnly {
+		return VolumeInfo{}, errReadOnly()
+	}
+
+	t, ok := a.Templates[template]
+	if !ok {
+		return VolumeInfo{}, NewAPIError(http.StatusNotFound, CodeNotFound, fmt.Sprintf("template %s not found", template))
+	}
+
+	sizeStr := req.Size
+	if sizeStr == "" {
+		sizeStr = t.DefaultSize
+	}
+	if sizeStr == "" {
+		return VolumeInfo{}, errBadRequest("size is required, template %s has no defaultSize", template)
+	}
+
+	size, err := resource.ParseQuantity(sizeStr)
+	if err != nil {
+		return VolumeInfo{}, errBadRequest("invalid size %s: %s", sizeStr, err.Error())
+	}
+
+	if err := t.checkSize(size); err != nil {
+		return VolumeInfo{}, errBadRequest("size %s for template %s", err.Error(), template)
+	}
+
+	labels := map[string]string{}
+	for k, v := range t.Labels {
+		labels[k] = v
+	}
+	for k, v := range a.PVCSelectorMap {
+		labels[k] = v
+	}
+
+	annotations := map[string]string{}
+	for k, v := range t.Annotations {
+		annotations[k] = v
+	}
+	for k, v := range a.AnnotationMap {
+		annotations[k] = v
+	}
+
+	accessModes := make([]v1.PersistentVolumeAccessMode, 0, len(t.AccessModes))
+	for _, m := range t.AccessModes {
+		accessModes = append(accessModes, v1.PersistentVolumeAccessMode(m))
+	}
+
+	pvc := &v1.PersistentVolumeClaim{
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:        req.Name,
+			Namespace:   a.PVCNamespace,
+			Labels:      labels,
+			Annotations: annotations,
+		},
+		Spec: v1.PersistentVolumeClaimSpec{
+			AccessModes: accessModes,
+			Resources: v1.ResourceRequirements{
+				Requests: v1.ResourceList{v1.ResourceStorage: size},
+			},
+		},
+	}
+
+	if t.StorageClass != "" {
+		storageClass := t.StorageClass
+		pvc.Spec.StorageClassName = &storageClass
+	}
+
+	if t.VolumeMode != "" {
+		volumeMode := v1.PersistentVolumeMode(t.VolumeMode)
+		pvc.Spec.VolumeMode = &volumeMode
+	}
+
+	created, err := a.Cs.CoreV1().PersistentVolumeClaims(a.PVCNamespace).Create(ctx, pvc, metaV1.CreateOptions{})
+	if err != nil {
+		a.logger(ctx).Error("CreateFromTemplate got error invoking pvcClient.Create", zap.Error(err))
+		return VolumeInfo{}, err
+	}
+
+	return a.volumeInfo(*created)
+}
@@ -0,0 +1,180 @@
+package volm
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// NewTLSConfig builds a tls.Config with the minimum TLS version
+// and, when a CA file is given, required client certificate
+// verification. Set its GetCertificate to a CertReloader's.
+func NewTLSConfig(minVersion string, clientCAFile string) (*tls.Config, error) {
+	versions := map[string]uint16{
+		"1.0": tls.VersionTLS10,
+		"1.1": tls.VersionTLS11,
+		"1.2": tls.VersionTLS12,
+		"1.3": tls.VersionTLS13,
+	}
+
+	version, ok := versions[minVersion]
+	if !ok {
+		return nil, fmt.Errorf("unsupported TLS version %s", minVersion)
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion: version,
+		// only forward secret AEAD suites for TLS 1.2 and
+		// below, TLS 1.3 suites are not configurable
+		CipherSuites: []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+		},
+	}
+
+	if clientCAFile != "" {
+		caPEM, err := ioutil.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificates found in %s", clientCAFile)
+		}
+
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return tlsConfig, nil
+}
+
+// CertReloader serves a certificate and key pair, reloading them
+// when either file's modification time changes so certificates
+// rotated by cert-manager are picked up without a restart.
+type CertReloader struct {
+	certFile string
+	keyFile  string
+	log      *zap.Logger
+
+	cert    *tls.Certificate
+	modTime time.Time
+	sync.Mutex
+}
+
+// NewCertReloader constructs a CertReloader, returning an
+// error if the certificate and key cannot be loaded.
+func NewCertReloader(certFile string, keyFile string, log *zap.Logger) (*CertReloader, error) {
+	cr := &CertReloader{certFile: certFile, keyFile: keyFile, log: log}
+
+	modTime, err := cr.latestModTime()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cr.load(modTime); err != nil {
+		return nil, err
+	}
+
+	return cr, nil
+}
+
+// GetCertificate is a tls.Config GetCertificate returning the
+// current certificate, reloaded first if the files changed.
+func (cr *CertReloader) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	modTime, err := cr.latestModTime()
+
+	cr.Lock()
+	changed := err == nil && !modTime.Equal(cr.modTime)
+	cr.Unlock()
+
+	if changed {
+		if err := cr.load(modTime); err != nil {
+			cr.log.Error("Error reloading TLS certificate, serving the previous one", zap.Error(err))
+		}
+	}
+
+	cr.Lock()
+	defer cr.Unlock()
+	return cr.cert, nil
+}
+
+// Reload re-reads the certificate and key regardless of
+// their modification time, keeping the current pair on error.
+func (cr *CertReloader) Reload() {
+	modTime, err := cr.latestModTime()
+	if err == nil {
+		err = cr.load(modTime)
+	}
+
+	if err != nil {
+		cr.log.Error("Error reloading TLS certificate, serving the previous one", zap.Error(err))
+	}
+}
+
+// ReloadOnSignal calls Reload each time one of sig, typically
+// SIGHUP, is received until stop is closed.
+func (cr *CertReloader) ReloadOnSignal(stop <-chan struct{}, sig ...os.Signal) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, sig...)
+
+	go func() {
+		defer signal.Stop(signals)
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-signals:
+				cr.Reload()
+			}
+		}
+	}()
+}
+
+func (cr *CertReloader) load(modTime time.Time) error {
+	cert, err := tls.LoadX509KeyPair(cr.certFile, cr.keyFile)
+	if err != nil {
+		return err
+	}
+
+	cr.Lock()
+	cr.cert = &cert
+	cr.modTime = modTime
+	cr.Unlock()
+
+	cr.log.Info("Loaded TLS certificate", zap.String("cert_file", cr.certFile), zap.Time("mod_time", modTime))
+
+	return nil
+}
+
+// latestModTime returns the later modification time of the
+// certificate and key files.
+func (cr *CertReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+
+	for _, file := range []string{cr.certFile, cr.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return latest, err
+		}
+
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+
+	return latest, nil
+}
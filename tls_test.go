@@ -0,0 +1,179 @@
+package volm
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// writeCert writes a self-signed certificate for volm.test with
+// the common name to certFile and its key to keyFile, returning
+// the certificate.
+func writeCert(t *testing.T, commonName, certFile, keyFile string) *x509.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %s", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{"volm.test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate: %s", err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalECPrivateKey: %s", err)
+	}
+
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("ParseCertificate: %s", err)
+	}
+
+	return cert
+}
+
+func TestCertReloaderTLS(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+
+	first := writeCert(t, "first", certFile, keyFile)
+	info, err := os.Stat(certFile)
+	if err != nil {
+		t.Fatalf("Stat: %s", err)
+	}
+
+	certs, err := NewCertReloader(certFile, keyFile, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewCertReloader: %s", err)
+	}
+
+	tlsConfig, err := NewTLSConfig("1.2", "")
+	if err != nil {
+		t.Fatalf("NewTLSConfig: %s", err)
+	}
+	tlsConfig.GetCertificate = certs.GetCertificate
+
+	stop := make(chan struct{})
+	defer close(stop)
+	certs.ReloadOnSignal(stop, syscall.SIGHUP)
+
+	_, r := testAPI(t, &Config{Cs: fake.NewSimpleClientset(testPVC("default", "data"))})
+
+	srv := httptest.NewUnstartedServer(r)
+	srv.TLS = tlsConfig
+	srv.StartTLS()
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(first)
+
+	// a new connection each request, so each sees the current
+	// certificate, with SNI so GetCertificate is used over the
+	// httptest certificate
+	client := &http.Client{Transport: &http.Transport{
+		DisableKeepAlives: true,
+		TLSClientConfig:   &tls.Config{RootCAs: roots, ServerName: "volm.test"},
+	}}
+
+	servedCert := func() string {
+		t.Helper()
+
+		resp, err := client.Get(srv.URL + "/v1/vol/data")
+		if err != nil {
+			t.Fatalf("GET over TLS: %s", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected 200 over TLS, got %d", resp.StatusCode)
+		}
+
+		return resp.TLS.PeerCertificates[0].Subject.CommonName
+	}
+
+	if cn := servedCert(); cn != "first" {
+		t.Fatalf("expected the first certificate, got %q", cn)
+	}
+
+	// rotate the pair keeping the modification time,
+	// so only the signal reloads it
+	roots.AddCert(writeCert(t, "second", certFile, keyFile))
+	for _, file := range []string{certFile, keyFile} {
+		if err := os.Chtimes(file, info.ModTime(), info.ModTime()); err != nil {
+			t.Fatalf("Chtimes: %s", err)
+		}
+	}
+
+	if cn := servedCert(); cn != "first" {
+		t.Fatalf("expected the first certificate before SIGHUP, got %q", cn)
+	}
+
+	process, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatalf("FindProcess: %s", err)
+	}
+	if err := process.Signal(syscall.SIGHUP); err != nil {
+		t.Fatalf("Signal: %s", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for servedCert() != "second" {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the second certificate after SIGHUP")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestNewTLSConfigVersion(t *testing.T) {
+	if _, err := NewTLSConfig("1.4", ""); err == nil {
+		t.Error("expected an error for TLS version 1.4")
+	}
+
+	tlsConfig, err := NewTLSConfig("1.3", "")
+	if err != nil {
+		t.Fatalf("NewTLSConfig: %s", err)
+	}
+	if tlsConfig.MinVersion != tls.VersionTLS13 {
+		t.Errorf("expected minimum version TLS 1.3, got %x", tlsConfig.MinVersion)
+	}
+}
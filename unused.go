@@ -0,0 +1,178 @@
+package volm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+// LastUsedAnnotation records the last time volm saw a pod
+// referencing a PVC, so unused time survives volm restarts.
+const LastUsedAnnotation = "volm.txn2.com/last-used"
+
+// UnusedReport lists PVCs not referenced by any pod along with
+// the total capacity reclaimable by deleting them.
+type UnusedReport struct {
+	Volumes          []VolumeInfo `json:"volumes"`
+	Count            int          `json:"count"`
+	ReclaimableBytes int64        `json:"reclaimableBytes"`
+	Reclaimable      string       `json:"reclaimable"`
+}
+
+func (a *API) UnusedPVCHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !a.requireSynced(c) {
+			return
+		}
+
+		var olderThan time.Duration
+
+		if v := c.Query("olderThan"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				WriteError(c, errBadRequest("olderThan must be a duration: %s", err.Error()))
+				return
+			}
+			olderThan = d
+		}
+
+		report, err := a.GetUnusedReport(olderThan)
+		if err != nil {
+			WriteError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+// GetUnusedReport returns PVCs meeting the selector criteria
+// that have been unused for longer than olderThan, oldest first.
+func (a *API) GetUnusedReport(olderThan time.Duration) (UnusedReport, error) {
+	report := UnusedReport{Volumes: make([]VolumeInfo, 0)}
+
+	vols, err := a.GetPVCList()
+	if err != nil {
+		return report, err
+	}
+
+	cutoff := time.Now().Add(-olderThan)
+	reclaimable := resource.Quantity{}
+
+	for _, vol := range vols {
+		if vol.InUse || vol.UnusedSince == nil {
+			continue
+		}
+
+		if vol.UnusedSince.Time.After(cutoff) {
+			continue
+		}
+
+		// prefer the provisioned capacity over the request
+		if q, ok := vol.Status.Capacity[v1.ResourceStorage]; ok {
+			reclaimable.Add(q)
+		} else if q, ok := vol.Spec.Resources.Requests[v1.ResourceStorage]; ok {
+			reclaimable.Add(q)
+		}
+
+		report.Volumes = append(report.Volumes, vol)
+	}
+
+	sort.Slice(report.Volumes, func(i, j int) bool {
+		return report.Volumes[i].UnusedSince.Before(report.Volumes[j].UnusedSince)
+	})
+
+	report.Count = len(report.Volumes)
+	report.ReclaimableBytes = reclaimable.Value()
+	report.Reclaimable = reclaimable.String()
+
+	return report, nil
+}
+
+// unusedSince returns the last used time recorded on the PVC,
+// or the creation time for PVCs never seen in use.
+func unusedSince(pvc v1.PersistentVolumeClaim) *metaV1.Time {
+	if v, ok := pvc.Annotations[LastUsedAnnotation]; ok {
+		t, err := time.Parse(time.RFC3339, v)
+		if err == nil {
+			lastUsed := metaV1.NewTime(t)
+			return &lastUsed
+		}
+	}
+
+	creationTimestamp := pvc.CreationTimestamp
+	return &creationTimestamp
+}
+
+// LastUsedWatch periodically stamps LastUsedAnnotation on
+// PVCs currently referenced by pods until Stopper is closed.
+func (a *API) LastUsedWatch() {
+	qps := a.LastUsedQPS
+	if qps <= 0 {
+		qps = 1
+	}
+
+	limiter := flowcontrol.NewTokenBucketRateLimiter(qps, 1)
+	ticker := time.NewTicker(a.LastUsedInterval)
+
+	go func() {
+		defer ticker.Stop()
+		defer limiter.Stop()
+
+		for {
+			select {
+			case <-a.Stopper:
+				return
+			case <-ticker.C:
+				a.StampLastUsed(limiter)
+			}
+		}
+	}()
+}
+
+// StampLastUsed stamps LastUsedAnnotation on each PVC meeting
+// the selector criteria that is referenced by a pod. PVCs stamped
+// within the last LastUsedInterval are skipped, and patches wait
+// on the limiter to avoid flooding the API server.
+func (a *API) StampLastUsed(limiter flowcontrol.RateLimiter) {
+	now := time.Now().UTC()
+
+	pvcClient := a.Cs.CoreV1().PersistentVolumeClaims(a.PVCNamespace)
+
+	for _, pvc := range a.PVCStore.GetPVCs() {
+		if !a.matchesSelector(pvc.ObjectMeta) {
+			continue
+		}
+
+		if !a.pvcInUse(pvc.Name) {
+			continue
+		}
+
+		if v, ok := pvc.Annotations[LastUsedAnnotation]; ok {
+			t, err := time.Parse(time.RFC3339, v)
+			if err == nil && now.Sub(t) < a.LastUsedInterval {
+				continue
+			}
+		}
+
+		limiter.Accept()
+
+		patch := fmt.Sprintf(`{"metadata":{"annotations":{%q:%q}}}`, LastUsedAnnotation, now.Format(time.RFC3339))
+		ctx, cancel := a.kubeContext(context.Background())
+		_, err := pvcClient.Patch(ctx, pvc.Name, types.MergePatchType, []byte(patch), metaV1.PatchOptions{})
+		cancel()
+		if err != nil {
+			a.Log.Error("StampLastUsed got error invoking pvcClient.Patch", zap.String("name", pvc.Name), zap.Error(err))
+		}
+	}
+}
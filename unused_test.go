@@ -0,0 +1,88 @@
+package volm
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+func TestUnusedReportAndStampLastUsed(t *testing.T) {
+	now := time.Now()
+	created := func(name string, age time.Duration) *v1.PersistentVolumeClaim {
+		pvc := testPVC("default", name)
+		pvc.CreationTimestamp = metaV1.NewTime(now.Add(-age))
+		return pvc
+	}
+
+	// unused for a week
+	old := created("old", 7*24*time.Hour)
+
+	// used an hour ago, though created long before
+	stamped := created("stamped", 7*24*time.Hour)
+	stamped.Annotations = map[string]string{LastUsedAnnotation: now.Add(-time.Hour).UTC().Format(time.RFC3339)}
+
+	running := testPod("default", "web", "used")
+	running.Status.Phase = v1.PodRunning
+
+	cs := fake.NewSimpleClientset(
+		old,
+		stamped,
+		created("recent", time.Minute),
+		created("used", 7*24*time.Hour),
+		running,
+	)
+	a, _ := testAPI(t, &Config{Cs: cs, LastUsedInterval: time.Minute})
+
+	report, err := a.GetUnusedReport(24 * time.Hour)
+	if err != nil {
+		t.Fatalf("GetUnusedReport: %s", err)
+	}
+
+	if report.Count != 1 || report.Volumes[0].Name != "old" {
+		t.Errorf("expected only old unused for a day, got %d volumes", report.Count)
+	}
+
+	// without olderThan every PVC without pods is unused, oldest first
+	report, err = a.GetUnusedReport(0)
+	if err != nil {
+		t.Fatalf("GetUnusedReport: %s", err)
+	}
+
+	var names []string
+	for _, vol := range report.Volumes {
+		names = append(names, vol.Name)
+	}
+	if len(names) != 3 || names[0] != "old" || names[1] != "stamped" || names[2] != "recent" {
+		t.Errorf("expected old, stamped and recent, got %v", names)
+	}
+
+	a.StampLastUsed(flowcontrol.NewFakeAlwaysRateLimiter())
+
+	for _, name := range []string{"used", "old", "stamped", "recent"} {
+		pvc, err := cs.CoreV1().PersistentVolumeClaims("default").Get(context.Background(), name, metaV1.GetOptions{})
+		if err != nil {
+			t.Fatalf("Get %s: %s", name, err)
+		}
+
+		v, ok := pvc.Annotations[LastUsedAnnotation]
+		switch name {
+		case "used":
+			if stampedAt, err := time.Parse(time.RFC3339, v); err != nil || now.Sub(stampedAt) > time.Minute {
+				t.Errorf("expected used stamped now, got %q", v)
+			}
+		case "stamped":
+			if v != stamped.Annotations[LastUsedAnnotation] {
+				t.Errorf("expected the stamp of a PVC without pods left alone, got %q", v)
+			}
+		default:
+			if ok {
+				t.Errorf("expected %s without pods not stamped, got %q", name, v)
+			}
+		}
+	}
+}
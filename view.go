@@ -0,0 +1,74 @@
+package volm
+
+import (
+	"github.com/gin-gonic/gin"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// ViewFull lists complete VolumeInfo objects
+	ViewFull = "full"
+
+	// ViewSummary lists VolumeBrief objects, leaving out the
+	// PVC spec, status and pods for a much smaller response.
+	ViewSummary = "summary"
+)
+
+// VolumeBrief is the flattened form of a VolumeInfo listed
+// with view=summary, counting the pods using the PVC.
+type VolumeBrief struct {
+	Name               string       `json:"name"`
+	Namespace          string       `json:"namespace"`
+	UID                types.UID    `json:"uid"`
+	Phase              string       `json:"phase"`
+	StorageClass       string       `json:"storageClass"`
+	RequestedBytes     int64        `json:"requestedBytes"`
+	ProvisionedBytes   int64        `json:"provisionedBytes"`
+	InUse              bool         `json:"inUse"`
+	UsedByCount        int          `json:"usedByCount"`
+	Terminating        bool         `json:"terminating"`
+	TerminatingSince   *metaV1.Time `json:"terminatingSince,omitempty"`
+	PendingSince       *metaV1.Time `json:"pendingSince,omitempty"`
+	BoundVolumeMissing bool         `json:"boundVolumeMissing,omitempty"`
+}
+
+// NewVolumeBrief flattens vol to a VolumeBrief, only scalar
+// fields are read so the spec and status are not copied.
+func NewVolumeBrief(vol *VolumeInfo) VolumeBrief {
+	return VolumeBrief{
+		Name:               vol.Name,
+		Namespace:          vol.Namespace,
+		UID:                vol.UID,
+		Phase:              vol.Phase,
+		StorageClass:       vol.StorageClass,
+		RequestedBytes:     vol.RequestedBytes,
+		ProvisionedBytes:   vol.ProvisionedBytes,
+		InUse:              vol.InUse,
+		UsedByCount:        len(vol.UsedBy),
+		Terminating:        vol.Terminating,
+		TerminatingSince:   vol.TerminatingSince,
+		PendingSince:       vol.PendingSince,
+		BoundVolumeMissing: vol.BoundVolumeMissing,
+	}
+}
+
+// listView returns the view query parameter, ViewFull when unset
+func listView(c *gin.Context) (string, error) {
+	switch view := c.DefaultQuery("view", ViewFull); view {
+	case ViewFull, ViewSummary:
+		return view, nil
+	default:
+		return "", errBadRequest("unsupported view %s, must be full or summary", view)
+	}
+}
+
+// volumeBriefs flattens vols to VolumeBriefs
+func volumeBriefs(vols []VolumeInfo) []VolumeBrief {
+	briefs := make([]VolumeBrief, 0, len(vols))
+	for i := range vols {
+		briefs = append(briefs, NewVolumeBrief(&vols[i]))
+	}
+
+	return briefs
+}
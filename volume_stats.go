@@ -0,0 +1,231 @@
+package volm
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"k8s.io/client-go/kubernetes"
+)
+
+// DefaultVolumeStatsTTL is how long a PVC list with volume stats
+// is reused when Config.VolumeStatsTTL is unset.
+const DefaultVolumeStatsTTL = time.Second * 30
+
+// VolumeUsage is the kubelet reported capacity and usage
+// of a mounted PVC's filesystem.
+type VolumeUsage struct {
+	CapacityBytes  int64     `json:"capacityBytes"`
+	UsedBytes      int64     `json:"usedBytes"`
+	AvailableBytes int64     `json:"availableBytes"`
+	InodesUsed     int64     `json:"inodesUsed"`
+	CollectedAt    time.Time `json:"collectedAt"`
+}
+
+// kubeletSummary is the subset of the kubelet stats/summary
+// response describing PVC volumes.
+type kubeletSummary struct {
+	Pods []struct {
+		Volumes []struct {
+			CapacityBytes  *int64 `json:"capacityBytes"`
+			UsedBytes      *int64 `json:"usedBytes"`
+			AvailableBytes *int64 `json:"availableBytes"`
+			InodesUsed     *int64 `json:"inodesUsed"`
+			PVCRef         *struct {
+				Name      string `json:"name"`
+				Namespace string `json:"namespace"`
+			} `json:"pvcRef"`
+		} `json:"volume"`
+	} `json:"pods"`
+}
+
+type nodeVolumeStats struct {
+	fetched time.Time
+	stats   map[string]VolumeUsage
+}
+
+// VolumeStatsCache fetches PVC volume stats from the kubelet
+// summary API of each node through the API server node proxy.
+// Stats are collected in the background by Run and requests
+// are only served from the cache.
+type VolumeStatsCache struct {
+	Cs        kubernetes.Interface
+	Log       *zap.Logger
+	Namespace string
+	TTL       time.Duration
+	nodes     map[string]nodeVolumeStats
+
+	// reported holds the PVCs with volume usage
+	// gauges set by the last collection
+	reported map[string]bool
+	sync.Mutex
+}
+
+// NewVolumeStatsCache constructs a VolumeStatsCache
+func NewVolumeStatsCache(cs kubernetes.Interface, log *zap.Logger, namespace string, ttl time.Duration) *VolumeStatsCache {
+	if ttl <= 0 {
+		ttl = DefaultVolumeStatsTTL
+	}
+
+	return &VolumeStatsCache{
+		Cs:        cs,
+		Log:       log,
+		Namespace: namespace,
+		TTL:       ttl,
+		nodes:     make(map[string]nodeVolumeStats),
+		reported:  make(map[string]bool),
+	}
+}
+
+// GetVolumeStats returns the cached stats for a PVC mounted on
+// one of the given nodes, or nil when no node reports the PVC. The
+// kubelets are never called, stats are only collected by Collect.
+func (vsc *VolumeStatsCache) GetVolumeStats(pvcName string, nodeNames []string) *VolumeUsage {
+	vsc.Lock()
+	defer vsc.Unlock()
+
+	for _, nodeName := range nodeNames {
+		if nodeName == "" {
+			continue
+		}
+
+		if stats, ok := vsc.nodes[nodeName].stats[pvcName]; ok {
+			return &stats
+		}
+	}
+
+	return nil
+}
+
+// fetchNode fetches a node's stats, failures are logged and
+// cached as empty stats until the next collection.
+func (vsc *VolumeStatsCache) fetchNode(nodeName string) nodeVolumeStats {
+	stats, err := vsc.fetch(nodeName)
+	if err != nil {
+		vsc.Log.Warn("VolumeStatsCache got error fetching kubelet stats",
+			zap.String("node", nodeName),
+			zap.Error(err),
+		)
+	}
+
+	return nodeVolumeStats{fetched: time.Now(), stats: stats}
+}
+
+func (vsc *VolumeStatsCache) fetch(nodeName string) (map[string]VolumeUsage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	stats := make(map[string]VolumeUsage)
+
+	body, err := vsc.Cs.CoreV1().RESTClient().Get().
+		Resource("nodes").
+		Name(nodeName).
+		SubResource("proxy").
+		Suffix("stats/summary").
+		DoRaw(ctx)
+	if err != nil {
+		return stats, err
+	}
+
+	collectedAt := time.Now().UTC()
+
+	summary := kubeletSummary{}
+	if err := json.Unmarshal(body, &summary); err != nil {
+		return stats, err
+	}
+
+	for _, pod := range summary.Pods {
+		for _, v := range pod.Volumes {
+			if v.PVCRef == nil || v.PVCRef.Namespace != vsc.Namespace {
+				continue
+			}
+
+			vs := VolumeUsage{CollectedAt: collectedAt}
+			if v.CapacityBytes != nil {
+				vs.CapacityBytes = *v.CapacityBytes
+			}
+			if v.UsedBytes != nil {
+				vs.UsedBytes = *v.UsedBytes
+			}
+			if v.AvailableBytes != nil {
+				vs.AvailableBytes = *v.AvailableBytes
+			}
+			if v.InodesUsed != nil {
+				vs.InodesUsed = *v.InodesUsed
+			}
+
+			stats[v.PVCRef.Name] = vs
+		}
+	}
+
+	return stats, nil
+}
+
+// Run refreshes the stats of the nodes returned by nodes every
+// interval until stop is closed, so requests are served from the
+// cache, and updates the volume usage gauges.
+func (vsc *VolumeStatsCache) Run(stop <-chan struct{}, interval time.Duration, nodes func() []string) {
+	if interval <= 0 {
+		interval = vsc.TTL
+	}
+
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		defer ticker.Stop()
+
+		for {
+			vsc.Collect(nodes())
+
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Collect fetches the stats of each node, replaces the cached nodes
+// with them and sets the volume usage gauges for every reported PVC.
+// The kubelets are called without holding the lock so requests
+// served from the cache never wait on a slow node.
+func (vsc *VolumeStatsCache) Collect(nodeNames []string) {
+	nodes := make(map[string]nodeVolumeStats, len(nodeNames))
+	for _, nodeName := range nodeNames {
+		if _, ok := nodes[nodeName]; nodeName == "" || ok {
+			continue
+		}
+
+		nodes[nodeName] = vsc.fetchNode(nodeName)
+	}
+
+	vsc.Lock()
+	defer vsc.Unlock()
+
+	vsc.nodes = nodes
+
+	reported := make(map[string]bool)
+	for _, ns := range nodes {
+		for pvcName, vs := range ns.stats {
+			reported[pvcName] = true
+			volumeCapacityBytes.WithLabelValues(pvcName).Set(float64(vs.CapacityBytes))
+			volumeUsedBytes.WithLabelValues(pvcName).Set(float64(vs.UsedBytes))
+			volumeAvailableBytes.WithLabelValues(pvcName).Set(float64(vs.AvailableBytes))
+			volumeInodesUsed.WithLabelValues(pvcName).Set(float64(vs.InodesUsed))
+		}
+	}
+
+	// unmounted PVCs are no longer reported by a kubelet
+	for pvcName := range vsc.reported {
+		if !reported[pvcName] {
+			volumeCapacityBytes.DeleteLabelValues(pvcName)
+			volumeUsedBytes.DeleteLabelValues(pvcName)
+			volumeAvailableBytes.DeleteLabelValues(pvcName)
+			volumeInodesUsed.DeleteLabelValues(pvcName)
+		}
+	}
+	vsc.reported = reported
+}
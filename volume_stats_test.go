@@ -0,0 +1,30 @@
+package volm
+
+import (
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestGetVolumeStatsServesCache(t *testing.T) {
+	// the fake clientset has no REST client, a kubelet
+	// fetch from the request path would panic
+	vsc := NewVolumeStatsCache(fake.NewSimpleClientset(), zap.NewNop(), "default", time.Millisecond)
+
+	if stats := vsc.GetVolumeStats("data", []string{"node-a"}); stats != nil {
+		t.Errorf("expected no stats before a collection, got %v", stats)
+	}
+
+	vsc.nodes["node-a"] = nodeVolumeStats{
+		fetched: time.Now().Add(-time.Hour),
+		stats:   map[string]VolumeUsage{"data": {UsedBytes: 42}},
+	}
+
+	// expired stats are still served until the next collection
+	stats := vsc.GetVolumeStats("data", []string{"", "node-b", "node-a"})
+	if stats == nil || stats.UsedBytes != 42 {
+		t.Errorf("expected the cached stats of node-a, got %v", stats)
+	}
+}
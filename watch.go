@@ -0,0 +1,188 @@
+package volm
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// DefaultWatchTimeout is how long a watch request waits
+	// for a change when timeoutSeconds is not given.
+	DefaultWatchTimeout = time.Second * 30
+
+	// MaxWatchTimeout bounds the timeoutSeconds of a watch request
+	MaxWatchTimeout = time.Minute * 5
+)
+
+// WatchResult is the delta returned by a watch request. Token is
+// passed as since on the next request to receive the changes after
+// this one, Changed and Deleted are empty when the wait timed out.
+// Deleted includes PVCs changed to no longer meet the selector
+// criteria or filters, which may name PVCs a client never received
+// and can ignore, as a Kubernetes watch does.
+type WatchResult struct {
+	Token   string       `json:"token"`
+	Changed []VolumeInfo `json:"changed"`
+	Deleted []string     `json:"deleted"`
+}
+
+// watchPVCList answers a long-poll watch request. Without since it
+// returns every PVC at once, with since it waits up to the timeout
+// for PVCs meeting the selector criteria and opts to change.
+func (a *API) watchPVCList(c *gin.Context, opts ListOptions) {
+	timeout := DefaultWatchTimeout
+	if v := c.Query("timeoutSeconds"); v != "" {
+		seconds, err := strconv.Atoi(v)
+		if err != nil || seconds < 1 {
+			WriteError(c, errBadRequest("timeoutSeconds must be a positive integer"))
+			return
+		}
+
+		timeout = time.Duration(seconds) * time.Second
+		if timeout > MaxWatchTimeout {
+			timeout = MaxWatchTimeout
+		}
+	}
+
+	since := c.Query("since")
+	if since == "" {
+		token := a.PVCStore.Token()
+		pvcList, err := a.GetPVCList()
+		if err != nil {
+			WriteError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, WatchResult{Token: token, Changed: opts.Filter(pvcList), Deleted: make([]string, 0)})
+		return
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		result, next, err := a.WatchPVCs(since, opts)
+		if err != nil {
+			WriteError(c, err)
+			return
+		}
+
+		if len(result.Changed) > 0 || len(result.Deleted) > 0 {
+			c.JSON(http.StatusOK, result)
+			return
+		}
+
+		// changes to PVCs deleted before they met the selector
+		// criteria move the token on without ending the wait
+		since = result.Token
+
+		select {
+		case <-next:
+		case <-timer.C:
+			c.JSON(http.StatusOK, result)
+			return
+		case <-c.Request.Context().Done():
+			return
+		}
+	}
+}
+
+// WatchPVCs returns the PVCs meeting the selector criteria and
+// opts that changed after the since token, those deleted or no
+// longer meeting them, and a channel closed on the next store change.
+func (a *API) WatchPVCs(since string, opts ListOptions) (WatchResult, <-chan struct{}, error) {
+	changed, deleted, token, next, err := a.PVCStore.ChangesSince(since)
+	switch err {
+	case nil:
+	case ErrTokenExpired:
+		return WatchResult{}, nil, NewAPIError(http.StatusGone, CodeTokenExpired, "since token expired, list the PVCs again to get a new token")
+	default:
+		return WatchResult{}, nil, errBadRequest("since must be a token from a previous watch response")
+	}
+
+	result := WatchResult{
+		Token:   token,
+		Changed: make([]VolumeInfo, 0, len(changed)),
+		Deleted: make([]string, 0, len(deleted)),
+	}
+
+	for _, name := range changed {
+		pvc := a.PVCStore.GetPVC(name)
+		if pvc == nil {
+			continue
+		}
+
+		// a PVC changed to no longer meet the selector criteria
+		// or opts leaves the watched list as a deletion
+		if !a.matchesSelector(pvc.ObjectMeta) {
+			result.Deleted = append(result.Deleted, name)
+			continue
+		}
+
+		vol, err := a.volumeInfo(*pvc)
+		if err != nil {
+			a.Log.Error("WatchPVCs got error invoking volumeInfo", zap.String("name", name), zap.Error(err))
+			return result, nil, err
+		}
+
+		vol, ok := opts.apply(vol)
+		if !ok {
+			result.Deleted = append(result.Deleted, name)
+			continue
+		}
+
+		result.Changed = append(result.Changed, vol)
+	}
+
+	for _, meta := range deleted {
+		if a.matchesSelector(meta) {
+			result.Deleted = append(result.Deleted, meta.Name)
+		}
+	}
+	sort.Strings(result.Deleted)
+
+	return result, next, nil
+}
+
+// watchPodChanges marks the PVCs a pod references as changed when
+// the pod is added or deleted, or an update changes its PodInfo,
+// such as a phase transition, since their UsedBy changes. Other pod
+// updates, including resyncs, leave the PVCs alone.
+func (a *API) watchPodChanges() {
+	mark := func(pod v1.Pod) {
+		for _, vol := range pod.Spec.Volumes {
+			if vol.PersistentVolumeClaim != nil {
+				a.PVCStore.MarkChanged(vol.PersistentVolumeClaim.ClaimName)
+			}
+		}
+	}
+
+	a.PodStore.OnAdd(mark)
+	a.PodStore.OnDelete(mark)
+	a.PodStore.OnChange(func(oldPod, newPod v1.Pod) {
+		if !reflect.DeepEqual(claimPodInfo(oldPod), claimPodInfo(newPod)) {
+			mark(oldPod)
+			mark(newPod)
+		}
+	})
+}
+
+// claimPodInfo returns the PodInfo listed in the UsedBy
+// of each PVC the pod references, by PVC name.
+func claimPodInfo(pod v1.Pod) map[string]PodInfo {
+	claims := make(map[string]PodInfo)
+	for _, vol := range pod.Spec.Volumes {
+		if vol.PersistentVolumeClaim != nil {
+			claims[vol.PersistentVolumeClaim.ClaimName] = podInfo(pod, vol.Name)
+		}
+	}
+
+	return claims
+}
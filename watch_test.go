@@ -0,0 +1,112 @@
+package volm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	v1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// watch sends a watch request with query and decodes the result
+func watch(t *testing.T, r *gin.Engine, query url.Values) WatchResult {
+	t.Helper()
+
+	query.Set("watch", "true")
+	w := serve(r, http.MethodGet, "/v1/vol/?"+query.Encode(), nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	result := WatchResult{}
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatalf("malformed watch result: %s", err)
+	}
+
+	return result
+}
+
+func TestWatchPodPhaseChange(t *testing.T) {
+	pod := testPod("default", "web", "data")
+	pod.ResourceVersion = "1"
+	pod.Status.Phase = v1.PodPending
+
+	cs := fake.NewSimpleClientset(testPVC("default", "data"), pod)
+	_, r := testAPI(t, &Config{Cs: cs})
+
+	token := watch(t, r, url.Values{}).Token
+
+	pod = pod.DeepCopy()
+	pod.ResourceVersion = "2"
+	pod.Status.Phase = v1.PodRunning
+	if _, err := cs.CoreV1().Pods("default").UpdateStatus(context.Background(), pod, metaV1.UpdateOptions{}); err != nil {
+		t.Fatalf("UpdateStatus: %s", err)
+	}
+
+	result := watch(t, r, url.Values{"since": {token}, "timeoutSeconds": {"5"}})
+	if len(result.Changed) != 1 || result.Changed[0].Name != "data" {
+		t.Fatalf("expected data to change, got %v", result.Changed)
+	}
+
+	if usedBy := result.Changed[0].UsedBy; len(usedBy) != 1 || usedBy[0].Phase != v1.PodRunning {
+		t.Errorf("expected data used by a Running pod, got %v", usedBy)
+	}
+
+	if result.Token == token {
+		t.Error("expected a new token")
+	}
+}
+
+func TestWatchPVCLeavesSelector(t *testing.T) {
+	pvc := testPVC("default", "data")
+	pvc.ResourceVersion = "1"
+	pvc.Labels = map[string]string{"app": "web"}
+
+	cs := fake.NewSimpleClientset(pvc)
+	_, r := testAPI(t, &Config{Cs: cs, PVCSelector: "app=web"})
+
+	token := watch(t, r, url.Values{}).Token
+
+	pvc = pvc.DeepCopy()
+	pvc.ResourceVersion = "2"
+	pvc.Labels = nil
+	if _, err := cs.CoreV1().PersistentVolumeClaims("default").Update(context.Background(), pvc, metaV1.UpdateOptions{}); err != nil {
+		t.Fatalf("Update: %s", err)
+	}
+
+	result := watch(t, r, url.Values{"since": {token}, "timeoutSeconds": {"5"}})
+	if len(result.Changed) != 0 {
+		t.Errorf("expected no changed PVCs, got %v", result.Changed)
+	}
+
+	if len(result.Deleted) != 1 || result.Deleted[0] != "data" {
+		t.Errorf("expected data deleted, got %v", result.Deleted)
+	}
+}
+
+func TestWatchTimeout(t *testing.T) {
+	cs := fake.NewSimpleClientset(testPVC("default", "data"))
+	_, r := testAPI(t, &Config{Cs: cs})
+
+	token := watch(t, r, url.Values{}).Token
+
+	start := time.Now()
+	result := watch(t, r, url.Values{"since": {token}, "timeoutSeconds": {"1"}})
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("expected the watch to wait for the timeout, returned after %s", elapsed)
+	}
+
+	if len(result.Changed) != 0 || len(result.Deleted) != 0 {
+		t.Errorf("expected an empty result, got %v", result)
+	}
+
+	if result.Token != token {
+		t.Errorf("expected token %s unchanged, got %s", token, result.Token)
+	}
+}